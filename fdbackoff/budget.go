@@ -0,0 +1,92 @@
+package fdbackoff
+
+import (
+	"sync"
+	"time"
+)
+
+// budgetBuckets is how many parts the window is split.
+const budgetBuckets = 10
+
+// Budget limit retries to a ratio of successful calls in a sliding window,
+// with that a dependency that is down don't receive a retry storm. Share the
+// same budget between all clients of a dependency:
+//  budget := fdbackoff.NewBudget(0.1, 10, 10*time.Second)
+//  policy := fdbackoff.Policy{MaxAttempts: 3, Backoff: backoff, Budget: budget}
+type Budget struct {
+	ratio      float64
+	minRetries int
+	bucketSize time.Duration
+
+	mu      sync.Mutex
+	buckets [budgetBuckets]budgetBucket
+	current int
+	started time.Time
+}
+
+type budgetBucket struct {
+	successes int
+	retries   int
+}
+
+// NewBudget allow retries up to ratio of successful calls in window, plus
+// minRetries, so a service starting or with low traffic can still retry.
+func NewBudget(ratio float64, minRetries int, window time.Duration) *Budget {
+	if window <= 0 {
+		window = 10 * time.Second
+	}
+
+	return &Budget{
+		ratio:      ratio,
+		minRetries: minRetries,
+		bucketSize: window / budgetBuckets,
+		started:    time.Now(),
+	}
+}
+
+// Success register a successful call.
+func (b *Budget) Success() {
+	b.mu.Lock()
+	b.rotate()
+	b.buckets[b.current].successes++
+	b.mu.Unlock()
+}
+
+// Withdraw return true if a retry is allowed and register it.
+func (b *Budget) Withdraw() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.rotate()
+
+	var successes, retries int
+	for _, bucket := range b.buckets {
+		successes += bucket.successes
+		retries += bucket.retries
+	}
+
+	if float64(retries) >= float64(successes)*b.ratio+float64(b.minRetries) {
+		return false
+	}
+
+	b.buckets[b.current].retries++
+	return true
+}
+
+// rotate clean buckets out of the window, it need to be called with lock.
+func (b *Budget) rotate() {
+	n := time.Since(b.started) / b.bucketSize
+	if n <= 0 {
+		return
+	}
+	b.started = b.started.Add(n * b.bucketSize)
+
+	if n > budgetBuckets {
+		n = budgetBuckets
+	}
+
+	for i := time.Duration(0); i < n; i++ {
+		b.current = (b.current + 1) % budgetBuckets
+		b.buckets[b.current] = budgetBucket{}
+	}
+}
@@ -0,0 +1,132 @@
+package fdbackoff
+
+import (
+	"math/rand"
+	"time"
+)
+
+// Stop is returned when you should not try again, it has the same value of
+// backoff.Stop from github.com/cenkalti/backoff.
+const Stop time.Duration = -1
+
+// FullJitter wait a random duration between 0 and fn(attempt), it spread
+// clients retrying at the same time:
+//  fdbackoff.FullJitter(fdbackoff.Exponential(100 * time.Millisecond))
+var FullJitter = func(fn Func) Func {
+	return func(attempt int) time.Duration {
+		d := fn(attempt)
+		if d <= 0 {
+			return d
+		}
+
+		return time.Duration(rand.Int63n(int64(d) + 1))
+	}
+}
+
+// EqualJitter wait at least half of fn(attempt) plus a random duration up
+// to the other half.
+var EqualJitter = func(fn Func) Func {
+	return func(attempt int) time.Duration {
+		d := fn(attempt)
+		if d <= 0 {
+			return d
+		}
+
+		half := d / 2
+		return half + time.Duration(rand.Int63n(int64(d-half)+1))
+	}
+}
+
+// Jitter add or remove up to factor of fn(attempt), 0.2 means +-20%.
+var Jitter = func(factor float64, fn Func) Func {
+	return func(attempt int) time.Duration {
+		d := fn(attempt)
+		if d <= 0 {
+			return d
+		}
+
+		delta := (rand.Float64()*2 - 1) * factor * float64(d)
+		return time.Duration(float64(d) + delta)
+	}
+}
+
+// Decorrelated wait a random duration between base and a limit that grows 3
+// times in each attempt, limited by max. The limit depends only on attempt,
+// so the same Func can be shared by concurrent retry loops.
+var Decorrelated = func(base, max time.Duration) Func {
+	return func(attempt int) time.Duration {
+		if attempt == 0 {
+			return 0
+		}
+
+		upper := base
+		for i := 0; i < attempt; i++ {
+			upper *= 3
+			if upper > max || upper < 0 {
+				upper = max
+				break
+			}
+		}
+		if upper <= base {
+			return upper
+		}
+
+		return base + time.Duration(rand.Int63n(int64(upper-base)+1))
+	}
+}
+
+// Cap limit fn(attempt) to max, including durations that overflow
+// after many attempts.
+var Cap = func(max time.Duration, fn Func) Func {
+	return func(attempt int) time.Duration {
+		d := fn(attempt)
+		if d > max || (d < 0 && d != Stop) {
+			return max
+		}
+
+		return d
+	}
+}
+
+// Sequence wait each duration in order, the last one is repeated:
+//  fdbackoff.Sequence(time.Second, 5*time.Second, 30*time.Second)
+var Sequence = func(durations ...time.Duration) Func {
+	return func(attempt int) time.Duration {
+		if attempt == 0 || len(durations) == 0 {
+			return 0
+		}
+
+		if attempt > len(durations) {
+			return durations[len(durations)-1]
+		}
+
+		return durations[attempt-1]
+	}
+}
+
+// MaxElapsed return Stop when the sum of fn(1) until fn(attempt) is bigger
+// than max. fn is called again for previous attempts, with jitter the sum is
+// an estimate of the time already waited.
+var MaxElapsed = func(max time.Duration, fn Func) Func {
+	return func(attempt int) time.Duration {
+		if attempt == 0 {
+			return 0
+		}
+
+		var elapsed, d time.Duration
+		for i := 1; i <= attempt; i++ {
+			d = fn(i)
+			if d < 0 {
+				// Stop or overflow
+				return Stop
+			}
+
+			elapsed += d
+			if elapsed > max || elapsed < 0 {
+				return Stop
+			}
+		}
+
+		return d
+	}
+}
@@ -0,0 +1,98 @@
+package fdbackoff_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/foodora/go-ranger/fdbackoff"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFullJitter(t *testing.T) {
+	backoff := fdbackoff.FullJitter(fdbackoff.Exponential(time.Second))
+
+	assert.Equal(t, 0*time.Second, backoff(0))
+	for i := 0; i < 100; i++ {
+		d := backoff(3)
+		assert.True(t, d >= 0 && d <= 4*time.Second, "%s", d)
+	}
+}
+
+func TestEqualJitter(t *testing.T) {
+	backoff := fdbackoff.EqualJitter(fdbackoff.Constant(2 * time.Second))
+
+	assert.Equal(t, 0*time.Second, backoff(0))
+	for i := 0; i < 100; i++ {
+		d := backoff(1)
+		assert.True(t, d >= time.Second && d <= 2*time.Second, "%s", d)
+	}
+}
+
+func TestJitter(t *testing.T) {
+	backoff := fdbackoff.Jitter(0.1, fdbackoff.Constant(10*time.Second))
+
+	for i := 0; i < 100; i++ {
+		d := backoff(1)
+		assert.True(t, d >= 9*time.Second && d <= 11*time.Second, "%s", d)
+	}
+}
+
+func TestDecorrelated(t *testing.T) {
+	backoff := fdbackoff.Decorrelated(time.Second, 10*time.Second)
+
+	assert.Equal(t, 0*time.Second, backoff(0))
+	for i := 0; i < 100; i++ {
+		d := backoff(1)
+		assert.True(t, d >= time.Second && d <= 3*time.Second, "%s", d)
+
+		d = backoff(10)
+		assert.True(t, d >= time.Second && d <= 10*time.Second, "%s", d)
+	}
+
+	// limit grows 3 times each attempt
+	for i := 0; i < 100; i++ {
+		d := backoff(2)
+		assert.True(t, d >= time.Second && d <= 9*time.Second, "%s", d)
+	}
+}
+
+func TestCap(t *testing.T) {
+	backoff := fdbackoff.Cap(5*time.Second, fdbackoff.Exponential(2*time.Second))
+
+	assert.Equal(t, 2*time.Second, backoff(1))
+	assert.Equal(t, 4*time.Second, backoff(2))
+	assert.Equal(t, 5*time.Second, backoff(3))
+	assert.Equal(t, 5*time.Second, backoff(100))
+}
+
+func TestSequence(t *testing.T) {
+	backoff := fdbackoff.Sequence(time.Second, 5*time.Second)
+
+	assert.Equal(t, 0*time.Second, backoff(0))
+	assert.Equal(t, 1*time.Second, backoff(1))
+	assert.Equal(t, 5*time.Second, backoff(2))
+	assert.Equal(t, 5*time.Second, backoff(3))
+}
+
+func TestMaxElapsed(t *testing.T) {
+	backoff := fdbackoff.MaxElapsed(10*time.Second, fdbackoff.Exponential(2*time.Second))
+
+	assert.Equal(t, 2*time.Second, backoff(1))
+	assert.Equal(t, 4*time.Second, backoff(2))
+	assert.Equal(t, fdbackoff.Stop, backoff(3))
+	assert.Equal(t, fdbackoff.Stop, backoff(4))
+
+	// a new retry loop start again
+	assert.Equal(t, 2*time.Second, backoff(1))
+}
+
+func TestMaxElapsed_SharedByRetryLoops(t *testing.T) {
+	backoff := fdbackoff.MaxElapsed(5*time.Second, fdbackoff.Exponential(time.Second))
+
+	// two loops retrying at the same time don't change each other waits
+	assert.Equal(t, 1*time.Second, backoff(1))
+	assert.Equal(t, 1*time.Second, backoff(1))
+	assert.Equal(t, 2*time.Second, backoff(2))
+	assert.Equal(t, 2*time.Second, backoff(2))
+	assert.Equal(t, fdbackoff.Stop, backoff(3))
+}
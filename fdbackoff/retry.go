@@ -0,0 +1,129 @@
+package fdbackoff
+
+import (
+	"context"
+	"time"
+)
+
+// Policy define how Retry call your function again. The same policy can be
+// shared by database, pubsub and http clients.
+type Policy struct {
+	// MaxAttempts including the first call, 0 means until context is done or
+	// Backoff return Stop.
+	MaxAttempts int
+	// Backoff is the wait before each retry, Constant(0) when nil.
+	Backoff Func
+	// Budget is optional and limit retries in the whole process.
+	Budget *Budget
+	// OnRetry is called before waiting for the next attempt.
+	OnRetry func(attempt int, err error, wait time.Duration)
+}
+
+// PermanentError stop Retry, returning Err. It's also found when wrapped by
+// other errors that implement Unwrap() error.
+type PermanentError struct {
+	Err error
+}
+
+func (e *PermanentError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap return the error that should not be retried.
+func (e *PermanentError) Unwrap() error {
+	return e.Err
+}
+
+// isPermanent check if err, or one of the errors wrapped by it, is
+// a PermanentError.
+func isPermanent(err error) bool {
+	for err != nil {
+		if _, ok := err.(*PermanentError); ok {
+			return true
+		}
+
+		wrapper, ok := err.(interface{ Unwrap() error })
+		if !ok {
+			return false
+		}
+		err = wrapper.Unwrap()
+	}
+
+	return false
+}
+
+// Permanent mark err to not be retried:
+//  if resp.StatusCode == http.StatusBadRequest {
+//      return fdbackoff.Permanent(err)
+//  }
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	return &PermanentError{Err: err}
+}
+
+// Retry call fn until it returns nil, a permanent error, the policy gives up or
+// ctx is done. fn receives the attempt number, starting from 1. The last error
+// is returned, or ctx.Err() when ctx is done while waiting.
+func Retry(ctx context.Context, p Policy, fn func(attempt int) error) error {
+	for attempt := 1; ; attempt++ {
+		err := fn(attempt)
+		if err == nil {
+			if p.Budget != nil {
+				p.Budget.Success()
+			}
+			return nil
+		}
+
+		if permanent, ok := err.(*PermanentError); ok {
+			return permanent.Err
+		}
+		if isPermanent(err) {
+			// keep the context added by wrappers
+			return err
+		}
+
+		if p.MaxAttempts > 0 && attempt >= p.MaxAttempts {
+			return err
+		}
+
+		var wait time.Duration
+		if p.Backoff != nil {
+			wait = p.Backoff(attempt)
+		}
+		if wait == Stop {
+			return err
+		}
+
+		if p.Budget != nil && !p.Budget.Withdraw() {
+			return err
+		}
+
+		if p.OnRetry != nil {
+			p.OnRetry(attempt, err, wait)
+		}
+
+		if err := Sleep(ctx, wait); err != nil {
+			return err
+		}
+	}
+}
+
+// Sleep wait d or until ctx is done, returning ctx error in that case.
+func Sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
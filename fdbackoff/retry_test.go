@@ -0,0 +1,154 @@
+package fdbackoff_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/foodora/go-ranger/fdbackoff"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetry(t *testing.T) {
+	var retries []int
+	policy := fdbackoff.Policy{
+		MaxAttempts: 5,
+		Backoff:     fdbackoff.Constant(time.Millisecond),
+		OnRetry: func(attempt int, err error, wait time.Duration) {
+			assert.Equal(t, time.Millisecond, wait)
+			retries = append(retries, attempt)
+		},
+	}
+
+	var calls []int
+	err := fdbackoff.Retry(context.Background(), policy, func(attempt int) error {
+		calls = append(calls, attempt)
+		if attempt < 3 {
+			return errors.New("failed")
+		}
+		return nil
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []int{1, 2, 3}, calls)
+	assert.Equal(t, []int{1, 2}, retries)
+}
+
+func TestRetry_MaxAttempts(t *testing.T) {
+	policy := fdbackoff.Policy{MaxAttempts: 3}
+
+	var calls int
+	err := fdbackoff.Retry(context.Background(), policy, func(attempt int) error {
+		calls++
+		return errors.New("failed")
+	})
+
+	assert.EqualError(t, err, "failed")
+	assert.Equal(t, 3, calls)
+}
+
+func TestRetry_Permanent(t *testing.T) {
+	var calls int
+	err := fdbackoff.Retry(context.Background(), fdbackoff.Policy{}, func(attempt int) error {
+		calls++
+		return fdbackoff.Permanent(errors.New("bad request"))
+	})
+
+	assert.EqualError(t, err, "bad request")
+	assert.Equal(t, 1, calls)
+	assert.Nil(t, fdbackoff.Permanent(nil))
+}
+
+type wrapError struct {
+	msg string
+	err error
+}
+
+func (e *wrapError) Error() string {
+	return e.msg + ": " + e.err.Error()
+}
+
+func (e *wrapError) Unwrap() error {
+	return e.err
+}
+
+func TestRetry_WrappedPermanent(t *testing.T) {
+	var calls int
+	err := fdbackoff.Retry(context.Background(), fdbackoff.Policy{MaxAttempts: 3}, func(attempt int) error {
+		calls++
+		return &wrapError{msg: "save order", err: fdbackoff.Permanent(errors.New("bad request"))}
+	})
+
+	assert.EqualError(t, err, "save order: bad request")
+	assert.Equal(t, 1, calls)
+}
+
+func TestRetry_Stop(t *testing.T) {
+	policy := fdbackoff.Policy{
+		Backoff: fdbackoff.MaxElapsed(5*time.Millisecond, fdbackoff.Constant(2*time.Millisecond)),
+	}
+
+	var calls int
+	err := fdbackoff.Retry(context.Background(), policy, func(attempt int) error {
+		calls++
+		return errors.New("failed")
+	})
+
+	assert.Error(t, err)
+	assert.Equal(t, 3, calls)
+}
+
+func TestRetry_ContextDone(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	policy := fdbackoff.Policy{Backoff: fdbackoff.Constant(time.Minute)}
+
+	started := time.Now()
+	err := fdbackoff.Retry(ctx, policy, func(attempt int) error {
+		return errors.New("failed")
+	})
+
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.True(t, time.Since(started) < time.Second)
+}
+
+func TestBudget(t *testing.T) {
+	budget := fdbackoff.NewBudget(0.5, 1, 50*time.Millisecond)
+
+	// min retries
+	assert.True(t, budget.Withdraw())
+	assert.False(t, budget.Withdraw())
+
+	for i := 0; i < 4; i++ {
+		budget.Success()
+	}
+	assert.True(t, budget.Withdraw())
+	assert.True(t, budget.Withdraw())
+	assert.False(t, budget.Withdraw())
+
+	// window passed
+	time.Sleep(60 * time.Millisecond)
+	assert.True(t, budget.Withdraw())
+	assert.False(t, budget.Withdraw())
+}
+
+func TestRetry_Budget(t *testing.T) {
+	budget := fdbackoff.NewBudget(0, 2, time.Minute)
+	policy := fdbackoff.Policy{MaxAttempts: 10, Budget: budget}
+
+	var calls int
+	fn := func(attempt int) error {
+		calls++
+		return errors.New("failed")
+	}
+
+	fdbackoff.Retry(context.Background(), policy, fn)
+	assert.Equal(t, 3, calls)
+
+	// budget is shared
+	calls = 0
+	fdbackoff.Retry(context.Background(), policy, fn)
+	assert.Equal(t, 1, calls)
+}
@@ -33,9 +33,23 @@ var MaxConnAttempt = 5
 //          }
 //      }
 //
-// Or you can also check some implemented strategy in the fdbackoff package.
+// Or you can also check some implemented strategy in the fdbackoff package,
+// return fdbackoff.Stop to give up before MaxConnAttempt:
+//
+//      fddb.BackoffFunc = fdbackoff.MaxElapsed(time.Minute,
+//          fdbackoff.FullJitter(fdbackoff.Exponential(2*time.Second)))
 var BackoffFunc = fdbackoff.Exponential(2 * time.Second)
 
+// RetryPolicy replace MaxConnAttempt and BackoffFunc when it's set, use it
+// to share the same policy with other clients:
+//
+//      fddb.RetryPolicy = &fdbackoff.Policy{
+//          MaxAttempts: 10,
+//          Backoff:     fdbackoff.FullJitter(fdbackoff.Exponential(time.Second)),
+//          Budget:      budget,
+//      }
+var RetryPolicy *fdbackoff.Policy
+
 // DefaultMaxOpenConnection call SetMaxOpenConns to limit the number of connection
 // because by default no limit is setted, you also can override it, calling:
 // db.SetMaxOpenConns(N)
@@ -1,9 +1,12 @@
 package fddb
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"time"
+
+	"github.com/foodora/go-ranger/fdbackoff"
 )
 
 // Open a connection with sql database using provide configuration
@@ -19,30 +22,45 @@ func OpenSQL(c DBConfig) (*sql.DB, error) {
 	db.SetMaxOpenConns(DefaultMaxOpenConnection)
 	db.SetConnMaxLifetime(1 * time.Hour)
 
-	var attempt int
-
-	for {
-		err := db.Ping()
-		if err == nil {
-			break
+	policy := connRetryPolicy()
+	onRetry := policy.OnRetry
+	policy.OnRetry = func(attempt int, err error, wait time.Duration) {
+		var prefix string
+		if policy.MaxAttempts > 0 {
+			prefix = fmt.Sprintf("[%d/%d]", attempt, policy.MaxAttempts-1)
 		}
+		defaultLogger.Printf("%s Unable to connect to database, trying again in %s: %s", prefix, wait, err)
 
-		attempt++
+		if onRetry != nil {
+			onRetry(attempt, err, wait)
+		}
+	}
 
-		var prefix string
-		if MaxConnAttempt > -1 {
-			if attempt > MaxConnAttempt {
-				return nil, fmt.Errorf("fddb: %s: unable to connect to '%s': %s", c.Driver, c, err)
-			}
+	err = fdbackoff.Retry(context.Background(), policy, func(attempt int) error {
+		return db.Ping()
+	})
+	if err != nil {
+		return nil, fmt.Errorf("fddb: %s: unable to connect to '%s': %s", c.Driver, c, err)
+	}
 
-			prefix = fmt.Sprintf("[%d/%d]", attempt, MaxConnAttempt)
-		}
+	return db, nil
+}
 
-		sleepFor := BackoffFunc(attempt)
-		defaultLogger.Printf("%s Unable to connect to database, trying again in %s: %s", prefix, sleepFor, err)
-		time.Sleep(sleepFor)
+// connRetryPolicy return RetryPolicy or one built with MaxConnAttempt
+// and BackoffFunc.
+func connRetryPolicy() fdbackoff.Policy {
+	if RetryPolicy != nil {
+		return *RetryPolicy
+	}
 
+	var maxAttempts int
+	if MaxConnAttempt > -1 {
+		// MaxConnAttempt doesn't count the first attempt
+		maxAttempts = MaxConnAttempt + 1
 	}
 
-	return db, nil
+	return fdbackoff.Policy{
+		MaxAttempts: maxAttempts,
+		Backoff:     BackoffFunc,
+	}
 }
@@ -0,0 +1,57 @@
+package fddb
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/foodora/go-ranger/fdbackoff"
+	"github.com/stretchr/testify/assert"
+)
+
+// failing is registered once with a name that doesn't collide with real
+// drivers, tests reset its state.
+var failing = &failingDriver{}
+
+func init() {
+	sql.Register("fddb_failing", failing)
+}
+
+// failingDriver fail to connect until failures is zero.
+type failingDriver struct {
+	failures int
+	opens    int
+}
+
+func (d *failingDriver) Open(name string) (driver.Conn, error) {
+	d.opens++
+	if d.failures > 0 {
+		d.failures--
+		return nil, errors.New("connection refused")
+	}
+	return nil, driver.ErrBadConn
+}
+
+func TestOpenSQL_RetryPolicy(t *testing.T) {
+	*failing = failingDriver{failures: 10}
+
+	availableDrivers["fddb_failing"] = DBConfig{Port: "5432"}
+	RetryPolicy = &fdbackoff.Policy{
+		MaxAttempts: 3,
+		Backoff:     fdbackoff.Constant(time.Millisecond),
+	}
+	defer func() {
+		delete(availableDrivers, "fddb_failing")
+		RetryPolicy = nil
+	}()
+
+	_, err := OpenSQL(DBConfig{
+		Driver: "fddb_failing",
+	})
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "connection refused")
+	}
+	assert.Equal(t, 3, failing.opens)
+}
@@ -18,14 +18,25 @@ type Client interface {
 	PostForm(url string, data url.Values) (*http.Response, error)
 }
 
-// Client is a wrap to http.Client where you can add different configurations, like
-// fdhttp.WithFallback(), fdhttp.WithBackoff(), etc.
+// Client is a wrap to http.Client where you can add different middlewares with
+// Use(), like fdmiddleware.NewFallbackTransport(), fdmiddleware.NewRetryPolicyTransport(), etc.
 type ClientImpl struct {
 	*http.Client
+	// BaseURL is used by Request() to build the url.
+	BaseURL string
+	// Header is sent with every request created by Request().
+	Header http.Header
+	// MaxResponseSize limit the body read by Request().Do(), by default
+	// DefaultMaxResponseSize.
+	MaxResponseSize int64
 	// Control when abort ticker to close idle connections.
 	maxLifetimeDone chan struct{}
+	// base is the transport before any middleware.
+	base http.RoundTripper
 }
 
+var _ fdmiddleware.Doer = &ClientImpl{}
+
 // DefaultClientTimeout will be used when create a new Client
 var DefaultClientTimeout = 10 * time.Second
 
@@ -50,6 +61,8 @@ func NewClient() *ClientImpl {
 			Timeout:   DefaultClientTimeout,
 			Transport: tr,
 		},
+		Header: http.Header{},
+		base:   tr,
 	}
 }
 
@@ -65,6 +78,14 @@ func (c *ClientImpl) Use(middlewares ...fdmiddleware.ClientMiddleware) {
 	}
 }
 
+// BaseTransport return the transport without the middlewares added by Use().
+func (c *ClientImpl) BaseTransport() http.RoundTripper {
+	if c.base == nil {
+		return http.DefaultTransport
+	}
+	return c.base
+}
+
 // StdClient return the http.Client from standard library will all
 // configuration that you have changed. Use it if you need to communicate
 // with different libraries.
@@ -0,0 +1,222 @@
+package fdhttp
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// ClientOption configure the transport created by NewClientWithOptions.
+type ClientOption func(tr *clientTransport) error
+
+// clientTransport is changed by ClientOption before the client is created.
+type clientTransport struct {
+	tls         *tls.Config
+	dnsCache    *DNSCache
+	serverNames map[string]string
+}
+
+// NewClientWithOptions return a new instance of fdhttp.Client, like
+// NewClient, changing its transport with opts:
+//  client, err := fdhttp.NewClientWithOptions(
+//      fdhttp.WithCABundle("/etc/ssl/internal-ca.pem"),
+//      fdhttp.WithClientCertificate("/etc/certs/tls.crt", "/etc/certs/tls.key"),
+//      fdhttp.WithMinTLSVersion(tls.VersionTLS12),
+//      fdhttp.WithDNSCache(fdhttp.NewDNSCache(time.Minute)),
+//  )
+func NewClientWithOptions(opts ...ClientOption) (*ClientImpl, error) {
+	c := NewClient()
+	tr := c.httpTransport()
+
+	ct := &clientTransport{
+		tls: &tls.Config{},
+	}
+	for _, opt := range opts {
+		if err := opt(ct); err != nil {
+			return nil, err
+		}
+	}
+
+	tr.TLSClientConfig = ct.tls
+	if ct.dnsCache != nil {
+		tr.DialContext = ct.dnsCache.dialWith(tr.DialContext)
+	}
+	if len(ct.serverNames) > 0 {
+		tr.DialTLS = ct.dialTLS(tr.DialContext, tr.TLSHandshakeTimeout)
+	}
+
+	return c, nil
+}
+
+// dialTLS return a function connecting with dial and verifying the server
+// certificate against the name configured for the host dialed. The handshake
+// is limited by timeout, when it's positive.
+func (ct *clientTransport) dialTLS(dial func(ctx context.Context, network, addr string) (net.Conn, error), timeout time.Duration) func(network, addr string) (net.Conn, error) {
+	return func(network, addr string) (net.Conn, error) {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+
+		config := ct.tls.Clone()
+		config.ServerName = host
+		if name, ok := ct.serverNames[addr]; ok {
+			config.ServerName = name
+		} else if name, ok := ct.serverNames[host]; ok {
+			config.ServerName = name
+		}
+
+		conn, err := dial(context.Background(), network, addr)
+		if err != nil {
+			return nil, err
+		}
+
+		tlsConn := tls.Client(conn, config)
+		if timeout > 0 {
+			tlsConn.SetDeadline(time.Now().Add(timeout))
+		}
+		if err := tlsConn.Handshake(); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		tlsConn.SetDeadline(time.Time{})
+
+		return tlsConn, nil
+	}
+}
+
+// WithCABundle trust the certificates in the PEM files, besides the system
+// ones. Use it to call services with certificates signed by an internal CA.
+func WithCABundle(files ...string) ClientOption {
+	return func(tr *clientTransport) error {
+		if tr.tls.RootCAs == nil {
+			pool, err := x509.SystemCertPool()
+			if err != nil {
+				pool = x509.NewCertPool()
+			}
+			tr.tls.RootCAs = pool
+		}
+
+		for _, file := range files {
+			pem, err := ioutil.ReadFile(file)
+			if err != nil {
+				return err
+			}
+			if !tr.tls.RootCAs.AppendCertsFromPEM(pem) {
+				return fmt.Errorf("fdhttp: no certificate found in %s", file)
+			}
+		}
+
+		return nil
+	}
+}
+
+// WithClientCertificate present the certificate to servers requiring mTLS.
+// The files are loaded again when they change, so certificates can be
+// rotated without restarting the service.
+func WithClientCertificate(certFile, keyFile string) ClientOption {
+	return func(tr *clientTransport) error {
+		r := &certReloader{certFile: certFile, keyFile: keyFile}
+		if _, err := r.certificate(); err != nil {
+			return err
+		}
+
+		tr.tls.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return r.certificate()
+		}
+		return nil
+	}
+}
+
+// WithMinTLSVersion refuse servers that doesn't support at least version,
+// like tls.VersionTLS12.
+func WithMinTLSVersion(version uint16) ClientOption {
+	return func(tr *clientTransport) error {
+		tr.tls.MinVersion = version
+		return nil
+	}
+}
+
+// WithServerName verify certificates of host against name instead of host
+// itself, useful when a service is called by IP or through a mesh. host can
+// have a port to only change the name in that port, other hosts are
+// verified as usual. The name is set when the connection is dialed, so it's
+// not used for requests sent through a proxy, like the ones configured by
+// HTTPS_PROXY, which are verified against host.
+func WithServerName(host, name string) ClientOption {
+	return func(tr *clientTransport) error {
+		if host == "" || name == "" {
+			return errors.New("fdhttp: host and server name cannot be empty")
+		}
+		if tr.serverNames == nil {
+			tr.serverNames = make(map[string]string)
+		}
+		tr.serverNames[host] = name
+		return nil
+	}
+}
+
+// WithDNSCache resolve hosts using cache.
+func WithDNSCache(cache *DNSCache) ClientOption {
+	return func(tr *clientTransport) error {
+		tr.dnsCache = cache
+		return nil
+	}
+}
+
+// certReloader load a certificate again when its files are modified.
+type certReloader struct {
+	certFile string
+	keyFile  string
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	modTime time.Time
+}
+
+func (r *certReloader) certificate() (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	modTime, err := r.lastModified()
+	if err == nil && r.cert != nil && !modTime.After(r.modTime) {
+		return r.cert, nil
+	}
+
+	var cert tls.Certificate
+	if err == nil {
+		cert, err = tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	}
+	if err != nil {
+		if r.cert != nil {
+			// files can be in the middle of a rotation, keep the last one
+			return r.cert, nil
+		}
+		return nil, err
+	}
+
+	r.cert = &cert
+	r.modTime = modTime
+	return r.cert, nil
+}
+
+func (r *certReloader) lastModified() (time.Time, error) {
+	var last time.Time
+	for _, file := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(file)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(last) {
+			last = info.ModTime()
+		}
+	}
+	return last, nil
+}
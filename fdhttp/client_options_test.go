@@ -0,0 +1,192 @@
+package fdhttp_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/foodora/go-ranger/fdhttp"
+	"github.com/stretchr/testify/assert"
+)
+
+// writeClientCert create a self signed client certificate in dir.
+func writeClientCert(t *testing.T, dir, commonName string) (certFile, keyFile string, cert *x509.Certificate) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(t, err)
+	cert, _ = x509.ParseCertificate(der)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(t, err)
+
+	certFile = filepath.Join(dir, "tls.crt")
+	keyFile = filepath.Join(dir, "tls.key")
+	assert.NoError(t, ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	assert.NoError(t, ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+
+	return certFile, keyFile, cert
+}
+
+// writeServerCA save the certificate of ts as a CA bundle.
+func writeServerCA(t *testing.T, dir string, ts *httptest.Server) string {
+	caFile := filepath.Join(dir, "ca.pem")
+	block := &pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw}
+	assert.NoError(t, ioutil.WriteFile(caFile, pem.EncodeToMemory(block), 0600))
+	return caFile
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "fdhttp")
+	assert.NoError(t, err)
+	return dir
+}
+
+func TestNewClientWithOptions_CABundle(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	defer ts.Close()
+
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	_, err := fdhttp.NewClient().Get(ts.URL)
+	assert.Error(t, err, "server certificate is not trusted by default")
+
+	c, err := fdhttp.NewClientWithOptions(
+		fdhttp.WithCABundle(writeServerCA(t, dir, ts)),
+		fdhttp.WithMinTLSVersion(tls.VersionTLS12),
+	)
+	assert.NoError(t, err)
+
+	resp, err := c.Get(ts.URL)
+	if assert.NoError(t, err) {
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.True(t, resp.TLS.Version >= tls.VersionTLS12)
+		resp.Body.Close()
+	}
+}
+
+func TestNewClientWithOptions_InvalidCABundle(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "ca.pem")
+	ioutil.WriteFile(file, []byte("not a certificate"), 0600)
+
+	_, err := fdhttp.NewClientWithOptions(fdhttp.WithCABundle(file))
+	assert.Error(t, err)
+
+	_, err = fdhttp.NewClientWithOptions(fdhttp.WithCABundle(filepath.Join(dir, "missing.pem")))
+	assert.Error(t, err)
+}
+
+func TestNewClientWithOptions_ServerName(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	defer ts.Close()
+
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	caFile := writeServerCA(t, dir, ts)
+
+	u, _ := url.Parse(ts.URL)
+	localhost := "https://localhost:" + u.Port()
+
+	// httptest certificate is valid to example.com and 127.0.0.1
+	c, err := fdhttp.NewClientWithOptions(
+		fdhttp.WithCABundle(caFile),
+		fdhttp.WithServerName("localhost", "example.com"),
+	)
+	assert.NoError(t, err)
+	resp, err := c.Get(localhost)
+	if assert.NoError(t, err) {
+		resp.Body.Close()
+	}
+
+	c, err = fdhttp.NewClientWithOptions(
+		fdhttp.WithCABundle(caFile),
+		fdhttp.WithServerName("localhost:"+u.Port(), "orders.internal"),
+	)
+	assert.NoError(t, err)
+	_, err = c.Get(localhost)
+	assert.Error(t, err)
+
+	// other hosts are verified against their own name
+	resp, err = c.Get(ts.URL)
+	if assert.NoError(t, err) {
+		resp.Body.Close()
+	}
+
+	_, err = fdhttp.NewClientWithOptions(fdhttp.WithServerName("", "example.com"))
+	assert.Error(t, err)
+}
+
+func TestNewClientWithOptions_ClientCertificate(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	certFile, keyFile, first := writeClientCert(t, dir, "first")
+
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(first)
+
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(req.TLS.PeerCertificates[0].Subject.CommonName))
+	}))
+	ts.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	ts.StartTLS()
+	defer ts.Close()
+
+	_, err := fdhttp.NewClientWithOptions(fdhttp.WithClientCertificate(filepath.Join(dir, "missing.crt"), keyFile))
+	assert.Error(t, err)
+
+	c, err := fdhttp.NewClientWithOptions(
+		fdhttp.WithCABundle(writeServerCA(t, dir, ts)),
+		fdhttp.WithClientCertificate(certFile, keyFile),
+	)
+	assert.NoError(t, err)
+
+	get := func() string {
+		resp, err := c.Get(ts.URL)
+		if !assert.NoError(t, err) {
+			return ""
+		}
+		defer resp.Body.Close()
+		body, _ := ioutil.ReadAll(resp.Body)
+		return string(body)
+	}
+	assert.Equal(t, "first", get())
+
+	// rotate certificate
+	_, _, second := writeClientCert(t, dir, "second")
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(certFile, later, later)
+	os.Chtimes(keyFile, later, later)
+	clientCAs.AddCert(second)
+
+	c.CloseIdleConnections()
+	assert.Equal(t, "second", get())
+}
@@ -0,0 +1,222 @@
+package fdhttp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/foodora/go-ranger/fdhttp/fdmiddleware"
+)
+
+// DefaultMaxResponseSize is the biggest body read by ClientRequest.Do when
+// ClientImpl.MaxResponseSize is not set.
+var DefaultMaxResponseSize int64 = 10 << 20 // 10 MB
+
+// ErrResponseTooLarge is returned when the response body is bigger than
+// ClientImpl.MaxResponseSize.
+var ErrResponseTooLarge = errors.New("fdhttp: response body too large")
+
+// StatusError is returned by ClientRequest.Do when the server answer
+// with a status code different of 2xx.
+type StatusError struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+	// Err is filled when the server send a fdhttp.Error
+	Err *Error
+}
+
+func (e *StatusError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("fdhttp: unexpected status code %d: %s", e.StatusCode, e.Err)
+	}
+
+	body := string(e.Body)
+	if len(body) > 200 {
+		body = body[:200] + "..."
+	}
+	return fmt.Sprintf("fdhttp: unexpected status code %d: %s", e.StatusCode, body)
+}
+
+// ClientRequest build a request to a json api, create it with
+// ClientImpl.Request:
+//  var order Order
+//  err := client.Request("GET", "/orders/:id").
+//      Param("id", "10").
+//      Query("expand", "items").
+//      Do(ctx, &order)
+type ClientRequest struct {
+	client *ClientImpl
+	method string
+	path   string
+	params map[string]string
+	query  url.Values
+	header http.Header
+	body   interface{}
+}
+
+// Request create a request to path, relative to BaseURL. Path can have params
+// like the ones used in Router.
+func (c *ClientImpl) Request(method, path string) *ClientRequest {
+	return &ClientRequest{
+		client: c,
+		method: method,
+		path:   path,
+		params: map[string]string{},
+		query:  url.Values{},
+		header: http.Header{},
+	}
+}
+
+// Param set a path param, values are escaped.
+func (r *ClientRequest) Param(key, value string) *ClientRequest {
+	r.params[key] = value
+	return r
+}
+
+// Query add a query string.
+func (r *ClientRequest) Query(key, value string) *ClientRequest {
+	r.query.Add(key, value)
+	return r
+}
+
+// Header set a header, it has precedence to ClientImpl.Header.
+func (r *ClientRequest) Header(key, value string) *ClientRequest {
+	r.header.Set(key, value)
+	return r
+}
+
+// JSON send v encoded as json.
+func (r *ClientRequest) JSON(v interface{}) *ClientRequest {
+	r.body = v
+	return r
+}
+
+// URL return the url with base url, params and query.
+func (r *ClientRequest) URL() string {
+	path := r.path
+	if strings.ContainsAny(path, ":*") {
+		params := make(map[string]string, len(r.params))
+		for k, v := range r.params {
+			if strings.Contains(path, "*"+k) {
+				// catch all params can have slashes
+				params[k] = v
+			} else {
+				params[k] = url.PathEscape(v)
+			}
+		}
+		path = (Endpoint{Path: path}).PathParam(params)
+	}
+
+	u := strings.TrimSuffix(r.client.BaseURL, "/") + path
+	if len(r.query) > 0 {
+		u += "?" + r.query.Encode()
+	}
+
+	return u
+}
+
+// HTTPRequest return the *http.Request that will be sent.
+func (r *ClientRequest) HTTPRequest(ctx context.Context) (*http.Request, error) {
+	var body io.Reader
+	if r.body != nil {
+		b, err := json.Marshal(r.body)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequest(r.method, r.URL(), body)
+	if err != nil {
+		return nil, err
+	}
+
+	for k, v := range r.client.Header {
+		req.Header[k] = append([]string(nil), v...)
+	}
+	for k, v := range r.header {
+		req.Header[k] = v
+	}
+
+	if r.body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if req.Header.Get("Accept") == "" {
+		req.Header.Set("Accept", "application/json")
+	}
+
+	if fdmiddleware.RouteTemplate(ctx) == "" {
+		ctx = fdmiddleware.SetRouteTemplate(ctx, r.path)
+	}
+
+	return req.WithContext(ctx), nil
+}
+
+// Do send the request and decode the json response into v, v can be nil to
+// ignore the body. When the status code is not 2xx a *StatusError is
+// returned. The body is always closed.
+func (r *ClientRequest) Do(ctx context.Context, v interface{}) error {
+	req, err := r.HTTPRequest(ctx)
+	if err != nil {
+		return err
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := r.client.readBody(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		statusErr := &StatusError{
+			StatusCode: resp.StatusCode,
+			Header:     resp.Header,
+			Body:       body,
+		}
+
+		var e Error
+		if json.Unmarshal(body, &e) == nil && e.Code != "" {
+			statusErr.Err = &e
+		}
+
+		return statusErr
+	}
+
+	if v == nil || len(body) == 0 {
+		return nil
+	}
+
+	return json.Unmarshal(body, v)
+}
+
+// readBody read up to MaxResponseSize.
+func (c *ClientImpl) readBody(body io.Reader) ([]byte, error) {
+	max := c.MaxResponseSize
+	if max <= 0 {
+		max = DefaultMaxResponseSize
+	}
+
+	b, err := ioutil.ReadAll(io.LimitReader(body, max+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if int64(len(b)) > max {
+		return nil, ErrResponseTooLarge
+	}
+
+	return b, nil
+}
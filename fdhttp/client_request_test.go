@@ -0,0 +1,120 @@
+package fdhttp_test
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/foodora/go-ranger/fdhttp"
+	"github.com/foodora/go-ranger/fdhttp/fdhttptest"
+	"github.com/foodora/go-ranger/fdhttp/fdmiddleware"
+	"github.com/stretchr/testify/assert"
+)
+
+type order struct {
+	ID    int      `json:"id"`
+	Items []string `json:"items"`
+}
+
+func TestClientRequest_URL(t *testing.T) {
+	c := fdhttp.NewClient()
+	c.BaseURL = "http://example.com/api/"
+
+	u := c.Request(http.MethodGet, "/orders/:id/files/*path").
+		Param("id", "a b/c").
+		Param("path", "x/y.txt").
+		Query("expand", "items").
+		Query("expand", "vendor").
+		URL()
+
+	assert.Equal(t, "http://example.com/api/orders/a%20b%2Fc/files/x/y.txt?expand=items&expand=vendor", u)
+}
+
+func TestClientRequest_RouteTemplate(t *testing.T) {
+	c := fdhttp.NewClient()
+
+	req, err := c.Request(http.MethodGet, "/orders/:id").
+		Param("id", "10").
+		HTTPRequest(context.Background())
+
+	assert.NoError(t, err)
+	assert.Equal(t, "/orders/10", req.URL.Path)
+	assert.Equal(t, "/orders/:id", fdmiddleware.RouteTemplate(req.Context()))
+}
+
+func TestClientRequest_Do(t *testing.T) {
+	server := fdhttptest.NewMockServer(t)
+	defer server.Close()
+
+	server.Expect(http.MethodPut, "/orders/:id").
+		WithHeader("Authorization", "token").
+		WithHeader("X-Country", "at").
+		WithHeader("Content-Type", "application/json").
+		WithJSONBody(order{Items: []string{"pizza"}}).
+		Respond(http.StatusOK, order{ID: 10, Items: []string{"pizza"}})
+
+	c := fdhttp.NewClient()
+	c.BaseURL = server.URL
+	c.Header.Set("Authorization", "token")
+	c.Header.Set("X-Country", "de")
+
+	var resp order
+	err := c.Request(http.MethodPut, "/orders/:id").
+		Param("id", "10").
+		Header("X-Country", "at").
+		JSON(order{Items: []string{"pizza"}}).
+		Do(context.Background(), &resp)
+
+	assert.NoError(t, err)
+	assert.Equal(t, order{ID: 10, Items: []string{"pizza"}}, resp)
+	server.Verify()
+}
+
+func TestClientRequest_DoWithError(t *testing.T) {
+	server := fdhttptest.NewMockServer(t)
+	defer server.Close()
+
+	server.Expect(http.MethodGet, "/orders/1").
+		Respond(http.StatusNotFound, &fdhttp.Error{Code: "not_found", Message: "order not found"})
+	server.Expect(http.MethodGet, "/orders/2").
+		Respond(http.StatusBadGateway, "<html>bad gateway</html>")
+
+	c := fdhttp.NewClient()
+	c.BaseURL = server.URL
+
+	var resp order
+	err := c.Request(http.MethodGet, "/orders/1").Do(context.Background(), &resp)
+	if statusErr, ok := err.(*fdhttp.StatusError); assert.True(t, ok) {
+		assert.Equal(t, http.StatusNotFound, statusErr.StatusCode)
+		assert.Equal(t, "not_found", statusErr.Err.Code)
+		assert.Equal(t, "fdhttp: unexpected status code 404: not_found: order not found", err.Error())
+	}
+
+	err = c.Request(http.MethodGet, "/orders/2").Do(context.Background(), &resp)
+	if statusErr, ok := err.(*fdhttp.StatusError); assert.True(t, ok) {
+		assert.Nil(t, statusErr.Err)
+		assert.Equal(t, "<html>bad gateway</html>", string(statusErr.Body))
+	}
+}
+
+func TestClientRequest_DoResponseTooLarge(t *testing.T) {
+	server := fdhttptest.NewMockServer(t)
+	defer server.Close()
+
+	server.Expect(http.MethodGet, "/orders").
+		Respond(http.StatusOK, strings.Repeat("a", 11))
+	server.Expect(http.MethodGet, "/empty").
+		Respond(http.StatusNoContent, nil)
+
+	c := fdhttp.NewClient()
+	c.BaseURL = server.URL
+	c.MaxResponseSize = 10
+
+	err := c.Request(http.MethodGet, "/orders").Do(context.Background(), nil)
+	assert.Equal(t, fdhttp.ErrResponseTooLarge, err)
+
+	var resp order
+	err = c.Request(http.MethodGet, "/empty").Do(context.Background(), &resp)
+	assert.NoError(t, err)
+}
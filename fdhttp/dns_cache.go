@@ -0,0 +1,133 @@
+package fdhttp
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+// HostResolver resolve a host to its addresses, *net.Resolver implements it.
+type HostResolver interface {
+	LookupHost(ctx context.Context, host string) ([]string, error)
+}
+
+// DNSCache keep the addresses resolved for each host during TTL, to avoid
+// a DNS query for every new connection. If a lookup fails after TTL, the
+// expired addresses are used until the DNS is back.
+type DNSCache struct {
+	TTL      time.Duration
+	Resolver HostResolver
+
+	mu      sync.Mutex
+	entries map[string]*dnsEntry
+}
+
+type dnsEntry struct {
+	addrs   []string
+	expires time.Time
+	next    int
+}
+
+// NewDNSCache return a DNSCache using the default resolver.
+func NewDNSCache(ttl time.Duration) *DNSCache {
+	return &DNSCache{
+		TTL:      ttl,
+		Resolver: net.DefaultResolver,
+		entries:  make(map[string]*dnsEntry),
+	}
+}
+
+// LookupHost return the addresses of host, from cache when not expired.
+// Addresses are rotated in each call to spread connections.
+func (c *DNSCache) LookupHost(ctx context.Context, host string) ([]string, error) {
+	c.mu.Lock()
+	if c.entries == nil {
+		c.entries = make(map[string]*dnsEntry)
+	}
+	entry, ok := c.entries[host]
+	c.mu.Unlock()
+
+	if !ok || time.Now().After(entry.expires) {
+		addrs, err := c.Resolver.LookupHost(ctx, host)
+		if err == nil && len(addrs) == 0 {
+			err = &net.DNSError{Err: "no such host", Name: host}
+		}
+		if err != nil {
+			if !ok {
+				return nil, err
+			}
+			// keep stale addresses
+		} else {
+			entry = &dnsEntry{addrs: addrs, expires: time.Now().Add(c.TTL)}
+			c.mu.Lock()
+			c.entries[host] = entry
+			c.mu.Unlock()
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	addrs := make([]string, 0, len(entry.addrs))
+	addrs = append(addrs, entry.addrs[entry.next:]...)
+	addrs = append(addrs, entry.addrs[:entry.next]...)
+	entry.next = (entry.next + 1) % len(entry.addrs)
+
+	return addrs, nil
+}
+
+// Flush remove all hosts from cache.
+func (c *DNSCache) Flush() {
+	c.mu.Lock()
+	c.entries = make(map[string]*dnsEntry)
+	c.mu.Unlock()
+}
+
+// DialContext resolve address host using the cache and connect to the first
+// address that accepts the connection.
+func (c *DNSCache) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	return c.dial(ctx, (&net.Dialer{}).DialContext, network, address)
+}
+
+// dialWith return a DialContext connecting with dial, so a cache can be
+// shared by transports with different dialers.
+func (c *DNSCache) dialWith(dial func(ctx context.Context, network, address string) (net.Conn, error)) func(ctx context.Context, network, address string) (net.Conn, error) {
+	if dial == nil {
+		return c.DialContext
+	}
+
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		return c.dial(ctx, dial, network, address)
+	}
+}
+
+func (c *DNSCache) dial(ctx context.Context, dial func(ctx context.Context, network, address string) (net.Conn, error), network, address string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	if net.ParseIP(host) != nil {
+		return dial(ctx, network, address)
+	}
+
+	addrs, err := c.LookupHost(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	err = errors.New("fdhttp: no address to dial")
+	for _, addr := range addrs {
+		var conn net.Conn
+		conn, err = dial(ctx, network, net.JoinHostPort(addr, port))
+		if err == nil {
+			return conn, nil
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	return nil, err
+}
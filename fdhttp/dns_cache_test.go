@@ -0,0 +1,122 @@
+package fdhttp_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/foodora/go-ranger/fdhttp"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeResolver struct {
+	mu      sync.Mutex
+	addrs   map[string][]string
+	err     error
+	lookups int
+}
+
+func (r *fakeResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.lookups++
+	if r.err != nil {
+		return nil, r.err
+	}
+	return r.addrs[host], nil
+}
+
+func TestDNSCache_LookupHost(t *testing.T) {
+	resolver := &fakeResolver{addrs: map[string][]string{
+		"orders.internal": {"10.0.0.1", "10.0.0.2"},
+	}}
+	cache := fdhttp.NewDNSCache(50 * time.Millisecond)
+	cache.Resolver = resolver
+
+	ctx := context.Background()
+
+	addrs, err := cache.LookupHost(ctx, "orders.internal")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"10.0.0.1", "10.0.0.2"}, addrs)
+
+	addrs, err = cache.LookupHost(ctx, "orders.internal")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"10.0.0.2", "10.0.0.1"}, addrs, "addresses are rotated")
+	assert.Equal(t, 1, resolver.lookups)
+
+	_, err = cache.LookupHost(ctx, "unknown.internal")
+	assert.Error(t, err)
+
+	// stale addresses are used when DNS fails
+	time.Sleep(60 * time.Millisecond)
+	resolver.err = errors.New("dns timeout")
+	addrs, err = cache.LookupHost(ctx, "orders.internal")
+	assert.NoError(t, err)
+	assert.Len(t, addrs, 2)
+
+	resolver.err = nil
+	resolver.addrs["orders.internal"] = []string{"10.0.0.3"}
+	cache.Flush()
+	addrs, err = cache.LookupHost(ctx, "orders.internal")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"10.0.0.3"}, addrs)
+}
+
+func TestNewClientWithOptions_DNSCache(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	defer ts.Close()
+
+	u, _ := url.Parse(ts.URL)
+	resolver := &fakeResolver{addrs: map[string][]string{
+		"orders.internal": {"127.0.0.1"},
+	}}
+	cache := fdhttp.NewDNSCache(time.Minute)
+	cache.Resolver = resolver
+
+	c, err := fdhttp.NewClientWithOptions(fdhttp.WithDNSCache(cache))
+	assert.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		resp, err := c.Get("http://orders.internal:" + u.Port() + "/")
+		if assert.NoError(t, err) {
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			resp.Body.Close()
+		}
+		c.CloseIdleConnections()
+	}
+
+	assert.Equal(t, 1, resolver.lookups)
+}
+
+func TestNewClientWithOptions_SharedDNSCache(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	defer ts.Close()
+
+	u, _ := url.Parse(ts.URL)
+	cache := fdhttp.NewDNSCache(time.Minute)
+	cache.Resolver = &fakeResolver{addrs: map[string][]string{
+		"orders.internal": {"127.0.0.1"},
+	}}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			c, err := fdhttp.NewClientWithOptions(fdhttp.WithDNSCache(cache))
+			assert.NoError(t, err)
+			resp, err := c.Get("http://orders.internal:" + u.Port() + "/")
+			if assert.NoError(t, err) {
+				resp.Body.Close()
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -3,6 +3,7 @@ package fdhandler
 import (
 	"context"
 	"net/http"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -14,16 +15,38 @@ import (
 // CORSOriginAll can be passed to NewCORSMiddleware to accept all domains
 const CORSOriginAll = "*"
 
+// CORSDefaultAllowHeaders is the list of request headers accepted by default.
+var CORSDefaultAllowHeaders = []string{
+	"Accept",
+	"Accept-Language",
+	"Content-Language",
+	"Content-Type",
+	"Authorization",
+}
+
+var _ fdhttp.Handler = &CORS{}
+var _ fdmiddleware.Middleware = &CORS{}
+
 type CORS struct {
 	router *fdhttp.Router
 
-	// Origin that we accept, but defailt is setted with CORSOriginAll
+	// Origin that we accept, but defailt is setted with CORSOriginAll.
+	// It's used only when AllowOrigins is empty.
 	Origin string
-	// Credentials control if we'll send Access-Control-Allow-Credentials or not
+	// AllowOrigins is the list of origins that we accept. Each value can be
+	// CORSOriginAll, an exact origin like "https://www.foodora.com" or
+	// a wildcard subdomain like "https://*.foodora.com".
+	AllowOrigins []string
+	// Credentials control if we'll send Access-Control-Allow-Credentials or not.
+	// CORSOriginAll is ignored with credentials, set the allowed origins.
 	Credentials bool
-	// Methods is the list of methods that can be accept
+	// Methods is the list of methods that can be accept, if empty they're
+	// loaded from the router for the requested path.
 	Methods []string
-	// ExposeHeaders is the list of header that we can expose
+	// AllowHeaders is the list of headers that clients can send, use "*"
+	// to accept any header. By default CORSDefaultAllowHeaders.
+	AllowHeaders []string
+	// ExposeHeaders is the list of response headers that clients can read
 	ExposeHeaders []string
 	// MaxAge is setted 1 hour by default
 	MaxAge time.Duration
@@ -31,39 +54,148 @@ type CORS struct {
 
 func NewCORS() *CORS {
 	return &CORS{
-		Origin: CORSOriginAll,
-		MaxAge: 1 * time.Hour,
+		Origin:       CORSOriginAll,
+		AllowHeaders: CORSDefaultAllowHeaders,
+		MaxAge:       1 * time.Hour,
 	}
 }
 
 func (h *CORS) Init(router *fdhttp.Router) {
 	h.router = router
 	router.OPTIONS("/*anything", h.PreFlight)
-	router.Use(NewCORSMiddleware(h.Origin))
+	router.Use(h)
 }
 
-func (h *CORS) PreFlight(ctx context.Context) (int, interface{}) {
-	fdhttp.SetResponseHeaderValue(ctx, "Access-Control-Allow-Origin", h.Origin)
+// allowOrigin return the value that should be sent as Access-Control-Allow-Origin
+// or empty if origin is not allowed.
+func (h *CORS) allowOrigin(origin string) string {
+	if origin == "" {
+		return ""
+	}
 
-	if len(h.Methods) == 0 {
-		endpoints := h.router.Endpoints()
-		methodsMap := make(map[string]struct{})
+	origins := h.AllowOrigins
+	if len(origins) == 0 {
+		origins = []string{h.Origin}
+	}
 
-		for _, e := range endpoints {
-			if _, ok := methodsMap[e.Method]; !ok {
-				methodsMap[e.Method] = struct{}{}
-				h.Methods = append(h.Methods, e.Method)
+	lowerOrigin := strings.ToLower(origin)
+	for _, o := range origins {
+		if o == CORSOriginAll {
+			if h.Credentials {
+				// any site could read responses using the user cookies
+				continue
 			}
+			return CORSOriginAll
+		}
+
+		o = strings.ToLower(o)
+		if o == lowerOrigin {
+			return origin
+		}
+
+		i := strings.Index(o, "*")
+		if i < 0 {
+			continue
+		}
+
+		prefix, suffix := o[:i], o[i+1:]
+		if len(lowerOrigin) <= len(prefix)+len(suffix) ||
+			!strings.HasPrefix(lowerOrigin, prefix) ||
+			!strings.HasSuffix(lowerOrigin, suffix) {
+			continue
+		}
+
+		subdomain := lowerOrigin[len(prefix) : len(lowerOrigin)-len(suffix)]
+		if !strings.ContainsAny(subdomain, "/:@") {
+			return origin
+		}
+	}
+
+	return ""
+}
+
+// methods return all methods accepted by path.
+func (h *CORS) methods(path string) []string {
+	if len(h.Methods) > 0 {
+		return h.Methods
+	}
+
+	methodsMap := make(map[string]struct{})
+	for _, e := range h.router.Endpoints() {
+		// OPTIONS is registered for all paths by Init
+		if e.Method == http.MethodOptions {
+			continue
 		}
+		methodsMap[e.Method] = struct{}{}
 	}
 
-	fdhttp.SetResponseHeaderValue(ctx, "Access-Control-Allow-Methods", strings.Join(h.Methods, ", "))
+	methods := make([]string, 0, len(methodsMap))
+	for m := range methodsMap {
+		if handle, _, _ := h.router.Lookup(m, path); handle != nil {
+			methods = append(methods, m)
+		}
+	}
 
-	if h.Credentials {
-		fdhttp.SetResponseHeaderValue(ctx, "Access-Control-Allow-Credentials", "true")
+	sort.Strings(methods)
+	return methods
+}
+
+// allowHeader check if clients can send header.
+func (h *CORS) allowHeader(header string) bool {
+	for _, allowed := range h.AllowHeaders {
+		if allowed == "*" || strings.EqualFold(allowed, header) {
+			return true
+		}
+	}
+	return false
+}
+
+// PreFlight is a fdhttp.EndpointFunc that answer OPTIONS requests sent by
+// browsers before the real request. Requests from origins, methods or headers
+// that are not allowed receive 403 without any CORS header.
+func (h *CORS) PreFlight(ctx context.Context) (int, interface{}) {
+	origin := fdhttp.RequestHeaderValue(ctx, "Origin")
+	reqMethod := fdhttp.RequestHeaderValue(ctx, "Access-Control-Request-Method")
+	if origin == "" || reqMethod == "" {
+		// it's not a preflight request
+		return http.StatusOK, nil
+	}
+
+	if h.allowOrigin(origin) == "" {
+		return http.StatusForbidden, &fdhttp.Error{
+			Code:    "cors_origin_not_allowed",
+			Message: "Origin '" + origin + "' is not allowed",
+		}
 	}
-	if len(h.ExposeHeaders) > 0 {
-		fdhttp.SetResponseHeaderValue(ctx, "Access-Control-Allow-Headers", strings.Join(h.ExposeHeaders, ","))
+
+	methods := h.methods(fdhttp.Request(ctx).URL.Path)
+	if !containsString(methods, reqMethod) {
+		return http.StatusForbidden, &fdhttp.Error{
+			Code:    "cors_method_not_allowed",
+			Message: "Method '" + reqMethod + "' is not allowed",
+		}
+	}
+
+	var reqHeaders []string
+	for _, header := range strings.Split(fdhttp.RequestHeaderValue(ctx, "Access-Control-Request-Headers"), ",") {
+		header = strings.TrimSpace(header)
+		if header == "" {
+			continue
+		}
+		if !h.allowHeader(header) {
+			return http.StatusForbidden, &fdhttp.Error{
+				Code:    "cors_header_not_allowed",
+				Message: "Header '" + header + "' is not allowed",
+			}
+		}
+		reqHeaders = append(reqHeaders, header)
+	}
+
+	h.setOriginHeaders(fdhttp.ResponseHeader(ctx), origin)
+	fdhttp.SetResponseHeaderValue(ctx, "Access-Control-Allow-Methods", strings.Join(methods, ", "))
+
+	if len(reqHeaders) > 0 {
+		fdhttp.SetResponseHeaderValue(ctx, "Access-Control-Allow-Headers", strings.Join(reqHeaders, ", "))
 	}
 	if h.MaxAge > 0 {
 		fdhttp.SetResponseHeaderValue(ctx, "Access-Control-Max-Age", strconv.FormatInt(int64(h.MaxAge/time.Second), 10))
@@ -72,16 +204,54 @@ func (h *CORS) PreFlight(ctx context.Context) (int, interface{}) {
 	return http.StatusOK, nil
 }
 
-// NewCORSMiddleware create a cors middleware
-func NewCORSMiddleware(origin string) fdmiddleware.Middleware {
-	return fdmiddleware.MiddlewareFunc(func(next http.Handler) http.Handler {
-		fn := func(w http.ResponseWriter, req *http.Request) {
-			if req.Method != http.MethodOptions {
-				w.Header().Set("Access-Control-Allow-Origin", origin)
+// setOriginHeaders set headers that are sent in preflight and real requests.
+func (h *CORS) setOriginHeaders(header http.Header, origin string) {
+	allowOrigin := h.allowOrigin(origin)
+	if allowOrigin != CORSOriginAll {
+		// response changes according the origin, caches need to know that
+		header.Add("Vary", "Origin")
+	}
+	if allowOrigin == "" {
+		return
+	}
+
+	header.Set("Access-Control-Allow-Origin", allowOrigin)
+	if h.Credentials {
+		header.Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+// Wrap add CORS headers to all requests, except OPTIONS that are
+// answered by PreFlight.
+func (h *CORS) Wrap(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, req *http.Request) {
+		origin := req.Header.Get("Origin")
+		if req.Method != http.MethodOptions && origin != "" {
+			h.setOriginHeaders(w.Header(), origin)
+			if len(h.ExposeHeaders) > 0 && h.allowOrigin(origin) != "" {
+				w.Header().Set("Access-Control-Expose-Headers", strings.Join(h.ExposeHeaders, ", "))
 			}
-			next.ServeHTTP(w, req)
 		}
+		next.ServeHTTP(w, req)
+	}
 
-		return http.HandlerFunc(fn)
-	})
+	return http.HandlerFunc(fn)
+}
+
+// NewCORSMiddleware create a cors middleware that accept origins, check
+// CORS.AllowOrigins to see the format. Use it when you don't want to register
+// the preflight handler.
+func NewCORSMiddleware(origins ...string) fdmiddleware.Middleware {
+	return &CORS{
+		AllowOrigins: origins,
+	}
+}
+
+func containsString(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
 }
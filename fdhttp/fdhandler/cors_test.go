@@ -26,10 +26,12 @@ func TestCORSMiddleware(t *testing.T) {
 	})
 
 	req := httptest.NewRequest("GET", "/foo", nil)
+	req.Header.Set("Origin", origin)
 	w := httptest.NewRecorder()
 	router.ServeHTTP(w, req)
 
 	assert.Equal(t, origin, w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "Origin", w.Header().Get("Vary"))
 }
 
 func TestCORSMiddleware_IsIgnoredIfHandlerSetted(t *testing.T) {
@@ -45,6 +47,7 @@ func TestCORSMiddleware_IsIgnoredIfHandlerSetted(t *testing.T) {
 
 	// standard handler
 	req := httptest.NewRequest("GET", "/foo", nil)
+	req.Header.Set("Origin", origin)
 	w := httptest.NewRecorder()
 	router.ServeHTTP(w, req)
 
@@ -64,12 +67,67 @@ func TestCORSMiddleware_IsIgnoredIfStdHandlerSetted(t *testing.T) {
 	})
 
 	req := httptest.NewRequest("GET", "/foo", nil)
+	req.Header.Set("Origin", origin)
 	w := httptest.NewRecorder()
 	router.ServeHTTP(w, req)
 
 	assert.Equal(t, fdhandler.CORSOriginAll, w.Header().Get("Access-Control-Allow-Origin"))
 }
 
+func TestCORSMiddleware_MultipleOrigins(t *testing.T) {
+	corsMiddleware := fdhandler.NewCORSMiddleware("https://www.foodora.com", "https://*.foodpanda.com")
+
+	router := fdhttp.NewRouter()
+	router.Use(corsMiddleware)
+	router.StdGET("/foo", func(w http.ResponseWriter, req *http.Request) {})
+
+	cases := map[string]string{
+		"https://www.foodora.com":          "https://www.foodora.com",
+		"https://api.foodpanda.com":        "https://api.foodpanda.com",
+		"https://a.b.foodpanda.com":        "https://a.b.foodpanda.com",
+		"https://foodpanda.com":            "",
+		"http://api.foodpanda.com":         "",
+		"https://evil.com/.foodpanda.com":  "",
+		"https://evil.com:.foodpanda.com":  "",
+		"https://www.foodora.com.evil.com": "",
+	}
+
+	for origin, expected := range cases {
+		req := httptest.NewRequest("GET", "/foo", nil)
+		req.Header.Set("Origin", origin)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, expected, w.Header().Get("Access-Control-Allow-Origin"), origin)
+		assert.Equal(t, "Origin", w.Header().Get("Vary"), origin)
+	}
+}
+
+func TestCORSMiddleware_WithoutOriginIsNotCORS(t *testing.T) {
+	corsMiddleware := fdhandler.NewCORSMiddleware(fdhandler.CORSOriginAll)
+
+	router := fdhttp.NewRouter()
+	router.Use(corsMiddleware)
+	router.StdGET("/foo", func(w http.ResponseWriter, req *http.Request) {})
+
+	req := httptest.NewRequest("GET", "/foo", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	_, ok := w.HeaderMap["Access-Control-Allow-Origin"]
+	assert.False(t, ok)
+}
+
+func newPreflightRequest(path, origin, method string, headers ...string) *http.Request {
+	req := httptest.NewRequest(http.MethodOptions, path, nil)
+	req.Header.Set("Origin", origin)
+	req.Header.Set("Access-Control-Request-Method", method)
+	if len(headers) > 0 {
+		req.Header.Set("Access-Control-Request-Headers", strings.Join(headers, ","))
+	}
+	return req
+}
+
 func TestNewCORS(t *testing.T) {
 	corsHandler := fdhandler.NewCORS()
 	corsHandler.Origin = "https://api.foodora.com"
@@ -79,28 +137,49 @@ func TestNewCORS(t *testing.T) {
 		"GET",
 		"PUT",
 	}
-	corsHandler.ExposeHeaders = []string{
+	corsHandler.AllowHeaders = []string{
+		"Content-Type",
 		"X-Personal-One",
+	}
+	corsHandler.ExposeHeaders = []string{
 		"X-Personal-Two",
+		"X-Personal-Three",
 	}
 	corsHandler.MaxAge = 25 * time.Minute
 
 	router := fdhttp.NewRouter()
 	router.Register(corsHandler)
+	router.GET("/foo", func(ctx context.Context) (int, interface{}) {
+		return http.StatusOK, nil
+	})
 
-	req := httptest.NewRequest(http.MethodOptions, "/foo", nil)
+	req := newPreflightRequest("/foo", corsHandler.Origin, "PUT", "content-type", "x-personal-one")
 	w := httptest.NewRecorder()
 	router.ServeHTTP(w, req)
 
+	assert.Equal(t, http.StatusOK, w.Code)
 	assert.Equal(t, corsHandler.Origin, w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "Origin", w.Header().Get("Vary"))
 	assert.ElementsMatch(t, []string{
 		"OPTIONS",
 		"GET",
 		"PUT",
 	}, strings.Split(w.Header().Get("Access-Control-Allow-Methods"), ", "))
 	assert.Equal(t, "true", w.Header().Get("Access-Control-Allow-Credentials"))
-	assert.Equal(t, "X-Personal-One,X-Personal-Two", w.Header().Get("Access-Control-Allow-Headers"))
+	assert.Equal(t, "content-type, x-personal-one", w.Header().Get("Access-Control-Allow-Headers"))
 	assert.Equal(t, "1500", w.Header().Get("Access-Control-Max-Age"))
+	_, ok := w.HeaderMap["Access-Control-Expose-Headers"]
+	assert.False(t, ok)
+
+	// real request expose headers
+	req = httptest.NewRequest(http.MethodGet, "/foo", nil)
+	req.Header.Set("Origin", corsHandler.Origin)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, corsHandler.Origin, w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "true", w.Header().Get("Access-Control-Allow-Credentials"))
+	assert.Equal(t, "X-Personal-Two, X-Personal-Three", w.Header().Get("Access-Control-Expose-Headers"))
 }
 
 func TestNewCORS_LoadMethodsFromRouter(t *testing.T) {
@@ -114,13 +193,12 @@ func TestNewCORS_LoadMethodsFromRouter(t *testing.T) {
 		return http.StatusOK, nil
 	})
 
-	req := httptest.NewRequest(http.MethodOptions, "/foo", nil)
+	req := newPreflightRequest("/foo", "https://www.foodora.com", "PUT")
 	w := httptest.NewRecorder()
 	router.ServeHTTP(w, req)
 
 	assert.Equal(t, corsHandler.Origin, w.Header().Get("Access-Control-Allow-Origin"))
 	assert.ElementsMatch(t, []string{
-		"OPTIONS",
 		"GET",
 		"PUT",
 	}, strings.Split(w.Header().Get("Access-Control-Allow-Methods"), ", "))
@@ -130,27 +208,41 @@ func TestNewCORS_LoadMethodsFromRouter(t *testing.T) {
 	assert.False(t, ok)
 	_, ok = w.HeaderMap["Access-Control-Max-Age"]
 	assert.False(t, ok)
+	_, ok = w.HeaderMap["Vary"]
+	assert.False(t, ok)
 }
 
-func TestNewCORS_WithCredentialsDisabled(t *testing.T) {
+func TestNewCORS_WithCredentialsRequireOrigins(t *testing.T) {
 	corsHandler := fdhandler.NewCORS()
-	corsHandler.MaxAge = 0
+	corsHandler.Credentials = true
 
 	router := fdhttp.NewRouter()
 	router.Register(corsHandler)
+	router.StdGET("/foo", func(w http.ResponseWriter, req *http.Request) {})
 
-	req := httptest.NewRequest(http.MethodOptions, "/foo", nil)
+	// all origins are not accepted with credentials
+	req := newPreflightRequest("/foo", "https://evil.com", "GET")
 	w := httptest.NewRecorder()
 	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusForbidden, w.Code)
 
-	assert.Equal(t, fdhandler.CORSOriginAll, w.Header().Get("Access-Control-Allow-Origin"))
-	assert.Equal(t, "OPTIONS", w.Header().Get("Access-Control-Allow-Methods"))
-	_, ok := w.HeaderMap["Access-Control-Allow-Credentials"]
+	req = httptest.NewRequest(http.MethodGet, "/foo", nil)
+	req.Header.Set("Origin", "https://evil.com")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	_, ok := w.HeaderMap["Access-Control-Allow-Origin"]
 	assert.False(t, ok)
-	_, ok = w.HeaderMap["Access-Control-Allow-Headers"]
-	assert.False(t, ok)
-	_, ok = w.HeaderMap["Access-Control-Max-Age"]
+	_, ok = w.HeaderMap["Access-Control-Allow-Credentials"]
 	assert.False(t, ok)
+
+	corsHandler.AllowOrigins = []string{fdhandler.CORSOriginAll, "https://*.foodora.com"}
+	req = newPreflightRequest("/foo", "https://www.foodora.com", "GET")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, "https://www.foodora.com", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "Origin", w.Header().Get("Vary"))
+	assert.Equal(t, "true", w.Header().Get("Access-Control-Allow-Credentials"))
 }
 
 func TestNewCORS_SubRouterMethodsAreReturned(t *testing.T) {
@@ -166,19 +258,55 @@ func TestNewCORS_SubRouterMethodsAreReturned(t *testing.T) {
 	subrouter := router.SubRouter()
 	subrouter.Prefix = "/foo"
 	subrouter.StdPOST("/bar", func(w http.ResponseWriter, req *http.Request) {})
-	subrouter.DELETE("/bar", func(ctx context.Context) (int, interface{}) {
+	subrouter.DELETE("/bar/:id", func(ctx context.Context) (int, interface{}) {
 		return http.StatusOK, nil
 	})
 
-	req := httptest.NewRequest(http.MethodOptions, "/foo", nil)
-	w := httptest.NewRecorder()
-	router.ServeHTTP(w, req)
+	methodsByPath := map[string][]string{
+		"/foo":       {"GET", "PUT"},
+		"/foo/bar":   {"POST"},
+		"/foo/bar/1": {"DELETE"},
+	}
 
-	assert.ElementsMatch(t, []string{
-		"OPTIONS",
-		"GET",
-		"PUT",
-		"POST",
-		"DELETE",
-	}, strings.Split(w.Header().Get("Access-Control-Allow-Methods"), ", "))
+	for path, methods := range methodsByPath {
+		req := newPreflightRequest(path, "https://www.foodora.com", methods[0])
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.ElementsMatch(t, methods, strings.Split(w.Header().Get("Access-Control-Allow-Methods"), ", "), path)
+	}
+}
+
+func TestNewCORS_RejectPreflight(t *testing.T) {
+	corsHandler := fdhandler.NewCORS()
+	corsHandler.AllowOrigins = []string{"https://*.foodora.com"}
+
+	router := fdhttp.NewRouter()
+	router.Register(corsHandler)
+	router.GET("/foo", func(ctx context.Context) (int, interface{}) {
+		return http.StatusOK, nil
+	})
+
+	cases := map[string]*http.Request{
+		"cors_origin_not_allowed": newPreflightRequest("/foo", "https://evil.com", "GET"),
+		"cors_method_not_allowed": newPreflightRequest("/foo", "https://www.foodora.com", "DELETE"),
+		"cors_header_not_allowed": newPreflightRequest("/foo", "https://www.foodora.com", "GET", "Content-Type", "X-Custom"),
+	}
+
+	for code, req := range cases {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusForbidden, w.Code, code)
+		assert.Contains(t, w.Body.String(), code)
+		for k := range w.HeaderMap {
+			assert.False(t, strings.HasPrefix(k, "Access-Control-"), k)
+		}
+	}
+
+	// accepted when everything is allowed
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, newPreflightRequest("/foo", "https://www.foodora.com", "GET", "Content-Type"))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "https://www.foodora.com", w.Header().Get("Access-Control-Allow-Origin"))
 }
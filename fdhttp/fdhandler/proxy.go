@@ -0,0 +1,297 @@
+package fdhandler
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/foodora/go-ranger/fdhttp"
+	"github.com/foodora/go-ranger/fdhttp/fdmiddleware"
+)
+
+// ProxyDefaultMethods is the list of methods forwarded when ProxyRoute
+// doesn't specify them. OPTIONS is not included to not conflict with CORS.
+var ProxyDefaultMethods = []string{
+	http.MethodGet,
+	http.MethodHead,
+	http.MethodPost,
+	http.MethodPut,
+	http.MethodPatch,
+	http.MethodDelete,
+}
+
+var _ fdhttp.Handler = &Proxy{}
+
+// Proxy forward routes to upstreams, sending requests through the
+// middlewares of its client, like retries or circuit breaker:
+//  proxy := fdhandler.NewProxy(client)
+//  route, err := proxy.Route("/legacy/*path", "http://legacy-service/v1")
+//  route.StripPrefix = "/legacy"
+//  router.Register(proxy)
+// Redirects are sent to the caller, unless the client has a CheckRedirect.
+// Request and response bodies are streamed without being buffered, and
+// websocket connections are upgraded using client.BaseTransport() because
+// middlewares cannot wrap upgraded connections.
+type Proxy struct {
+	client *fdhttp.ClientImpl
+	routes []*ProxyRoute
+
+	// TrustForwardHeaders keep X-Forwarded-* headers sent by the client,
+	// enable it only behind a load balancer that sets them.
+	TrustForwardHeaders bool
+	// FlushInterval is how often the response is flushed to the client while
+	// it's copied, negative flushes after each write. By default 100ms.
+	FlushInterval time.Duration
+	// Timeout limit the wait for upstream response headers, the body is not
+	// limited so streams can be proxied. By default the client Timeout.
+	Timeout time.Duration
+	// ErrorHandler respond when upstream cannot be reached, by default
+	// ProxyErrorHandler. Replace it to log err.
+	ErrorHandler func(w http.ResponseWriter, req *http.Request, err error)
+}
+
+// ProxyRoute is a path forwarded to Upstream.
+type ProxyRoute struct {
+	// Path registered in the router, use a catch-all parameter to forward
+	// all paths below it, like "/legacy/*path".
+	Path     string
+	Upstream *url.URL
+	// Methods forwarded, by default ProxyDefaultMethods.
+	Methods []string
+	// StripPrefix is removed from the path before it's appended to
+	// Upstream path, and sent as X-Forwarded-Prefix.
+	StripPrefix string
+	// RewritePath change the path after StripPrefix.
+	RewritePath func(path string) string
+	// PreserveHost send Host header received instead of Upstream host.
+	PreserveHost bool
+
+	// SetRequestHeader is added to the upstream request.
+	SetRequestHeader http.Header
+	// RemoveRequestHeader is not sent to upstream.
+	RemoveRequestHeader []string
+	// SetResponseHeader is added to the upstream response.
+	SetResponseHeader http.Header
+	// RemoveResponseHeader is not sent to the client.
+	RemoveResponseHeader []string
+}
+
+// NewProxy return a Proxy sending requests with client, if client is nil
+// fdhttp.NewClient() is used.
+func NewProxy(client *fdhttp.ClientImpl) *Proxy {
+	if client == nil {
+		client = fdhttp.NewClient()
+	}
+
+	return &Proxy{
+		client:        client,
+		FlushInterval: 100 * time.Millisecond,
+		Timeout:       client.Timeout,
+		ErrorHandler:  ProxyErrorHandler,
+	}
+}
+
+// Route forward path to upstream.
+func (p *Proxy) Route(path, upstream string) (*ProxyRoute, error) {
+	u, err := url.Parse(upstream)
+	if err != nil {
+		return nil, err
+	}
+
+	route := &ProxyRoute{
+		Path:     path,
+		Upstream: u,
+	}
+	p.routes = append(p.routes, route)
+
+	return route, nil
+}
+
+// Init implements fdhttp.Handler
+func (p *Proxy) Init(router *fdhttp.Router) {
+	for _, route := range p.routes {
+		handler := p.reverseProxy(route).ServeHTTP
+
+		methods := route.Methods
+		if len(methods) == 0 {
+			methods = ProxyDefaultMethods
+		}
+		for _, method := range methods {
+			router.StreamHandler(method, route.Path, handler)
+		}
+	}
+}
+
+func (p *Proxy) reverseProxy(route *ProxyRoute) *httputil.ReverseProxy {
+	transport := fdmiddleware.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if req.Header.Get("Upgrade") != "" {
+			return p.client.BaseTransport().RoundTrip(req)
+		}
+
+		// client requests cannot have RequestURI
+		r := *req
+		r.RequestURI = ""
+		return p.send(&r)
+	})
+
+	return &httputil.ReverseProxy{
+		Director: func(req *http.Request) {
+			p.direct(route, req)
+		},
+		Transport:     transport,
+		FlushInterval: p.FlushInterval,
+		ModifyResponse: func(resp *http.Response) error {
+			for _, name := range route.RemoveResponseHeader {
+				resp.Header.Del(name)
+			}
+			for name, values := range route.SetResponseHeader {
+				resp.Header[http.CanonicalHeaderKey(name)] = values
+			}
+			return nil
+		},
+		ErrorHandler: p.ErrorHandler,
+	}
+}
+
+// send req through client middlewares, limiting only the wait for response
+// headers by Timeout.
+func (p *Proxy) send(req *http.Request) (*http.Response, error) {
+	client := &http.Client{
+		Transport:     p.client.Transport,
+		Jar:           p.client.Jar,
+		CheckRedirect: p.client.CheckRedirect,
+	}
+	if client.CheckRedirect == nil {
+		client.CheckRedirect = func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		}
+	}
+
+	if p.Timeout <= 0 {
+		return client.Do(req)
+	}
+
+	ctx, cancel := context.WithCancel(req.Context())
+	timer := time.AfterFunc(p.Timeout, cancel)
+
+	resp, err := client.Do(req.WithContext(ctx))
+	if !timer.Stop() {
+		if err == nil {
+			resp.Body.Close()
+		}
+		cancel()
+		return nil, context.DeadlineExceeded
+	}
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// cancelBody cancel the request context when body is closed.
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// direct change req to be sent to route upstream.
+func (p *Proxy) direct(route *ProxyRoute, req *http.Request) {
+	host, proto := req.Host, "http"
+	if req.TLS != nil {
+		proto = "https"
+	}
+
+	if !p.TrustForwardHeaders {
+		for _, name := range []string{"Forwarded", "X-Forwarded-For", "X-Forwarded-Host", "X-Forwarded-Proto", "X-Forwarded-Prefix"} {
+			req.Header.Del(name)
+		}
+	}
+	if req.Header.Get("X-Forwarded-Host") == "" {
+		req.Header.Set("X-Forwarded-Host", host)
+	}
+	if req.Header.Get("X-Forwarded-Proto") == "" {
+		req.Header.Set("X-Forwarded-Proto", proto)
+	}
+	if route.StripPrefix != "" {
+		req.Header.Set("X-Forwarded-Prefix", route.StripPrefix)
+	}
+	// X-Forwarded-For is appended by httputil.ReverseProxy
+
+	path := strings.TrimPrefix(req.URL.Path, route.StripPrefix)
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	if route.RewritePath != nil {
+		path = route.RewritePath(path)
+	}
+
+	upstream := route.Upstream
+	req.URL.Scheme = upstream.Scheme
+	req.URL.Host = upstream.Host
+	req.URL.Path = strings.TrimSuffix(upstream.Path, "/") + path
+	req.URL.RawPath = ""
+	if upstream.RawQuery != "" && req.URL.RawQuery != "" {
+		req.URL.RawQuery = upstream.RawQuery + "&" + req.URL.RawQuery
+	} else if upstream.RawQuery != "" {
+		req.URL.RawQuery = upstream.RawQuery
+	}
+	if !route.PreserveHost {
+		req.Host = upstream.Host
+	}
+
+	for _, name := range route.RemoveRequestHeader {
+		req.Header.Del(name)
+	}
+	for name, values := range route.SetRequestHeader {
+		req.Header[http.CanonicalHeaderKey(name)] = values
+	}
+
+	// client metrics are reported by the local route
+	*req = *req.WithContext(fdmiddleware.SetRouteTemplate(req.Context(), route.Path))
+}
+
+// ProxyErrorHandler respond 503 when a client middleware rejected the
+// request, 504 on timeout and 502 for other errors. The message doesn't
+// include err to not expose upstream addresses.
+func ProxyErrorHandler(w http.ResponseWriter, req *http.Request, err error) {
+	status, code := http.StatusBadGateway, "bad_gateway"
+
+	if urlErr, ok := err.(*url.Error); ok {
+		err = urlErr.Err
+	}
+
+	switch err.(type) {
+	case *fdmiddleware.RateLimitError:
+		status, code = http.StatusServiceUnavailable, "service_unavailable"
+	case net.Error:
+		if err.(net.Error).Timeout() {
+			status, code = http.StatusGatewayTimeout, "gateway_timeout"
+		}
+	}
+
+	switch err {
+	case fdmiddleware.ErrCircuitOpen, fdmiddleware.ErrBulkheadFull:
+		status, code = http.StatusServiceUnavailable, "service_unavailable"
+	case context.DeadlineExceeded:
+		status, code = http.StatusGatewayTimeout, "gateway_timeout"
+	}
+
+	fdhttp.ResponseJSON(w, status, &fdhttp.Error{
+		Code:    code,
+		Message: http.StatusText(status),
+	})
+}
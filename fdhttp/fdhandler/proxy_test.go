@@ -0,0 +1,335 @@
+package fdhandler_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/foodora/go-ranger/fdhttp"
+	"github.com/foodora/go-ranger/fdhttp/fdhandler"
+	"github.com/foodora/go-ranger/fdhttp/fdmiddleware"
+	"github.com/stretchr/testify/assert"
+)
+
+type echoRequest struct {
+	Host   string
+	Path   string
+	Query  string
+	Header http.Header
+	Body   string
+}
+
+func newEchoServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+		w.Header().Set("X-Powered-By", "legacy")
+		w.Header().Set("X-Upstream", "echo")
+		json.NewEncoder(w).Encode(echoRequest{
+			Host:   req.Host,
+			Path:   req.URL.Path,
+			Query:  req.URL.RawQuery,
+			Header: req.Header,
+			Body:   string(body),
+		})
+	}))
+}
+
+// newLogMiddleware wrap the response writer to check it supports flush and
+// hijack.
+func newLogMiddleware() *fdmiddleware.LogMiddleware {
+	m := fdmiddleware.NewLogMiddleware()
+	m.SetLoggerFunc(func(*fdmiddleware.LogRequest) {})
+	return m
+}
+
+// markBody wrap response bodies like logging or metrics middlewares do.
+func markBody(calls *int) fdmiddleware.ClientMiddleware {
+	return fdmiddleware.ClientMiddlewareFunc(func(next http.RoundTripper) http.RoundTripper {
+		return fdmiddleware.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			*calls++
+			resp, err := next.RoundTrip(req)
+			if err == nil {
+				resp.Body = ioutil.NopCloser(resp.Body)
+			}
+			return resp, err
+		})
+	})
+}
+
+func TestProxy(t *testing.T) {
+	upstream := newEchoServer()
+	defer upstream.Close()
+
+	var calls int
+	client := fdhttp.NewClient()
+	client.Use(markBody(&calls))
+
+	proxy := fdhandler.NewProxy(client)
+	route, err := proxy.Route("/legacy/*path", upstream.URL+"/v1?source=bff")
+	assert.NoError(t, err)
+	route.StripPrefix = "/legacy"
+	route.SetRequestHeader = http.Header{"X-Api-Key": {"k3y"}}
+	route.RemoveRequestHeader = []string{"Cookie"}
+	route.SetResponseHeader = http.Header{"Cache-Control": {"no-cache"}}
+	route.RemoveResponseHeader = []string{"X-Powered-By"}
+
+	router := fdhttp.NewRouter()
+	router.Register(proxy)
+	router.GET("/local", func(ctx context.Context) (int, interface{}) {
+		return http.StatusOK, "local"
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "http://bff.foodora.com/legacy/orders/10?page=2", strings.NewReader("status=paid"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Cookie", "session=1")
+	req.Header.Set("X-Forwarded-For", "1.1.1.1")
+	req.RemoteAddr = "10.0.0.1:1234"
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, "no-cache", w.Header().Get("Cache-Control"))
+	assert.Equal(t, "echo", w.Header().Get("X-Upstream"))
+	assert.Empty(t, w.Header().Get("X-Powered-By"))
+
+	var echo echoRequest
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&echo))
+
+	u, _ := url.Parse(upstream.URL)
+	assert.Equal(t, u.Host, echo.Host)
+	assert.Equal(t, "/v1/orders/10", echo.Path)
+	assert.Equal(t, "source=bff&page=2", echo.Query)
+	assert.Equal(t, "status=paid", echo.Body, "form body should not be consumed by router")
+	assert.Equal(t, "k3y", echo.Header.Get("X-Api-Key"))
+	assert.Empty(t, echo.Header.Get("Cookie"))
+	assert.Equal(t, "10.0.0.1", echo.Header.Get("X-Forwarded-For"), "client cannot spoof forwarded headers")
+	assert.Equal(t, "bff.foodora.com", echo.Header.Get("X-Forwarded-Host"))
+	assert.Equal(t, "http", echo.Header.Get("X-Forwarded-Proto"))
+	assert.Equal(t, "/legacy", echo.Header.Get("X-Forwarded-Prefix"))
+
+	// local endpoints keep working in the same router
+	req = httptest.NewRequest(http.MethodGet, "/local", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 1, calls)
+}
+
+func TestProxy_TrustForwardHeaders(t *testing.T) {
+	upstream := newEchoServer()
+	defer upstream.Close()
+
+	proxy := fdhandler.NewProxy(nil)
+	proxy.TrustForwardHeaders = true
+	route, _ := proxy.Route("/orders", upstream.URL)
+	route.PreserveHost = true
+	route.RewritePath = func(path string) string {
+		return "/api" + path
+	}
+
+	router := fdhttp.NewRouter()
+	router.Register(proxy)
+
+	req := httptest.NewRequest(http.MethodGet, "http://bff.foodora.com/orders", nil)
+	req.Header.Set("X-Forwarded-For", "1.1.1.1")
+	req.Header.Set("X-Forwarded-Proto", "https")
+	req.RemoteAddr = "10.0.0.1:1234"
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var echo echoRequest
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&echo))
+	assert.Equal(t, "bff.foodora.com", echo.Host)
+	assert.Equal(t, "/api/orders", echo.Path)
+	assert.Equal(t, "1.1.1.1, 10.0.0.1", echo.Header.Get("X-Forwarded-For"))
+	assert.Equal(t, "https", echo.Header.Get("X-Forwarded-Proto"))
+}
+
+func TestProxy_Errors(t *testing.T) {
+	upstream := newEchoServer()
+	upstream.Close()
+
+	client := fdhttp.NewClient()
+	proxy := fdhandler.NewProxy(client)
+	proxy.Route("/down", upstream.URL)
+	proxy.Route("/open", "http://open-circuit")
+
+	client.Use(fdmiddleware.ClientMiddlewareFunc(func(next http.RoundTripper) http.RoundTripper {
+		return fdmiddleware.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			if req.URL.Host == "open-circuit" {
+				return nil, fdmiddleware.ErrCircuitOpen
+			}
+			return next.RoundTrip(req)
+		})
+	}))
+
+	router := fdhttp.NewRouter()
+	router.Register(proxy)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/down", nil))
+	assert.Equal(t, http.StatusBadGateway, w.Code)
+	assert.Contains(t, w.Body.String(), `"code":"bad_gateway"`)
+	assert.NotContains(t, w.Body.String(), strings.TrimPrefix(upstream.URL, "http://"), "upstream address is not exposed")
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/open", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+}
+
+func TestProxy_TimeoutAndRedirect(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/slow":
+			select {
+			case <-req.Context().Done():
+			case <-time.After(time.Second):
+			}
+		case "/stream":
+			w.Write([]byte("first "))
+			w.(http.Flusher).Flush()
+			time.Sleep(100 * time.Millisecond)
+			w.Write([]byte("second"))
+		case "/moved":
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "1"})
+			http.Redirect(w, req, "/new", http.StatusSeeOther)
+		}
+	}))
+	defer upstream.Close()
+
+	client := fdhttp.NewClient()
+	client.Timeout = 50 * time.Millisecond
+
+	proxy := fdhandler.NewProxy(client)
+	proxy.Route("/*path", upstream.URL)
+
+	router := fdhttp.NewRouter()
+	router.Register(proxy)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/slow", nil))
+	assert.Equal(t, http.StatusGatewayTimeout, w.Code)
+	assert.Contains(t, w.Body.String(), `"message":"Gateway Timeout"`)
+
+	// timeout only limits the wait for headers
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/stream", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "first second", w.Body.String())
+
+	// redirects are sent to the caller
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/moved", nil))
+	assert.Equal(t, http.StatusSeeOther, w.Code)
+	assert.Equal(t, "/new", w.Header().Get("Location"))
+	assert.Contains(t, w.Header().Get("Set-Cookie"), "session=1")
+}
+
+func TestProxy_Streaming(t *testing.T) {
+	next := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: first\n\n")
+		w.(http.Flusher).Flush()
+		<-next
+		fmt.Fprint(w, "data: second\n\n")
+	}))
+	defer upstream.Close()
+
+	proxy := fdhandler.NewProxy(nil)
+	proxy.FlushInterval = -1
+	proxy.Route("/events", upstream.URL)
+
+	router := fdhttp.NewRouter()
+	router.Use(newLogMiddleware())
+	router.Register(proxy)
+
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/events")
+	if !assert.NoError(t, err) {
+		close(next)
+		return
+	}
+	defer resp.Body.Close()
+
+	reader := bufio.NewReader(resp.Body)
+	line, err := reader.ReadString('\n')
+	assert.NoError(t, err)
+	assert.Equal(t, "data: first\n", line, "first event arrives before upstream finishes")
+
+	close(next)
+	body, _ := ioutil.ReadAll(reader)
+	assert.Equal(t, "\ndata: second\n\n", string(body))
+}
+
+func TestProxy_WebSocket(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Upgrade") != "websocket" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n")
+		rw.Flush()
+
+		// echo lines back
+		line, _ := rw.ReadString('\n')
+		rw.WriteString("echo " + line)
+		rw.Flush()
+	}))
+	defer upstream.Close()
+
+	var calls int
+	client := fdhttp.NewClient()
+	client.Use(markBody(&calls))
+
+	proxy := fdhandler.NewProxy(client)
+	proxy.Route("/ws", upstream.URL)
+
+	router := fdhttp.NewRouter()
+	router.Use(newLogMiddleware())
+	router.Register(proxy)
+
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	conn, err := net.Dial("tcp", strings.TrimPrefix(server.URL, "http://"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	fmt.Fprint(conn, "GET /ws HTTP/1.1\r\nHost: bff\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n")
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+
+	fmt.Fprint(conn, "ping\n")
+	line, err := reader.ReadString('\n')
+	assert.NoError(t, err)
+	assert.Equal(t, "echo ping\n", line)
+	assert.Equal(t, 0, calls, "upgrades skip client middlewares")
+}
@@ -0,0 +1,283 @@
+package fdhttptest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/foodora/go-ranger/fdhttp/fdmiddleware"
+)
+
+// CassetteMode define if requests are sent and saved or served from the file.
+type CassetteMode int
+
+const (
+	// CassetteReplay serve responses saved in the cassette file.
+	CassetteReplay CassetteMode = iota
+	// CassetteRecord send requests and save them in the cassette file.
+	CassetteRecord
+)
+
+// RedactedValue replace secrets in cassette files.
+const RedactedValue = fdmiddleware.RedactedValue
+
+// UnmatchedRequestError is returned in strict mode when there's no
+// interaction recorded for a request.
+type UnmatchedRequestError struct {
+	Method string
+	URL    string
+}
+
+func (e *UnmatchedRequestError) Error() string {
+	return fmt.Sprintf("fdhttptest: no interaction recorded for %s %s", e.Method, e.URL)
+}
+
+// CassetteRequest is a request saved in the cassette.
+type CassetteRequest struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Header http.Header `json:"header,omitempty"`
+	Body   string      `json:"body,omitempty"`
+}
+
+// CassetteResponse is a response saved in the cassette.
+type CassetteResponse struct {
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       string      `json:"body,omitempty"`
+}
+
+// Interaction is a pair of request and response.
+type Interaction struct {
+	Request  CassetteRequest  `json:"request"`
+	Response CassetteResponse `json:"response"`
+}
+
+// CassetteMatcher return true if req should be answered with recorded.
+type CassetteMatcher func(req, recorded *CassetteRequest) bool
+
+// DefaultCassetteMatcher match method, url and body.
+func DefaultCassetteMatcher(req, recorded *CassetteRequest) bool {
+	return req.Method == recorded.Method &&
+		req.URL == recorded.URL &&
+		req.Body == recorded.Body
+}
+
+// Cassette is a client middleware to record http calls into a file and replay
+// them later, with that your tests don't depend on external services:
+//  cassette, err := fdhttptest.NewCassette("testdata/partner.json", fdhttptest.CassetteReplay)
+//  client := fdhttp.NewClient()
+//  client.Use(cassette)
+// Secrets are redacted before saving, requests are redacted as well before
+// matching, so they still match the recorded ones.
+type Cassette struct {
+	path string
+	mode CassetteMode
+
+	// Matcher choose which interaction answer a request, by default
+	// DefaultCassetteMatcher.
+	Matcher CassetteMatcher
+	// Strict fail requests without a recorded interaction, otherwise they're
+	// sent to the real server.
+	Strict bool
+	// RedactHeaders have values replaced in requests and responses, by
+	// default Authorization, Cookie and Set-Cookie.
+	RedactHeaders []string
+	// RedactQuery have values replaced in the url.
+	RedactQuery []string
+	// RedactBodyFields have values replaced in json bodies, in any level,
+	// and in form bodies.
+	RedactBodyFields []string
+
+	mu           sync.Mutex
+	interactions []*Interaction
+	used         []bool
+}
+
+// NewCassette create a cassette saved in path. In replay mode the file
+// need to exist, in record mode it's overwritten.
+func NewCassette(path string, mode CassetteMode) (*Cassette, error) {
+	c := &Cassette{
+		path:          path,
+		mode:          mode,
+		Matcher:       DefaultCassetteMatcher,
+		RedactHeaders: append([]string(nil), fdmiddleware.DefaultRedactHeaders...),
+	}
+
+	if mode == CassetteReplay {
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := json.Unmarshal(content, &c.interactions); err != nil {
+			return nil, fmt.Errorf("fdhttptest: invalid cassette %s: %s", path, err)
+		}
+		c.used = make([]bool, len(c.interactions))
+	}
+
+	return c, nil
+}
+
+// Interactions return what was recorded or loaded.
+func (c *Cassette) Interactions() []Interaction {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	interactions := make([]Interaction, len(c.interactions))
+	for i, in := range c.interactions {
+		interactions[i] = *in
+	}
+	return interactions
+}
+
+// Wrap will be called for each request
+func (c *Cassette) Wrap(next http.RoundTripper) http.RoundTripper {
+	return fdmiddleware.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		req, body, err := readRequestBody(req)
+		if err != nil {
+			return nil, err
+		}
+
+		cassetteReq := c.cassetteRequest(req, body)
+
+		if c.mode == CassetteReplay {
+			if in := c.match(cassetteReq); in != nil {
+				return in.Response.httpResponse(req), nil
+			}
+
+			if c.Strict {
+				return nil, &UnmatchedRequestError{Method: req.Method, URL: cassetteReq.URL}
+			}
+			return next.RoundTrip(req)
+		}
+
+		resp, err := next.RoundTrip(req)
+		if err != nil {
+			return nil, err
+		}
+
+		respBody, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		resp.Body = ioutil.NopCloser(bytes.NewReader(respBody))
+
+		err = c.record(&Interaction{
+			Request: *cassetteReq,
+			Response: CassetteResponse{
+				StatusCode: resp.StatusCode,
+				Header:     c.redactor().Header(resp.Header),
+				Body:       c.redactor().Body(resp.Header, respBody),
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		return resp, nil
+	})
+}
+
+// match return the first interaction not used yet, or the last one
+// matched if all of them were used.
+func (c *Cassette) match(req *CassetteRequest) *Interaction {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var found *Interaction
+	for i, in := range c.interactions {
+		if !c.Matcher(req, &in.Request) {
+			continue
+		}
+
+		found = in
+		if !c.used[i] {
+			c.used[i] = true
+			return in
+		}
+	}
+
+	return found
+}
+
+// record add the interaction and save the cassette.
+func (c *Cassette) record(in *Interaction) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.interactions = append(c.interactions, in)
+
+	content, err := json.MarshalIndent(c.interactions, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(c.path), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(c.path, content, 0644)
+}
+
+func (c *Cassette) cassetteRequest(req *http.Request, body []byte) *CassetteRequest {
+	redactor := c.redactor()
+
+	return &CassetteRequest{
+		Method: req.Method,
+		URL:    redactor.URL(req.URL),
+		Header: redactor.Header(req.Header),
+		Body:   redactor.Body(req.Header, body),
+	}
+}
+
+func (c *Cassette) redactor() *fdmiddleware.Redactor {
+	return &fdmiddleware.Redactor{
+		Headers:    c.RedactHeaders,
+		Query:      c.RedactQuery,
+		BodyFields: c.RedactBodyFields,
+	}
+}
+
+func (r *CassetteResponse) httpResponse(req *http.Request) *http.Response {
+	header := make(http.Header, len(r.Header))
+	for k, v := range r.Header {
+		header[k] = append([]string(nil), v...)
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", r.StatusCode, http.StatusText(r.StatusCode)),
+		StatusCode:    r.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewBufferString(r.Body)),
+		ContentLength: int64(len(r.Body)),
+		Request:       req,
+	}
+}
+
+// readRequestBody read the body and return a copy of req that can still
+// be sent with it.
+func readRequestBody(req *http.Request) (*http.Request, []byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return req, nil, nil
+	}
+
+	body, err := ioutil.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	r := new(http.Request)
+	*r = *req
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	return r, body, nil
+}
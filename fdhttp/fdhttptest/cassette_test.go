@@ -0,0 +1,153 @@
+package fdhttptest_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/foodora/go-ranger/fdhttp"
+	"github.com/foodora/go-ranger/fdhttp/fdhttptest"
+	"github.com/stretchr/testify/assert"
+)
+
+func newPartnerServer(calls *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		n := atomic.AddInt32(calls, 1)
+		body, _ := ioutil.ReadAll(req.Body)
+
+		w.Header().Set("Set-Cookie", "session=secret")
+		w.Header().Set("Content-Type", "application/json")
+		if req.URL.Path == "/login" {
+			w.Write([]byte(`{"token":"secret","user":{"name":"foo"}}`))
+			return
+		}
+		w.Write([]byte(`{"call":` + fmt.Sprint(n) + `,"body":` + string(body) + `}`))
+	}))
+}
+
+func doRequest(t *testing.T, client *fdhttp.ClientImpl, method, url, body string) (*http.Response, string) {
+	req, _ := http.NewRequest(method, url, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer secret")
+
+	resp, err := client.Do(req)
+	if !assert.NoError(t, err) {
+		return nil, ""
+	}
+	defer resp.Body.Close()
+
+	content, _ := ioutil.ReadAll(resp.Body)
+	return resp, string(content)
+}
+
+func TestCassette_RecordAndReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fdhttptest")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "partner.json")
+
+	var calls int32
+	server := newPartnerServer(&calls)
+
+	recorder, err := fdhttptest.NewCassette(path, fdhttptest.CassetteRecord)
+	assert.NoError(t, err)
+	recorder.RedactQuery = []string{"api_key"}
+	recorder.RedactBodyFields = []string{"token", "password"}
+
+	client := fdhttp.NewClient()
+	client.Use(recorder)
+
+	_, body := doRequest(t, client, http.MethodPost, server.URL+"/login?api_key=k3y", `{"user":"foo","password":"hunter2"}`)
+	assert.Equal(t, `{"token":"secret","user":{"name":"foo"}}`, body, "real response is not redacted")
+	doRequest(t, client, http.MethodPost, server.URL+"/orders", `{"id":1}`)
+	doRequest(t, client, http.MethodPost, server.URL+"/orders", `{"id":1}`)
+	server.Close()
+
+	content, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(content), "secret")
+	assert.NotContains(t, string(content), "hunter2")
+	assert.NotContains(t, string(content), "k3y")
+	assert.Len(t, recorder.Interactions(), 3)
+
+	// server is closed, everything come from the cassette
+	player, err := fdhttptest.NewCassette(path, fdhttptest.CassetteReplay)
+	assert.NoError(t, err)
+	player.RedactQuery = []string{"api_key"}
+	player.RedactBodyFields = []string{"token", "password"}
+	player.Strict = true
+
+	client = fdhttp.NewClient()
+	client.Use(player)
+
+	resp, body := doRequest(t, client, http.MethodPost, server.URL+"/login?api_key=456", `{"user":"foo","password":"456"}`)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+	assert.Equal(t, fdhttptest.RedactedValue, resp.Header.Get("Set-Cookie"))
+	assert.JSONEq(t, `{"token":"REDACTED","user":{"name":"foo"}}`, body)
+
+	// same request are answered in order, the last one is repeated
+	_, body = doRequest(t, client, http.MethodPost, server.URL+"/orders", `{"id":1}`)
+	assert.JSONEq(t, `{"call":2,"body":{"id":1}}`, body)
+	_, body = doRequest(t, client, http.MethodPost, server.URL+"/orders", `{"id":1}`)
+	assert.JSONEq(t, `{"call":3,"body":{"id":1}}`, body)
+	_, body = doRequest(t, client, http.MethodPost, server.URL+"/orders", `{"id":1}`)
+	assert.JSONEq(t, `{"call":3,"body":{"id":1}}`, body)
+
+	// strict mode fail unmatched requests
+	req, _ := http.NewRequest(http.MethodPost, server.URL+"/orders", strings.NewReader(`{"id":2}`))
+	_, err = client.Do(req)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "no interaction recorded for POST "+server.URL+"/orders")
+	}
+}
+
+func TestCassette_ReplayNotStrict(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fdhttptest")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "partner.json")
+
+	var calls int32
+	server := newPartnerServer(&calls)
+	defer server.Close()
+
+	err = ioutil.WriteFile(path, []byte(`[{
+		"request": {"method": "GET", "url": "`+server.URL+`/orders/1"},
+		"response": {"status_code": 404, "body": "{\"code\":\"not_found\"}"}
+	}]`), 0644)
+	assert.NoError(t, err)
+
+	player, err := fdhttptest.NewCassette(path, fdhttptest.CassetteReplay)
+	assert.NoError(t, err)
+
+	client := fdhttp.NewClient()
+	client.Use(player)
+
+	resp, body := doRequest(t, client, http.MethodGet, server.URL+"/orders/1", "")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	assert.Equal(t, `{"code":"not_found"}`, body)
+	assert.Equal(t, int32(0), atomic.LoadInt32(&calls))
+
+	// unmatched request is sent to the server
+	resp, _ = doRequest(t, client, http.MethodGet, server.URL+"/orders/2", "")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+
+	// custom matcher ignoring the host
+	player.Matcher = func(req, recorded *fdhttptest.CassetteRequest) bool {
+		return strings.HasSuffix(recorded.URL, "/orders/1") && strings.HasSuffix(req.URL, "/orders/1")
+	}
+	resp, _ = doRequest(t, client, http.MethodGet, "http://partner.example/orders/1", "")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestCassette_ReplayMissingFile(t *testing.T) {
+	_, err := fdhttptest.NewCassette("testdata/missing.json", fdhttptest.CassetteReplay)
+	assert.Error(t, err)
+}
@@ -0,0 +1,3 @@
+// Package with helpers to test your fdhttp.Router and fdhttp.EndpointFunc
+// without starting a server.
+package fdhttptest
@@ -0,0 +1,46 @@
+package fdhttptest
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	// GoldenDir is where golden files are stored, relative to the package
+	// being tested.
+	GoldenDir = "testdata"
+	// UpdateGolden write the current response into golden files instead of
+	// comparing them, by default it's enabled with the env var UPDATE_GOLDEN:
+	//  UPDATE_GOLDEN=1 go test ./...
+	UpdateGolden = os.Getenv("UPDATE_GOLDEN") != ""
+)
+
+// AssertGolden compare status code and body with the file
+// GoldenDir/name.golden. Json bodies are indented to make diffs readable.
+func (r *Response) AssertGolden(name string) *Response {
+	r.t.Helper()
+
+	actual := fmt.Sprintf("%d\n%s\n", r.Code, r.indentBody())
+	filename := filepath.Join(GoldenDir, name+".golden")
+
+	if UpdateGolden {
+		err := os.MkdirAll(filepath.Dir(filename), 0755)
+		if err == nil {
+			err = ioutil.WriteFile(filename, []byte(actual), 0644)
+		}
+		assert.NoError(r.t, err, "cannot update golden file")
+		return r
+	}
+
+	expected, err := ioutil.ReadFile(filename)
+	if !assert.NoError(r.t, err, "cannot read golden file, run tests with UPDATE_GOLDEN=1 to create it") {
+		return r
+	}
+
+	assert.Equal(r.t, string(expected), actual, "golden file %s", filename)
+	return r
+}
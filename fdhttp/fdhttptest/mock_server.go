@@ -0,0 +1,396 @@
+package fdhttptest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/foodora/go-ranger/fdhttp"
+)
+
+// Fault simulate a broken server.
+type Fault int
+
+const (
+	// FaultNone send the response normally.
+	FaultNone Fault = iota
+	// FaultCloseConnection close the connection without sending anything.
+	FaultCloseConnection
+	// FaultPartialBody send headers and part of the body, then close the
+	// connection.
+	FaultPartialBody
+)
+
+// MockResponse is sent when an expectation is matched. Body can be a string
+// or []byte sent as is, everything else is sent as json.
+type MockResponse struct {
+	StatusCode int
+	Header     http.Header
+	Body       interface{}
+	// Delay wait before sending the response, or until client gives up.
+	Delay time.Duration
+	Fault Fault
+}
+
+// MockServer is a http server that you program with the calls you expect,
+// use it to test how your client behave when dependencies fail:
+//  server := fdhttptest.NewMockServer(t)
+//  defer server.Close()
+//
+//  server.Expect("GET", "/orders/:id").Times(2).
+//      RespondFault(fdhttptest.FaultCloseConnection).
+//      Respond(http.StatusServiceUnavailable, nil)
+//  server.Expect("GET", "/orders/:id").Respond(http.StatusOK, order)
+//
+//  // call server.URL
+//
+//  server.Verify()
+type MockServer struct {
+	*httptest.Server
+
+	t testing.TB
+
+	mu           sync.Mutex
+	router       *fdhttp.Router
+	expectations []*Expectation
+	unexpected   []string
+}
+
+// NewMockServer start a server, you need to call Close() at the end.
+func NewMockServer(t testing.TB) *MockServer {
+	s := &MockServer{t: t}
+	s.router = s.newRouter(nil)
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+
+	return s
+}
+
+// Expect register a call to path, path is matched by fdhttp.Router so it can
+// have the same params, and patterns that conflict there like "/orders/active"
+// and "/orders/:id" cannot be used together. Expectations of the same method
+// and path are checked in the order they're registered. They can be
+// registered while the server receives requests.
+func (s *MockServer) Expect(method, path string) *Expectation {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e := &Expectation{
+		server: s,
+		method: method,
+		path:   path,
+	}
+
+	// routes cannot be added to a router that is serving, a new one
+	// replaces it and requests already received finish with the old one
+	s.router = s.newRouter(append(s.expectations, e))
+	s.expectations = append(s.expectations, e)
+
+	return e
+}
+
+// newRouter return a router with a route for each method and path of
+// expectations.
+func (s *MockServer) newRouter(expectations []*Expectation) *fdhttp.Router {
+	router := fdhttp.NewRouter()
+	router.NotFoundHandler = s.unexpectedRequest
+	router.MethodNotAllowedHandler = s.unexpectedRequest
+
+	routes := map[string]bool{}
+	for _, e := range expectations {
+		key := e.method + " " + e.path
+		if routes[key] {
+			continue
+		}
+		routes[key] = true
+
+		method, path := e.method, e.path
+		// streams keep the body untouched to be matched
+		router.StreamHandler(method, path, func(w http.ResponseWriter, req *http.Request) {
+			s.serve(w, req, method, path)
+		})
+	}
+
+	router.Init()
+	return router
+}
+
+// Verify fail the test if some expectation was not met or unexpected
+// requests were received.
+func (s *MockServer) Verify() {
+	s.t.Helper()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, e := range s.expectations {
+		if err := e.verify(); err != nil {
+			s.t.Errorf("fdhttptest: %s", err)
+		}
+	}
+
+	for _, req := range s.unexpected {
+		s.t.Errorf("fdhttptest: unexpected request %s", req)
+	}
+}
+
+func (s *MockServer) serveHTTP(w http.ResponseWriter, req *http.Request) {
+	s.mu.Lock()
+	router := s.router
+	s.mu.Unlock()
+
+	router.ServeHTTP(w, req)
+}
+
+// serve respond a request matched by the route of method and path.
+func (s *MockServer) serve(w http.ResponseWriter, req *http.Request, method, path string) {
+	body, _ := ioutil.ReadAll(req.Body)
+
+	s.mu.Lock()
+	var resp *MockResponse
+	for _, e := range s.expectations {
+		if e.method != method || e.path != path || !e.match(req, body) {
+			continue
+		}
+
+		resp = e.nextResponse()
+		break
+	}
+	s.mu.Unlock()
+
+	if resp == nil {
+		s.unexpectedRequest(w, req)
+		return
+	}
+
+	writeMockResponse(w, req, resp)
+}
+
+func (s *MockServer) unexpectedRequest(w http.ResponseWriter, req *http.Request) {
+	s.mu.Lock()
+	s.unexpected = append(s.unexpected, req.Method+" "+req.URL.String())
+	s.mu.Unlock()
+
+	fdhttp.ResponseJSON(w, http.StatusNotImplemented, &fdhttp.Error{
+		Code:    "unexpected_request",
+		Message: fmt.Sprintf("No expectation for %s %s", req.Method, req.URL),
+	})
+}
+
+// Expectation is a call that MockServer should receive.
+type Expectation struct {
+	server *MockServer
+	method string
+	path   string
+
+	// times <= 0 means at least once, unless anyTimes is set
+	times    int
+	anyTimes bool
+	calls    int
+
+	matchers  []func(req *http.Request, body []byte) bool
+	responses []*MockResponse
+}
+
+// Times define how many calls are expected, after that the next expectation
+// that matches will be used. By default it's at least once.
+func (e *Expectation) Times(n int) *Expectation {
+	e.server.mu.Lock()
+	e.times = n
+	e.server.mu.Unlock()
+	return e
+}
+
+// AnyTimes accept any number of calls, including none.
+func (e *Expectation) AnyTimes() *Expectation {
+	e.server.mu.Lock()
+	e.anyTimes = true
+	e.server.mu.Unlock()
+	return e
+}
+
+// WithHeader only match requests with this header.
+func (e *Expectation) WithHeader(key, value string) *Expectation {
+	return e.WithMatcher(func(req *http.Request, body []byte) bool {
+		return req.Header.Get(key) == value
+	})
+}
+
+// WithBody only match requests with this body.
+func (e *Expectation) WithBody(expected string) *Expectation {
+	return e.WithMatcher(func(req *http.Request, body []byte) bool {
+		return string(body) == expected
+	})
+}
+
+// WithJSONBody only match requests with a json body equal to expected,
+// ignoring spaces and order of keys.
+func (e *Expectation) WithJSONBody(expected interface{}) *Expectation {
+	b, err := json.Marshal(expected)
+	if err != nil {
+		e.server.t.Fatalf("fdhttptest: cannot encode expected body as json: %s", err)
+	}
+
+	var want interface{}
+	json.Unmarshal(b, &want)
+	wantJSON, _ := json.Marshal(want)
+
+	return e.WithMatcher(func(req *http.Request, body []byte) bool {
+		var got interface{}
+		if err := json.Unmarshal(body, &got); err != nil {
+			return false
+		}
+
+		gotJSON, _ := json.Marshal(got)
+		return bytes.Equal(wantJSON, gotJSON)
+	})
+}
+
+// WithMatcher only match requests where fn return true.
+func (e *Expectation) WithMatcher(fn func(req *http.Request, body []byte) bool) *Expectation {
+	e.server.mu.Lock()
+	e.matchers = append(e.matchers, fn)
+	e.server.mu.Unlock()
+	return e
+}
+
+// Respond add a response to the sequence, each call receive the next response
+// and the last one is repeated. Without responses 200 OK is sent.
+func (e *Expectation) Respond(statusCode int, body interface{}) *Expectation {
+	return e.RespondWith(MockResponse{StatusCode: statusCode, Body: body})
+}
+
+// RespondDelayed add a response sent after delay.
+func (e *Expectation) RespondDelayed(delay time.Duration, statusCode int, body interface{}) *Expectation {
+	return e.RespondWith(MockResponse{StatusCode: statusCode, Body: body, Delay: delay})
+}
+
+// RespondFault add a broken response.
+func (e *Expectation) RespondFault(fault Fault) *Expectation {
+	return e.RespondWith(MockResponse{StatusCode: http.StatusOK, Body: "broken response", Fault: fault})
+}
+
+// RespondWith add a response to the sequence.
+func (e *Expectation) RespondWith(resp MockResponse) *Expectation {
+	e.server.mu.Lock()
+	e.responses = append(e.responses, &resp)
+	e.server.mu.Unlock()
+	return e
+}
+
+// Calls return how many times the expectation was matched.
+func (e *Expectation) Calls() int {
+	e.server.mu.Lock()
+	defer e.server.mu.Unlock()
+	return e.calls
+}
+
+// match need to be called with lock.
+func (e *Expectation) match(req *http.Request, body []byte) bool {
+	if e.times > 0 && e.calls >= e.times {
+		return false
+	}
+
+	for _, m := range e.matchers {
+		if !m(req, body) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// nextResponse need to be called with lock.
+func (e *Expectation) nextResponse() *MockResponse {
+	e.calls++
+
+	if len(e.responses) == 0 {
+		return &MockResponse{StatusCode: http.StatusOK}
+	}
+
+	i := e.calls - 1
+	if i >= len(e.responses) {
+		i = len(e.responses) - 1
+	}
+	return e.responses[i]
+}
+
+// verify need to be called with lock.
+func (e *Expectation) verify() error {
+	switch {
+	case e.anyTimes:
+		return nil
+	case e.times > 0 && e.calls != e.times:
+		return fmt.Errorf("%s %s expected %d calls, received %d", e.method, e.path, e.times, e.calls)
+	case e.times <= 0 && e.calls == 0:
+		return fmt.Errorf("%s %s expected at least one call, received none", e.method, e.path)
+	}
+	return nil
+}
+
+func writeMockResponse(w http.ResponseWriter, req *http.Request, resp *MockResponse) {
+	if resp.Delay > 0 {
+		t := time.NewTimer(resp.Delay)
+		defer t.Stop()
+
+		select {
+		case <-t.C:
+		case <-req.Context().Done():
+			return
+		}
+	}
+
+	var body []byte
+	switch b := resp.Body.(type) {
+	case nil:
+	case string:
+		body = []byte(b)
+	case []byte:
+		body = b
+	default:
+		body, _ = json.Marshal(b)
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	}
+
+	for k, v := range resp.Header {
+		w.Header()[k] = v
+	}
+
+	switch resp.Fault {
+	case FaultCloseConnection:
+		closeConnection(w)
+		return
+	case FaultPartialBody:
+		// promise more than it's sent
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)+10))
+		w.WriteHeader(resp.StatusCode)
+		w.Write(body[:len(body)/2])
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+		closeConnection(w)
+		return
+	}
+
+	w.WriteHeader(resp.StatusCode)
+	w.Write(body)
+}
+
+func closeConnection(w http.ResponseWriter) {
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		panic("fdhttptest: response doesn't support hijack")
+	}
+
+	conn, _, err := hj.Hijack()
+	if err != nil {
+		panic(err)
+	}
+	conn.Close()
+}
@@ -0,0 +1,196 @@
+package fdhttptest_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/foodora/go-ranger/fdhttp/fdhttptest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMockServer_Sequence(t *testing.T) {
+	server := fdhttptest.NewMockServer(t)
+	defer server.Close()
+
+	server.Expect(http.MethodGet, "/orders/:id").Times(3).
+		RespondFault(fdhttptest.FaultCloseConnection).
+		RespondFault(fdhttptest.FaultPartialBody).
+		Respond(http.StatusServiceUnavailable, nil)
+	ok := server.Expect(http.MethodGet, "/orders/:id").
+		Respond(http.StatusOK, map[string]int{"id": 1})
+
+	_, err := http.Get(server.URL + "/orders/1")
+	assert.Error(t, err)
+
+	resp, err := http.Get(server.URL + "/orders/1")
+	if assert.NoError(t, err) {
+		_, err = ioutil.ReadAll(resp.Body)
+		assert.Error(t, err)
+		resp.Body.Close()
+	}
+
+	resp, err = http.Get(server.URL + "/orders/1")
+	if assert.NoError(t, err) {
+		assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+		resp.Body.Close()
+	}
+
+	for i := 0; i < 2; i++ {
+		resp, err = http.Get(server.URL + "/orders/1")
+		if assert.NoError(t, err) {
+			body, _ := ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			assert.Equal(t, `{"id":1}`, string(body))
+		}
+	}
+
+	assert.Equal(t, 2, ok.Calls())
+	server.Verify()
+}
+
+func TestMockServer_Matchers(t *testing.T) {
+	server := fdhttptest.NewMockServer(t)
+	defer server.Close()
+
+	server.Expect(http.MethodPost, "/orders").
+		WithHeader("X-Country", "de").
+		WithJSONBody(map[string]interface{}{"id": 1, "items": []string{"pizza"}}).
+		Respond(http.StatusCreated, "created")
+	server.Expect(http.MethodPost, "/orders").
+		WithBody("raw").
+		Respond(http.StatusAccepted, []byte("accepted"))
+
+	req, _ := http.NewRequest(http.MethodPost, server.URL+"/orders", strings.NewReader(`{"items": ["pizza"], "id": 1}`))
+	req.Header.Set("X-Country", "de")
+	resp, err := http.DefaultClient.Do(req)
+	if assert.NoError(t, err) {
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+		assert.Equal(t, "created", string(body))
+	}
+
+	resp, err = http.Post(server.URL+"/orders", "text/plain", strings.NewReader("raw"))
+	if assert.NoError(t, err) {
+		resp.Body.Close()
+		assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+	}
+
+	server.Verify()
+}
+
+func TestMockServer_Delay(t *testing.T) {
+	server := fdhttptest.NewMockServer(t)
+	defer server.Close()
+
+	server.Expect(http.MethodGet, "/slow").
+		RespondDelayed(time.Second, http.StatusOK, nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/slow", nil)
+	started := time.Now()
+	_, err := http.DefaultClient.Do(req.WithContext(ctx))
+	assert.Error(t, err)
+	assert.True(t, time.Since(started) < time.Second)
+}
+
+func TestMockServer_VerifyFail(t *testing.T) {
+	ft := &fakeT{}
+	server := fdhttptest.NewMockServer(ft)
+	defer server.Close()
+
+	server.Expect(http.MethodGet, "/never")
+	server.Expect(http.MethodGet, "/once").Times(2)
+	server.Expect(http.MethodGet, "/optional").AnyTimes()
+
+	resp, err := http.Get(server.URL + "/once")
+	if assert.NoError(t, err) {
+		resp.Body.Close()
+	}
+
+	resp, err = http.Get(server.URL + "/unknown")
+	if assert.NoError(t, err) {
+		resp.Body.Close()
+		assert.Equal(t, http.StatusNotImplemented, resp.StatusCode)
+	}
+
+	resp, err = http.Post(server.URL+"/once", "", nil)
+	if assert.NoError(t, err) {
+		resp.Body.Close()
+		assert.Equal(t, http.StatusNotImplemented, resp.StatusCode)
+	}
+
+	server.Verify()
+	assert.Len(t, ft.errors, 4)
+}
+
+func TestMockServer_Patterns(t *testing.T) {
+	server := fdhttptest.NewMockServer(t)
+	defer server.Close()
+
+	server.Expect(http.MethodGet, "/orders/:id").Respond(http.StatusOK, "order")
+	server.Expect(http.MethodGet, "/orders/:id/items").Respond(http.StatusOK, "items")
+	server.Expect(http.MethodGet, "/files/*path").Respond(http.StatusOK, "file")
+
+	for path, expected := range map[string]string{
+		"/orders/10":       "order",
+		"/orders/10/items": "items",
+		"/files/menu/1":    "file",
+	} {
+		resp, err := http.Get(server.URL + path)
+		if assert.NoError(t, err) {
+			body, _ := ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+			assert.Equal(t, expected, string(body), path)
+		}
+	}
+
+	for _, path := range []string{"/orders", "/orders/10/items/1"} {
+		resp, err := http.Get(server.URL + path)
+		if assert.NoError(t, err) {
+			resp.Body.Close()
+			assert.Equal(t, http.StatusNotImplemented, resp.StatusCode, path)
+		}
+	}
+
+	resp, err := http.Post(server.URL+"/orders/10", "text/plain", nil)
+	if assert.NoError(t, err) {
+		resp.Body.Close()
+		assert.Equal(t, http.StatusNotImplemented, resp.StatusCode)
+	}
+}
+
+func TestMockServer_Concurrent(t *testing.T) {
+	server := fdhttptest.NewMockServer(t)
+	defer server.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		path := "/orders/" + strconv.Itoa(i)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			// expectations are registered while other requests are served
+			server.Expect(http.MethodGet, path).Respond(http.StatusOK, nil)
+			resp, err := http.Get(server.URL + path)
+			if assert.NoError(t, err) {
+				resp.Body.Close()
+				assert.Equal(t, http.StatusOK, resp.StatusCode)
+			}
+		}()
+	}
+	wg.Wait()
+
+	server.Verify()
+}
@@ -0,0 +1,163 @@
+package fdhttptest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/foodora/go-ranger/fdhttp"
+)
+
+// Request build a request to test your handlers:
+//  fdhttptest.NewRequest(t, "PUT", "/entity/:id").
+//      WithRouteParam("id", "1").
+//      WithJSON(map[string]string{"name": "foo"}).
+//      Serve(router).
+//      AssertStatus(http.StatusOK).
+//      AssertJSONPath("body.name", "foo")
+type Request struct {
+	t      testing.TB
+	ctx    context.Context
+	method string
+	path   string
+	params map[string]string
+	header http.Header
+	query  url.Values
+	body   []byte
+}
+
+// NewRequest create a request to path. path can have route params like
+// "/entity/:id" that will be replaced by values informed in WithRouteParam.
+func NewRequest(t testing.TB, method, path string) *Request {
+	return &Request{
+		t:      t,
+		ctx:    context.Background(),
+		method: method,
+		path:   path,
+		params: map[string]string{},
+		header: http.Header{},
+		query:  url.Values{},
+	}
+}
+
+// WithContext set the context used by the request.
+func (r *Request) WithContext(ctx context.Context) *Request {
+	r.ctx = ctx
+	return r
+}
+
+// WithHeader add a header to the request.
+func (r *Request) WithHeader(key, value string) *Request {
+	r.header.Add(key, value)
+	return r
+}
+
+// WithQuery add a query string to the request.
+func (r *Request) WithQuery(key, value string) *Request {
+	r.query.Add(key, value)
+	return r
+}
+
+// WithRouteParam set a route param.
+func (r *Request) WithRouteParam(key, value string) *Request {
+	r.params[key] = value
+	return r
+}
+
+// WithBody set the raw body of the request.
+func (r *Request) WithBody(body string) *Request {
+	r.body = []byte(body)
+	return r
+}
+
+// WithJSON encode v as body of the request and set the Content-Type.
+func (r *Request) WithJSON(v interface{}) *Request {
+	r.t.Helper()
+
+	body, err := json.Marshal(v)
+	if err != nil {
+		r.t.Fatalf("fdhttptest: cannot encode body as json: %s", err)
+	}
+
+	r.body = body
+	r.header.Set("Content-Type", "application/json")
+	return r
+}
+
+// URL return the path with route params replaced and query strings.
+func (r *Request) URL() string {
+	path := r.path
+	if strings.ContainsAny(path, ":*") {
+		path = (fdhttp.Endpoint{Path: path}).PathParam(r.params)
+	}
+
+	if len(r.query) > 0 {
+		path += "?" + r.query.Encode()
+	}
+	return path
+}
+
+// HTTPRequest return the *http.Request that will be sent.
+func (r *Request) HTTPRequest() *http.Request {
+	var body io.Reader
+	if r.body != nil {
+		body = bytes.NewReader(r.body)
+	}
+
+	req := httptest.NewRequest(r.method, r.URL(), body)
+	for k, v := range r.header {
+		req.Header[k] = v
+	}
+
+	return req.WithContext(r.ctx)
+}
+
+// Serve send the request to h, usually your *fdhttp.Router.
+func (r *Request) Serve(h http.Handler) *Response {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r.HTTPRequest())
+
+	return &Response{
+		ResponseRecorder: w,
+		t:                r.t,
+	}
+}
+
+// Call the endpoint directly without a router, the context has all values
+// that fdhttp.Router would set: request, headers, body, form and route params.
+// The value returned by fn is available in Response.Value.
+func (r *Request) Call(fn fdhttp.EndpointFunc) *Response {
+	w := httptest.NewRecorder()
+	req := r.HTTPRequest()
+
+	ctx := req.Context()
+	ctx = fdhttp.SetRequest(ctx, req)
+	ctx = fdhttp.SetRequestHeader(ctx, req.Header)
+	ctx = fdhttp.SetResponse(ctx, w)
+	ctx = fdhttp.SetResponseHeader(ctx, w.Header())
+	ctx = fdhttp.SetRouteParams(ctx, r.params)
+	ctx = fdhttp.SetRequestBody(ctx, bytes.NewReader(r.body))
+
+	req.ParseMultipartForm(32 << 20)
+	if req.Form != nil {
+		ctx = fdhttp.SetRequestForm(ctx, req.Form)
+	}
+	if req.PostForm != nil {
+		ctx = fdhttp.SetRequestPostForm(ctx, req.PostForm)
+	}
+
+	statusCode, value := fn(ctx)
+	fdhttp.ResponseEndpoint(w, statusCode, value)
+
+	return &Response{
+		ResponseRecorder: w,
+		Value:            value,
+		t:                r.t,
+	}
+}
@@ -0,0 +1,106 @@
+package fdhttptest_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/foodora/go-ranger/fdhttp"
+	"github.com/foodora/go-ranger/fdhttp/fdhttptest"
+	"github.com/stretchr/testify/assert"
+)
+
+type entity struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+func updateEntity(ctx context.Context) (int, interface{}) {
+	var e entity
+	if err := fdhttp.RequestBodyJSON(ctx, &e); err != nil {
+		return http.StatusBadRequest, &fdhttp.Error{Code: "invalid_body"}
+	}
+
+	e.ID = fdhttp.RouteParam(ctx, "id")
+	fdhttp.SetResponseHeaderValue(ctx, "X-Version", fdhttp.RequestHeaderValue(ctx, "X-Version"))
+
+	return http.StatusOK, map[string]interface{}{
+		"entity": e,
+		"filter": fdhttp.RequestFormValue(ctx, "filter"),
+	}
+}
+
+func TestRequest_URL(t *testing.T) {
+	req := fdhttptest.NewRequest(t, http.MethodGet, "/entity/:id/*path").
+		WithRouteParam("id", "1").
+		WithRouteParam("path", "a/b").
+		WithQuery("filter", "x y")
+
+	assert.Equal(t, "/entity/1/a/b?filter=x+y", req.URL())
+	assert.Equal(t, "/entity/1/a/b", req.HTTPRequest().URL.Path)
+}
+
+func TestRequest_Serve(t *testing.T) {
+	router := fdhttp.NewRouter()
+	router.Handler(http.MethodPut, "/entity/:id", updateEntity)
+
+	resp := fdhttptest.NewRequest(t, http.MethodPut, "/entity/:id").
+		WithRouteParam("id", "10").
+		WithQuery("filter", "active").
+		WithHeader("X-Version", "2").
+		WithJSON(entity{Name: "foo"}).
+		Serve(router).
+		AssertStatus(http.StatusOK).
+		AssertHeader("X-Version", "2").
+		AssertHeader("Content-Type", "application/json; charset=utf-8").
+		AssertJSONPath("entity.id", "10").
+		AssertJSONPath("entity.name", "foo").
+		AssertJSONPath("filter", "active")
+
+	assert.Nil(t, resp.Value)
+}
+
+func TestRequest_Call(t *testing.T) {
+	resp := fdhttptest.NewRequest(t, http.MethodPut, "/entity/:id").
+		WithRouteParam("id", "10").
+		WithQuery("filter", "active").
+		WithHeader("X-Version", "2").
+		WithJSON(entity{Name: "foo"}).
+		Call(updateEntity).
+		AssertStatus(http.StatusOK).
+		AssertHeader("X-Version", "2").
+		AssertJSON(`{"entity": {"id": "10", "name": "foo"}, "filter": "active"}`)
+
+	value := resp.Value.(map[string]interface{})
+	assert.Equal(t, entity{ID: "10", Name: "foo"}, value["entity"])
+}
+
+func TestRequest_CallWithError(t *testing.T) {
+	fdhttptest.NewRequest(t, http.MethodPut, "/entity/1").
+		WithBody("{").
+		Call(updateEntity).
+		AssertStatus(http.StatusBadRequest).
+		AssertErrorCode("invalid_body")
+
+	resp := fdhttptest.NewRequest(t, http.MethodGet, "/").
+		Call(func(ctx context.Context) (int, interface{}) {
+			return http.StatusInternalServerError, errors.New("boom")
+		}).
+		AssertStatus(http.StatusInternalServerError).
+		AssertErrorCode("unknown").
+		AssertJSONPath("message", "boom")
+
+	assert.EqualError(t, resp.Value.(error), "boom")
+}
+
+func TestRequest_CallWithReader(t *testing.T) {
+	resp := fdhttptest.NewRequest(t, http.MethodGet, "/").
+		Call(func(ctx context.Context) (int, interface{}) {
+			return http.StatusAccepted, strings.NewReader("plain text")
+		}).
+		AssertStatus(http.StatusAccepted)
+
+	assert.Equal(t, "plain text", resp.Body.String())
+}
@@ -0,0 +1,134 @@
+package fdhttptest
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/foodora/go-ranger/fdhttp"
+	"github.com/stretchr/testify/assert"
+)
+
+// Response is what your handler sent, all assertions return the response
+// itself, with that they can be chained.
+type Response struct {
+	*httptest.ResponseRecorder
+
+	// Value is what the fdhttp.EndpointFunc returned when Request.Call is used.
+	Value interface{}
+
+	t testing.TB
+}
+
+// AssertStatus check the status code.
+func (r *Response) AssertStatus(statusCode int) *Response {
+	r.t.Helper()
+	assert.Equal(r.t, statusCode, r.Code, "status code, body: %s", r.Body.String())
+	return r
+}
+
+// AssertHeader check the value of a response header.
+func (r *Response) AssertHeader(key, value string) *Response {
+	r.t.Helper()
+	assert.Equal(r.t, value, r.Header().Get(key), "header %s", key)
+	return r
+}
+
+// AssertJSON check if body is the same json as expected, ignoring spaces
+// and order of keys.
+func (r *Response) AssertJSON(expected string) *Response {
+	r.t.Helper()
+	assert.JSONEq(r.t, expected, r.Body.String())
+	return r
+}
+
+// AssertJSONPath check the value of a field in a json body. path is separated
+// by dots and can have indexes of arrays:
+//  resp.AssertJSONPath("orders.0.id", 10)
+//  resp.AssertJSONPath("orders[1].items[0].name", "pizza")
+func (r *Response) AssertJSONPath(path string, expected interface{}) *Response {
+	r.t.Helper()
+
+	value, ok := r.JSONPath(path)
+	if !assert.True(r.t, ok, "json path %s not found in %s", path, r.Body.String()) {
+		return r
+	}
+
+	// normalize expected value, like that 1 and float64(1) are the same
+	b, err := json.Marshal(expected)
+	if !assert.NoError(r.t, err) {
+		return r
+	}
+	var normalized interface{}
+	json.Unmarshal(b, &normalized)
+
+	assert.Equal(r.t, normalized, value, "json path %s", path)
+	return r
+}
+
+// AssertErrorCode check if body is a fdhttp.Error with code.
+func (r *Response) AssertErrorCode(code string) *Response {
+	r.t.Helper()
+
+	var respErr fdhttp.Error
+	if !assert.NoError(r.t, json.Unmarshal(r.Body.Bytes(), &respErr), "body is not a fdhttp.Error: %s", r.Body.String()) {
+		return r
+	}
+
+	assert.Equal(r.t, code, respErr.Code, "error code")
+	return r
+}
+
+// DecodeJSON decode the body into v.
+func (r *Response) DecodeJSON(v interface{}) *Response {
+	r.t.Helper()
+	assert.NoError(r.t, json.Unmarshal(r.Body.Bytes(), v), "cannot decode body: %s", r.Body.String())
+	return r
+}
+
+// JSONPath return the value in path of a json body, see AssertJSONPath.
+func (r *Response) JSONPath(path string) (interface{}, bool) {
+	var value interface{}
+	if err := json.Unmarshal(r.Body.Bytes(), &value); err != nil {
+		return nil, false
+	}
+
+	path = strings.Replace(path, "[", ".", -1)
+	path = strings.Replace(path, "]", "", -1)
+
+	for _, key := range strings.Split(path, ".") {
+		if key == "" {
+			continue
+		}
+
+		switch v := value.(type) {
+		case map[string]interface{}:
+			var ok bool
+			if value, ok = v[key]; !ok {
+				return nil, false
+			}
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(v) {
+				return nil, false
+			}
+			value = v[i]
+		default:
+			return nil, false
+		}
+	}
+
+	return value, true
+}
+
+// indentBody return body indented when it's a json.
+func (r *Response) indentBody() []byte {
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, bytes.TrimSpace(r.Body.Bytes()), "", "  "); err != nil {
+		return r.Body.Bytes()
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,98 @@
+package fdhttptest_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/foodora/go-ranger/fdhttp/fdhttptest"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeT record failures instead of failing the test.
+type fakeT struct {
+	testing.TB
+	errors []string
+}
+
+func (t *fakeT) Helper() {}
+
+func (t *fakeT) Name() string { return "fakeT" }
+
+func (t *fakeT) Errorf(format string, args ...interface{}) {
+	t.errors = append(t.errors, fmt.Sprintf(format, args...))
+}
+
+func listOrders(ctx context.Context) (int, interface{}) {
+	return http.StatusOK, map[string]interface{}{
+		"orders": []map[string]interface{}{
+			{"id": 1, "items": []string{"pizza", "soda"}},
+			{"id": 2, "items": []string{"burger"}},
+		},
+	}
+}
+
+func TestResponse_JSONPath(t *testing.T) {
+	resp := fdhttptest.NewRequest(t, http.MethodGet, "/orders").
+		Call(listOrders).
+		AssertJSONPath("orders.0.id", 1).
+		AssertJSONPath("orders[0].items[1]", "soda").
+		AssertJSONPath("orders.1.items", []string{"burger"})
+
+	for _, path := range []string{"orders.2", "orders.0.price", "orders.x", "orders.0.id.x"} {
+		_, ok := resp.JSONPath(path)
+		assert.False(t, ok, path)
+	}
+}
+
+func TestResponse_AssertionsFail(t *testing.T) {
+	ft := &fakeT{}
+	fdhttptest.NewRequest(ft, http.MethodGet, "/orders").
+		Call(listOrders).
+		AssertStatus(http.StatusCreated).
+		AssertHeader("Content-Type", "text/plain").
+		AssertJSONPath("orders.0.id", 2).
+		AssertJSONPath("orders.5", 1).
+		AssertErrorCode("not_found")
+
+	assert.Len(t, ft.errors, 5)
+}
+
+func TestResponse_AssertGolden(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fdhttptest")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	defaultDir, defaultUpdate := fdhttptest.GoldenDir, fdhttptest.UpdateGolden
+	defer func() {
+		fdhttptest.GoldenDir, fdhttptest.UpdateGolden = defaultDir, defaultUpdate
+	}()
+	fdhttptest.GoldenDir = dir
+
+	// file doesn't exist yet
+	ft := &fakeT{}
+	fdhttptest.NewRequest(ft, http.MethodGet, "/orders").Call(listOrders).AssertGolden("orders")
+	assert.Len(t, ft.errors, 1)
+
+	fdhttptest.UpdateGolden = true
+	fdhttptest.NewRequest(t, http.MethodGet, "/orders").Call(listOrders).AssertGolden("orders")
+
+	content, err := ioutil.ReadFile(filepath.Join(dir, "orders.golden"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(content), "200\n{\n  \"orders\": [")
+
+	fdhttptest.UpdateGolden = false
+	fdhttptest.NewRequest(t, http.MethodGet, "/orders").Call(listOrders).AssertGolden("orders")
+
+	ft = &fakeT{}
+	fdhttptest.NewRequest(ft, http.MethodGet, "/orders").
+		Call(func(ctx context.Context) (int, interface{}) {
+			return http.StatusOK, map[string]interface{}{"orders": []int{}}
+		}).
+		AssertGolden("orders")
+	assert.Len(t, ft.errors, 1)
+}
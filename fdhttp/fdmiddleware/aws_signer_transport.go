@@ -0,0 +1,77 @@
+package fdmiddleware
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/defaults"
+	v4 "github.com/aws/aws-sdk-go/aws/signer/v4"
+)
+
+// AWSSigner is a ClientMiddleware that sign all requests with AWS Signature
+// Version 4, to call services using IAM auth like API Gateway or
+// Elasticsearch:
+//  signer := fdmiddleware.NewAWSSignerTransport("es", "eu-west-1", nil)
+//  client.Use(signer)
+// Temporary credentials have their session token sent in X-Amz-Security-Token.
+type AWSSigner struct {
+	Service string
+	Region  string
+	// UnsignedPayload send the body without reading it to calculate its
+	// hash, only services like S3 accept it.
+	UnsignedPayload bool
+
+	signer *v4.Signer
+}
+
+// NewAWSSignerTransport return a ClientMiddleware that sign requests to
+// service in region. If creds is nil, the default credential chain is used:
+// environment variables, shared credentials file and EC2/ECS roles.
+func NewAWSSignerTransport(service, region string, creds *credentials.Credentials) *AWSSigner {
+	if creds == nil {
+		creds = defaults.CredChain(defaults.Config(), defaults.Handlers())
+	}
+
+	return &AWSSigner{
+		Service: service,
+		Region:  region,
+		signer:  v4.NewSigner(creds),
+	}
+}
+
+// Wrap implements ClientMiddleware
+func (s *AWSSigner) Wrap(next http.RoundTripper) http.RoundTripper {
+	return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		req = cloneRequest(req)
+
+		signer := *s.signer
+		signer.UnsignedPayload = s.UnsignedPayload
+
+		var body io.ReadSeeker
+		if s.UnsignedPayload {
+			// keep the body streaming
+			signer.DisableRequestBodyOverwrite = true
+		} else if req.Body != nil && req.Body != http.NoBody {
+			b, err := ioutil.ReadAll(req.Body)
+			req.Body.Close()
+			if err != nil {
+				return nil, err
+			}
+
+			body = bytes.NewReader(b)
+			req.GetBody = func() (io.ReadCloser, error) {
+				return ioutil.NopCloser(bytes.NewReader(b)), nil
+			}
+		}
+
+		if _, err := signer.Sign(req, body, s.Service, s.Region, time.Now()); err != nil {
+			return nil, err
+		}
+
+		return next.RoundTrip(req)
+	})
+}
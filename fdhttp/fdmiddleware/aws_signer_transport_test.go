@@ -0,0 +1,74 @@
+package fdmiddleware_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	v4 "github.com/aws/aws-sdk-go/aws/signer/v4"
+	"github.com/foodora/go-ranger/fdhttp/fdmiddleware"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAWSSigner(t *testing.T) {
+	creds := credentials.NewStaticCredentials("AKID", "SECRET", "SESSION")
+	signer := fdmiddleware.NewAWSSignerTransport("es", "eu-west-1", creds)
+
+	var called bool
+	transport := signer.Wrap(fdmiddleware.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		called = true
+
+		body, err := ioutil.ReadAll(req.Body)
+		assert.NoError(t, err)
+		assert.Equal(t, `{"query":{"match_all":{}}}`, string(body))
+		assert.Equal(t, "SESSION", req.Header.Get("X-Amz-Security-Token"))
+
+		auth := req.Header.Get("Authorization")
+		assert.True(t, strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKID/"), auth)
+		assert.Contains(t, auth, "/eu-west-1/es/aws4_request")
+
+		// sign again the same request to validate the signature
+		signTime, err := time.Parse("20060102T150405Z", req.Header.Get("X-Amz-Date"))
+		assert.NoError(t, err)
+
+		check, _ := http.NewRequest(req.Method, req.URL.String(), nil)
+		check.Header.Set("Content-Type", req.Header.Get("Content-Type"))
+		_, err = v4.NewSigner(creds).Sign(check, strings.NewReader(string(body)), "es", "eu-west-1", signTime)
+		assert.NoError(t, err)
+		assert.Equal(t, check.Header.Get("Authorization"), auth)
+
+		return newResponse(http.StatusOK, "ok"), nil
+	}))
+
+	req, _ := http.NewRequest(http.MethodPost, "https://search.eu-west-1.es.amazonaws.com/orders/_search?size=10", strings.NewReader(`{"query":{"match_all":{}}}`))
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := transport.RoundTrip(req)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.True(t, called)
+	assert.Empty(t, req.Header.Get("Authorization"), "original request should not be modified")
+}
+
+func TestAWSSigner_UnsignedPayload(t *testing.T) {
+	creds := credentials.NewStaticCredentials("AKID", "SECRET", "")
+	signer := fdmiddleware.NewAWSSignerTransport("s3", "eu-west-1", creds)
+	signer.UnsignedPayload = true
+
+	transport := signer.Wrap(fdmiddleware.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		assert.Equal(t, "UNSIGNED-PAYLOAD", req.Header.Get("X-Amz-Content-Sha256"))
+		assert.Empty(t, req.Header.Get("X-Amz-Security-Token"))
+
+		body, _ := ioutil.ReadAll(req.Body)
+		assert.Equal(t, "large file", string(body))
+
+		return newResponse(http.StatusOK, ""), nil
+	}))
+
+	req, _ := http.NewRequest(http.MethodPut, "https://bucket.s3.amazonaws.com/file.txt", strings.NewReader("large file"))
+	_, err := transport.RoundTrip(req)
+	assert.NoError(t, err)
+}
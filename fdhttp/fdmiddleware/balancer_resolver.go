@@ -0,0 +1,132 @@
+package fdmiddleware
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// Backend is an address that can receive requests of a logical host, it
+// can be host:port or scheme://host:port.
+type Backend struct {
+	Address string
+	// Weight is used by Weighted strategy, values <= 0 count as 1.
+	Weight int
+}
+
+// Resolver return the backends of a logical host, no backends means the host
+// is not balanced and requests are sent as they are.
+type Resolver interface {
+	Resolve(ctx context.Context, host string) ([]Backend, error)
+}
+
+// ResolverFunc is a easy way to convert a function to a Resolver
+type ResolverFunc func(ctx context.Context, host string) ([]Backend, error)
+
+// Resolve implements Resolver
+func (f ResolverFunc) Resolve(ctx context.Context, host string) ([]Backend, error) {
+	return f(ctx, host)
+}
+
+// StaticResolver map logical hosts to backends from config:
+//  fdmiddleware.StaticResolver{
+//      "menu-service": {{Address: "10.0.0.1:8080"}, {Address: "10.0.0.2:8080"}},
+//  }
+type StaticResolver map[string][]Backend
+
+// Resolve implements Resolver
+func (r StaticResolver) Resolve(ctx context.Context, host string) ([]Backend, error) {
+	return r[host], nil
+}
+
+// DNSResolver use A/AAAA records of the host, all addresses with Port or
+// with the port of the request when Port is empty. Only Hosts are resolved,
+// requests to other hosts are not balanced.
+type DNSResolver struct {
+	Hosts    []string
+	Port     string
+	Resolver *net.Resolver
+}
+
+// Resolve implements Resolver
+func (r *DNSResolver) Resolve(ctx context.Context, host string) ([]Backend, error) {
+	hostname, port := splitHostPort(host)
+	if !contains(r.Hosts, hostname) {
+		return nil, nil
+	}
+	if r.Port != "" {
+		port = r.Port
+	}
+
+	addrs, err := r.resolver().LookupHost(ctx, hostname)
+	if err != nil {
+		return nil, err
+	}
+
+	backends := make([]Backend, 0, len(addrs))
+	for _, addr := range addrs {
+		if port != "" {
+			addr = net.JoinHostPort(addr, port)
+		} else if strings.Contains(addr, ":") {
+			// IPv6 without port
+			addr = "[" + addr + "]"
+		}
+		backends = append(backends, Backend{Address: addr})
+	}
+
+	return backends, nil
+}
+
+func (r *DNSResolver) resolver() *net.Resolver {
+	if r.Resolver != nil {
+		return r.Resolver
+	}
+	return net.DefaultResolver
+}
+
+// SRVResolver use SRV records _Service._Proto.host, with their ports and
+// weights. Only Hosts are resolved, requests to other hosts are not
+// balanced.
+type SRVResolver struct {
+	Hosts    []string
+	Service  string
+	Proto    string
+	Resolver *net.Resolver
+}
+
+// Resolve implements Resolver
+func (r *SRVResolver) Resolve(ctx context.Context, host string) ([]Backend, error) {
+	hostname, _ := splitHostPort(host)
+	if !contains(r.Hosts, hostname) {
+		return nil, nil
+	}
+
+	resolver := r.Resolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+
+	_, records, err := resolver.LookupSRV(ctx, r.Service, r.Proto, hostname)
+	if err != nil {
+		return nil, err
+	}
+
+	backends := make([]Backend, 0, len(records))
+	for _, srv := range records {
+		backends = append(backends, Backend{
+			Address: net.JoinHostPort(strings.TrimSuffix(srv.Target, "."), strconv.Itoa(int(srv.Port))),
+			Weight:  int(srv.Weight),
+		})
+	}
+
+	return backends, nil
+}
+
+func splitHostPort(host string) (hostname, port string) {
+	hostname, port, err := net.SplitHostPort(host)
+	if err != nil {
+		return host, ""
+	}
+	return hostname, port
+}
@@ -0,0 +1,45 @@
+package fdmiddleware_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/foodora/go-ranger/fdhttp/fdmiddleware"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStaticResolver(t *testing.T) {
+	backends, err := menuService.Resolve(context.Background(), "menu-service")
+	assert.NoError(t, err)
+	assert.Len(t, backends, 2)
+
+	backends, err = menuService.Resolve(context.Background(), "orders")
+	assert.NoError(t, err)
+	assert.Empty(t, backends)
+}
+
+func TestDNSResolver(t *testing.T) {
+	resolver := &fdmiddleware.DNSResolver{Hosts: []string{"localhost"}}
+
+	backends, err := resolver.Resolve(context.Background(), "localhost:8080")
+	assert.NoError(t, err)
+	assert.Contains(t, backends, fdmiddleware.Backend{Address: "127.0.0.1:8080"})
+
+	resolver.Port = "9090"
+	backends, err = resolver.Resolve(context.Background(), "localhost")
+	assert.NoError(t, err)
+	assert.Contains(t, backends, fdmiddleware.Backend{Address: "127.0.0.1:9090"})
+}
+
+func TestDNSResolver_Hosts(t *testing.T) {
+	resolver := &fdmiddleware.DNSResolver{Hosts: []string{"menu-service"}}
+
+	backends, err := resolver.Resolve(context.Background(), "localhost:8080")
+	assert.NoError(t, err)
+	assert.Empty(t, backends, "hosts not configured are not balanced")
+
+	srv := &fdmiddleware.SRVResolver{Service: "http", Proto: "tcp"}
+	backends, err = srv.Resolve(context.Background(), "localhost")
+	assert.NoError(t, err)
+	assert.Empty(t, backends)
+}
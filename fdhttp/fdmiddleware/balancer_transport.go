@@ -0,0 +1,461 @@
+package fdmiddleware
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BalanceStrategy choose which backend receive a request.
+type BalanceStrategy int
+
+const (
+	// RoundRobin send requests to each backend in turns.
+	RoundRobin BalanceStrategy = iota
+	// LeastOutstanding send requests to the backend with less requests in
+	// flight.
+	LeastOutstanding
+	// Weighted send requests proportionally to the backend weight.
+	Weighted
+)
+
+// BackendStatus describe a backend of a logical host.
+type BackendStatus struct {
+	Address     string `json:"address"`
+	Weight      int    `json:"weight"`
+	Healthy     bool   `json:"healthy"`
+	Outstanding int    `json:"outstanding"`
+	Failures    int    `json:"failures"`
+}
+
+// Balancer send requests of a logical host, like "menu-service", to its
+// backends, without an extra load balancer hop. Backends are ejected after
+// MaxFailures consecutive failures for EjectionTime, or while their health
+// check fails if probes are enabled with SetProbeInterval. When all
+// backends are ejected, all of them are used:
+//  balancer := fdmiddleware.NewBalancerTransport(fdmiddleware.StaticResolver{
+//      "menu-service": {{Address: "10.0.0.1:8080"}, {Address: "10.0.0.2:8080"}},
+//  }, fdmiddleware.LeastOutstanding)
+//  client.Use(balancer)
+//  client.Get("http://menu-service/menus/1")
+// Backends using https must be dialed with DialTLS, to verify their
+// certificates against the logical host instead of the backend address:
+//  transport.DialTLS = balancer.DialTLS
+type Balancer struct {
+	Resolver Resolver
+	Strategy BalanceStrategy
+	// MaxFailures is how many consecutive failures eject a backend, zero
+	// disables passive ejection.
+	MaxFailures int
+	// EjectionTime is how long a backend is ejected after MaxFailures.
+	EjectionTime time.Duration
+	// RefreshInterval is how often backends are resolved again.
+	RefreshInterval time.Duration
+	// IsFailure decide which calls count as failure, by default
+	// DefaultCircuitFailure.
+	IsFailure func(resp *http.Response, err error) bool
+	// HealthCheckPath is requested in each backend by active probes.
+	HealthCheckPath string
+	// TLSClientConfig is used by DialTLS, its ServerName is replaced
+	// by the logical host.
+	TLSClientConfig *tls.Config
+
+	mu    sync.Mutex
+	pools map[string]*backendPool
+
+	probeDone chan struct{}
+}
+
+type backendPool struct {
+	backends   []*backendState
+	resolvedAt time.Time
+	refreshing bool
+	next       int
+}
+
+type backendState struct {
+	Backend
+	outstanding  int
+	failures     int
+	ejectedUntil time.Time
+	probeFailed  bool
+	// current is used by smooth weighted round-robin
+	current int
+}
+
+// NewBalancerTransport create a balancer ejecting backends for 30 seconds
+// after 5 consecutive failures.
+func NewBalancerTransport(resolver Resolver, strategy BalanceStrategy) *Balancer {
+	return &Balancer{
+		Resolver:        resolver,
+		Strategy:        strategy,
+		MaxFailures:     5,
+		EjectionTime:    30 * time.Second,
+		RefreshInterval: 30 * time.Second,
+		IsFailure:       DefaultCircuitFailure,
+		HealthCheckPath: "/health/check",
+		pools:           make(map[string]*backendPool),
+	}
+}
+
+// Wrap implements ClientMiddleware
+func (b *Balancer) Wrap(next http.RoundTripper) http.RoundTripper {
+	return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if err := b.resolve(req.Context(), req.URL.Host); err != nil {
+			return nil, err
+		}
+
+		backend := b.pick(req.URL.Host)
+		if backend == nil {
+			return next.RoundTrip(req)
+		}
+
+		r := cloneRequest(req)
+		if r.Host == "" {
+			r.Host = req.URL.Host
+		}
+		setBackend(r.URL, backend.Address)
+
+		resp, err := next.RoundTrip(r)
+
+		isFailure := b.IsFailure
+		if isFailure == nil {
+			isFailure = DefaultCircuitFailure
+		}
+		b.report(backend, isFailure(resp, err))
+
+		release := func() { b.release(backend) }
+		if err != nil || resp == nil || resp.Body == nil {
+			release()
+			return resp, err
+		}
+
+		resp.Body = &releaseBody{ReadCloser: resp.Body, release: release}
+		return resp, nil
+	})
+}
+
+// resolve host again when RefreshInterval has passed, keeping the state of
+// backends that didn't change.
+func (b *Balancer) resolve(ctx context.Context, host string) error {
+	b.mu.Lock()
+	pool, ok := b.pools[host]
+	if ok && (pool.refreshing || time.Since(pool.resolvedAt) < b.RefreshInterval) {
+		b.mu.Unlock()
+		return nil
+	}
+	if ok {
+		pool.refreshing = true
+	}
+	b.mu.Unlock()
+
+	resolved, err := b.Resolver.Resolve(ctx, host)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err != nil {
+		if ok {
+			// keep using the backends we know
+			pool.refreshing = false
+			pool.resolvedAt = time.Now()
+			return nil
+		}
+		return err
+	}
+
+	if b.pools == nil {
+		b.pools = make(map[string]*backendPool)
+	}
+	if pool, ok = b.pools[host]; !ok {
+		pool = &backendPool{}
+		b.pools[host] = pool
+	}
+
+	known := make(map[string]*backendState, len(pool.backends))
+	for _, s := range pool.backends {
+		known[s.Address] = s
+	}
+
+	backends := make([]*backendState, 0, len(resolved))
+	for _, backend := range resolved {
+		if s, ok := known[backend.Address]; ok {
+			s.Weight = backend.Weight
+			backends = append(backends, s)
+			continue
+		}
+		backends = append(backends, &backendState{Backend: backend})
+	}
+
+	pool.backends = backends
+	pool.resolvedAt = time.Now()
+	pool.refreshing = false
+
+	return nil
+}
+
+// pick choose a backend of host and increase its outstanding requests, it
+// return nil when host has no backends.
+func (b *Balancer) pick(host string) *backendState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	pool, ok := b.pools[host]
+	if !ok || len(pool.backends) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	candidates := make([]*backendState, 0, len(pool.backends))
+	for _, s := range pool.backends {
+		if s.healthy(now) {
+			candidates = append(candidates, s)
+		}
+	}
+	if len(candidates) == 0 {
+		candidates = pool.backends
+	}
+
+	var picked *backendState
+	switch b.Strategy {
+	case LeastOutstanding:
+		start := pool.next % len(candidates)
+		for i := range candidates {
+			s := candidates[(start+i)%len(candidates)]
+			if picked == nil || s.outstanding < picked.outstanding {
+				picked = s
+			}
+		}
+		pool.next++
+	case Weighted:
+		var total int
+		for _, s := range candidates {
+			weight := s.Weight
+			if weight <= 0 {
+				weight = 1
+			}
+			s.current += weight
+			total += weight
+			if picked == nil || s.current > picked.current {
+				picked = s
+			}
+		}
+		picked.current -= total
+	default:
+		picked = candidates[pool.next%len(candidates)]
+		pool.next++
+	}
+
+	picked.outstanding++
+	return picked
+}
+
+func (b *Balancer) report(s *backendState, failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !failed {
+		s.failures = 0
+		return
+	}
+
+	s.failures++
+	if b.MaxFailures > 0 && s.failures >= b.MaxFailures {
+		s.ejectedUntil = time.Now().Add(b.EjectionTime)
+		s.failures = 0
+	}
+}
+
+func (b *Balancer) release(s *backendState) {
+	b.mu.Lock()
+	s.outstanding--
+	b.mu.Unlock()
+}
+
+func (s *backendState) healthy(now time.Time) bool {
+	return !s.probeFailed && !now.Before(s.ejectedUntil)
+}
+
+// SetProbeInterval send a GET to HealthCheckPath of each backend every d
+// using transport, backends are ejected while they don't answer 2xx.
+// If d <= 0, probes are stopped.
+func (b *Balancer) SetProbeInterval(d time.Duration, transport http.RoundTripper) {
+	if b.probeDone != nil {
+		close(b.probeDone)
+		b.probeDone = nil
+	}
+
+	if d <= 0 {
+		return
+	}
+
+	done := make(chan struct{})
+	b.probeDone = done
+	t := time.NewTicker(d)
+
+	go func() {
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				b.Probe(d, transport)
+			case <-done:
+				return
+			}
+		}
+	}()
+}
+
+// Probe check the health of all backends once, each one has up to timeout
+// to answer.
+func (b *Balancer) Probe(timeout time.Duration, transport http.RoundTripper) {
+	b.mu.Lock()
+	var backends []*backendState
+	for _, pool := range b.pools {
+		backends = append(backends, pool.backends...)
+	}
+	b.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, s := range backends {
+		wg.Add(1)
+		go func(s *backendState) {
+			defer wg.Done()
+
+			healthy := b.probe(s.Address, timeout, transport)
+
+			b.mu.Lock()
+			s.probeFailed = !healthy
+			if healthy {
+				s.failures = 0
+			}
+			b.mu.Unlock()
+		}(s)
+	}
+	wg.Wait()
+}
+
+func (b *Balancer) probe(address string, timeout time.Duration, transport http.RoundTripper) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	u := &url.URL{Scheme: "http", Path: b.HealthCheckPath}
+	setBackend(u, address)
+
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return false
+	}
+
+	resp, err := transport.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		return false
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+
+	return resp.StatusCode >= 200 && resp.StatusCode < 300
+}
+
+// Status return the backends of each logical host.
+func (b *Balancer) Status() map[string][]BackendStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	status := make(map[string][]BackendStatus, len(b.pools))
+	for host, pool := range b.pools {
+		if len(pool.backends) == 0 {
+			continue
+		}
+
+		backends := make([]BackendStatus, 0, len(pool.backends))
+		for _, s := range pool.backends {
+			backends = append(backends, BackendStatus{
+				Address:     s.Address,
+				Weight:      s.Weight,
+				Healthy:     s.healthy(now),
+				Outstanding: s.outstanding,
+				Failures:    s.failures,
+			})
+		}
+		status[host] = backends
+	}
+
+	return status
+}
+
+// HealthCheck implements fdhandler.HealthChecker reporting the backends of
+// each logical host.
+func (b *Balancer) HealthCheck(ctx context.Context) (interface{}, error) {
+	return b.Status(), nil
+}
+
+// DialTLS connect to addr and verify its certificate against the logical
+// host addr is a backend of. Addresses that are not backends are verified
+// against their own host.
+func (b *Balancer) DialTLS(network, addr string) (net.Conn, error) {
+	config := &tls.Config{}
+	if b.TLSClientConfig != nil {
+		config = b.TLSClientConfig.Clone()
+	}
+	config.ServerName = b.serverName(addr)
+
+	// same timeout of http.DefaultTransport, including the handshake
+	return tls.DialWithDialer(&net.Dialer{Timeout: 30 * time.Second}, network, addr, config)
+}
+
+// serverName return the logical host without port that has addr as backend,
+// or the host of addr.
+func (b *Balancer) serverName(addr string) string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for host, pool := range b.pools {
+		for _, s := range pool.backends {
+			if backendAddr(s.Address) == addr {
+				hostname, _ := splitHostPort(host)
+				return hostname
+			}
+		}
+	}
+
+	hostname, _ := splitHostPort(addr)
+	return hostname
+}
+
+// backendAddr return host:port dialed to reach a https backend address.
+func backendAddr(address string) string {
+	u := &url.URL{Scheme: "https"}
+	setBackend(u, address)
+
+	if _, _, err := net.SplitHostPort(u.Host); err == nil {
+		return u.Host
+	}
+
+	port := "443"
+	if u.Scheme == "http" {
+		port = "80"
+	}
+	return net.JoinHostPort(strings.Trim(u.Host, "[]"), port)
+}
+
+// setBackend change u to be sent to address, it can have a scheme.
+func setBackend(u *url.URL, address string) {
+	if !strings.Contains(address, "://") {
+		u.Host = address
+		return
+	}
+
+	if backend, err := url.Parse(address); err == nil {
+		u.Scheme = backend.Scheme
+		u.Host = backend.Host
+	}
+}
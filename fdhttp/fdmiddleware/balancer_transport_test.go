@@ -0,0 +1,219 @@
+package fdmiddleware_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/foodora/go-ranger/fdhttp/fdmiddleware"
+	"github.com/stretchr/testify/assert"
+)
+
+type balancerUpstream struct {
+	mu    sync.Mutex
+	hosts []string
+	fail  map[string]bool
+}
+
+func (u *balancerUpstream) RoundTrip(req *http.Request) (*http.Response, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.hosts = append(u.hosts, req.URL.Host)
+	if u.fail[req.URL.Host] {
+		return nil, errors.New("connection refused")
+	}
+	return newResponse(http.StatusOK, req.Host), nil
+}
+
+func (u *balancerUpstream) Hosts() []string {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	hosts := u.hosts
+	u.hosts = nil
+	return hosts
+}
+
+func balancerGet(t *testing.T, transport http.RoundTripper, n int) {
+	for i := 0; i < n; i++ {
+		req, _ := http.NewRequest(http.MethodGet, "http://menu-service/menus", nil)
+		resp, err := transport.RoundTrip(req)
+		if err == nil {
+			assert.Equal(t, "menu-service", readBody(t, resp))
+		}
+	}
+}
+
+var menuService = fdmiddleware.StaticResolver{
+	"menu-service": {
+		{Address: "10.0.0.1:8080", Weight: 3},
+		{Address: "10.0.0.2:8080", Weight: 1},
+	},
+}
+
+func TestBalancer_RoundRobin(t *testing.T) {
+	upstream := &balancerUpstream{}
+	transport := fdmiddleware.NewBalancerTransport(menuService, fdmiddleware.RoundRobin).Wrap(upstream)
+
+	balancerGet(t, transport, 4)
+	assert.Equal(t, []string{"10.0.0.1:8080", "10.0.0.2:8080", "10.0.0.1:8080", "10.0.0.2:8080"}, upstream.Hosts())
+
+	// hosts unknown by resolver are not changed
+	req, _ := http.NewRequest(http.MethodGet, "http://orders/", nil)
+	_, err := transport.RoundTrip(req)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"orders"}, upstream.Hosts())
+}
+
+func TestBalancer_Weighted(t *testing.T) {
+	upstream := &balancerUpstream{}
+	transport := fdmiddleware.NewBalancerTransport(menuService, fdmiddleware.Weighted).Wrap(upstream)
+
+	balancerGet(t, transport, 8)
+
+	count := make(map[string]int)
+	for _, host := range upstream.Hosts() {
+		count[host]++
+	}
+	assert.Equal(t, map[string]int{"10.0.0.1:8080": 6, "10.0.0.2:8080": 2}, count)
+}
+
+func TestBalancer_LeastOutstanding(t *testing.T) {
+	upstream := &balancerUpstream{}
+	balancer := fdmiddleware.NewBalancerTransport(menuService, fdmiddleware.LeastOutstanding)
+	transport := balancer.Wrap(upstream)
+
+	// first request keep its body open
+	req, _ := http.NewRequest(http.MethodGet, "http://menu-service/menus", nil)
+	slow, err := transport.RoundTrip(req)
+	assert.NoError(t, err)
+
+	balancerGet(t, transport, 3)
+	assert.Equal(t, []string{"10.0.0.1:8080", "10.0.0.2:8080", "10.0.0.2:8080", "10.0.0.2:8080"}, upstream.Hosts())
+
+	assert.Equal(t, 1, balancer.Status()["menu-service"][0].Outstanding)
+	slow.Body.Close()
+	assert.Equal(t, 0, balancer.Status()["menu-service"][0].Outstanding)
+}
+
+func TestBalancer_Ejection(t *testing.T) {
+	upstream := &balancerUpstream{fail: map[string]bool{"10.0.0.1:8080": true}}
+	balancer := fdmiddleware.NewBalancerTransport(menuService, fdmiddleware.RoundRobin)
+	balancer.MaxFailures = 2
+	transport := balancer.Wrap(upstream)
+
+	balancerGet(t, transport, 4)
+	upstream.Hosts()
+
+	balancerGet(t, transport, 3)
+	assert.Equal(t, []string{"10.0.0.2:8080", "10.0.0.2:8080", "10.0.0.2:8080"}, upstream.Hosts())
+
+	detail, err := balancer.HealthCheck(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]fdmiddleware.BackendStatus{
+		"menu-service": {
+			{Address: "10.0.0.1:8080", Weight: 3, Healthy: false},
+			{Address: "10.0.0.2:8080", Weight: 1, Healthy: true},
+		},
+	}, detail)
+}
+
+func TestBalancer_Probe(t *testing.T) {
+	upstream := &balancerUpstream{}
+	balancer := fdmiddleware.NewBalancerTransport(menuService, fdmiddleware.RoundRobin)
+	transport := balancer.Wrap(upstream)
+
+	balancerGet(t, transport, 2)
+	upstream.Hosts()
+
+	var probed []string
+	var mu sync.Mutex
+	healthy := true
+	probe := fdmiddleware.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		mu.Lock()
+		probed = append(probed, req.URL.String())
+		mu.Unlock()
+
+		if req.URL.Host == "10.0.0.1:8080" && !healthy {
+			return newResponse(http.StatusServiceUnavailable, ""), nil
+		}
+		return newResponse(http.StatusOK, ""), nil
+	})
+
+	healthy = false
+	balancer.Probe(time.Second, probe)
+	assert.ElementsMatch(t, []string{
+		"http://10.0.0.1:8080/health/check",
+		"http://10.0.0.2:8080/health/check",
+	}, probed)
+
+	balancerGet(t, transport, 2)
+	assert.Equal(t, []string{"10.0.0.2:8080", "10.0.0.2:8080"}, upstream.Hosts())
+
+	healthy = true
+	balancer.Probe(time.Second, probe)
+
+	balancerGet(t, transport, 2)
+	assert.ElementsMatch(t, []string{"10.0.0.1:8080", "10.0.0.2:8080"}, upstream.Hosts())
+}
+
+func TestBalancer_ResolverError(t *testing.T) {
+	expectedErr := errors.New("no such host")
+	calls := 0
+	resolver := fdmiddleware.ResolverFunc(func(ctx context.Context, host string) ([]fdmiddleware.Backend, error) {
+		calls++
+		if calls == 1 {
+			return []fdmiddleware.Backend{{Address: "http://10.0.0.1:8080"}}, nil
+		}
+		return nil, expectedErr
+	})
+
+	upstream := &balancerUpstream{}
+	balancer := fdmiddleware.NewBalancerTransport(resolver, fdmiddleware.RoundRobin)
+	balancer.RefreshInterval = 0
+	transport := balancer.Wrap(upstream)
+
+	// backends resolved before are kept
+	balancerGet(t, transport, 2)
+	assert.Equal(t, []string{"10.0.0.1:8080", "10.0.0.1:8080"}, upstream.Hosts())
+
+	req, _ := http.NewRequest(http.MethodGet, "http://payment-service/", nil)
+	_, err := transport.RoundTrip(req)
+	assert.Equal(t, expectedErr, err)
+}
+
+func TestBalancer_TLS(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(req.TLS.ServerName + " " + req.Host))
+	}))
+	defer server.Close()
+	other := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	defer other.Close()
+
+	balancer := fdmiddleware.NewBalancerTransport(fdmiddleware.StaticResolver{
+		// httptest certificate is valid for example.com
+		"example.com":  {{Address: strings.TrimPrefix(server.URL, "https://")}},
+		"menu-service": {{Address: other.URL}},
+	}, fdmiddleware.RoundRobin)
+	balancer.TLSClientConfig = server.Client().Transport.(*http.Transport).TLSClientConfig
+
+	transport := &http.Transport{DialTLS: balancer.DialTLS}
+	defer transport.CloseIdleConnections()
+	client := &http.Client{Transport: balancer.Wrap(transport)}
+
+	resp, err := client.Get("https://example.com/menus")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "example.com example.com", readBody(t, resp), "SNI and Host use the logical host")
+	}
+
+	// certificate is verified against the logical host, not the backend
+	// address
+	_, err = client.Get("https://menu-service/menus")
+	assert.Error(t, err)
+}
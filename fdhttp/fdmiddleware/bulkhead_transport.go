@@ -0,0 +1,156 @@
+package fdmiddleware
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrBulkheadFull is returned when there're too many requests in flight to
+// the same upstream and no free slot in the queue.
+var ErrBulkheadFull = errors.New("fdmiddleware: bulkhead is full")
+
+// BulkheadUsage is the usage of one upstream.
+type BulkheadUsage struct {
+	InFlight int `json:"in_flight"`
+	Queued   int `json:"queued"`
+	Limit    int `json:"limit"`
+}
+
+// Bulkhead limit requests in flight per upstream, a slow dependency can use
+// only its slots instead of all goroutines and connections of the service.
+// A request is in flight until its response body is closed:
+//  bulkhead := fdmiddleware.NewBulkheadTransport(20, 10)
+//  bulkhead.MaxWait = 100 * time.Millisecond
+//  bulkhead.SetLimit("loyalty.foodora.com", 5, 0)
+//  client.Use(bulkhead)
+type Bulkhead struct {
+	// KeyFunc return the upstream of req, by default req.URL.Host. Use it
+	// to group hosts of the same dependency.
+	KeyFunc func(req *http.Request) string
+	// MaxWait is how long a request can wait in the queue for a free slot.
+	// Zero rejects requests right away when the limit is reached.
+	MaxWait time.Duration
+
+	limit     int
+	queueSize int
+
+	mu       sync.Mutex
+	limiters map[string]*limiter
+}
+
+// NewBulkheadTransport accept limit requests in flight for each upstream,
+// and keep up to queueSize requests waiting for MaxWait.
+func NewBulkheadTransport(limit, queueSize int) *Bulkhead {
+	return &Bulkhead{
+		KeyFunc:   hostKey,
+		limit:     limit,
+		queueSize: queueSize,
+		limiters:  make(map[string]*limiter),
+	}
+}
+
+// SetLimit configure a different limit for key, calls in flight are not
+// affected.
+func (b *Bulkhead) SetLimit(key string, limit, queueSize int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if l, ok := b.limiters[key]; ok {
+		l.mu.Lock()
+		l.maxQueue = queueSize
+		l.mu.Unlock()
+		l.setLimit(limit)
+		return
+	}
+
+	b.limiters[key] = newLimiter(limit, queueSize)
+}
+
+// Usage return the usage of each upstream that received requests.
+func (b *Bulkhead) Usage() map[string]BulkheadUsage {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	usage := make(map[string]BulkheadUsage, len(b.limiters))
+	for key, l := range b.limiters {
+		inflight, queued, limit := l.usage()
+		usage[key] = BulkheadUsage{
+			InFlight: inflight,
+			Queued:   queued,
+			Limit:    limit,
+		}
+	}
+
+	return usage
+}
+
+// HealthCheck implements fdhandler.HealthChecker reporting the usage of each
+// upstream.
+func (b *Bulkhead) HealthCheck(ctx context.Context) (interface{}, error) {
+	return b.Usage(), nil
+}
+
+func (b *Bulkhead) limiter(key string) *limiter {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	l, ok := b.limiters[key]
+	if !ok {
+		l = newLimiter(b.limit, b.queueSize)
+		b.limiters[key] = l
+	}
+
+	return l
+}
+
+// Wrap implements ClientMiddleware
+func (b *Bulkhead) Wrap(next http.RoundTripper) http.RoundTripper {
+	return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		keyFunc := b.KeyFunc
+		if keyFunc == nil {
+			keyFunc = hostKey
+		}
+
+		l := b.limiter(keyFunc(req))
+		if !l.acquire(req.Context(), b.MaxWait) {
+			if err := req.Context().Err(); err != nil {
+				return nil, err
+			}
+			return nil, ErrBulkheadFull
+		}
+
+		resp, err := next.RoundTrip(req)
+		if err != nil || resp == nil || resp.Body == nil {
+			l.release()
+			return resp, err
+		}
+
+		resp.Body = &releaseBody{ReadCloser: resp.Body, release: l.release}
+		return resp, nil
+	})
+}
+
+// releaseBody call release once when body is read until the end or closed.
+type releaseBody struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+func (b *releaseBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err == io.EOF {
+		b.once.Do(b.release)
+	}
+	return n, err
+}
+
+func (b *releaseBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+	return err
+}
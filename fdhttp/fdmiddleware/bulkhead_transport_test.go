@@ -0,0 +1,128 @@
+package fdmiddleware_test
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/foodora/go-ranger/fdhttp/fdmiddleware"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBulkhead_PerHost(t *testing.T) {
+	bulkhead := fdmiddleware.NewBulkheadTransport(1, 0)
+
+	transport := bulkhead.Wrap(fdmiddleware.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		return newResponse(http.StatusOK, "ok"), nil
+	}))
+
+	loyalty, _ := http.NewRequest(http.MethodGet, "http://loyalty/", nil)
+	orders, _ := http.NewRequest(http.MethodGet, "http://orders/", nil)
+
+	slow, err := transport.RoundTrip(loyalty)
+	assert.NoError(t, err)
+
+	_, err = transport.RoundTrip(loyalty)
+	assert.Equal(t, fdmiddleware.ErrBulkheadFull, err)
+
+	resp, err := transport.RoundTrip(orders)
+	assert.NoError(t, err)
+	assert.Equal(t, "ok", readBody(t, resp))
+
+	assert.Equal(t, map[string]fdmiddleware.BulkheadUsage{
+		"loyalty": {InFlight: 1, Queued: 0, Limit: 1},
+		"orders":  {InFlight: 0, Queued: 0, Limit: 1},
+	}, bulkhead.Usage())
+
+	slow.Body.Close()
+
+	resp, err = transport.RoundTrip(loyalty)
+	assert.NoError(t, err)
+	resp.Body.Close()
+
+	detail, err := bulkhead.HealthCheck(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, bulkhead.Usage(), detail)
+}
+
+func TestBulkhead_Queue(t *testing.T) {
+	bulkhead := fdmiddleware.NewBulkheadTransport(1, 1)
+	bulkhead.MaxWait = time.Second
+
+	transport := bulkhead.Wrap(fdmiddleware.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		return newResponse(http.StatusOK, "ok"), nil
+	}))
+
+	req, _ := http.NewRequest(http.MethodGet, "http://loyalty/", nil)
+
+	first, err := transport.RoundTrip(req)
+	assert.NoError(t, err)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		resp, err := transport.RoundTrip(req)
+		if assert.NoError(t, err) {
+			readBody(t, resp)
+		}
+	}()
+
+	// wait second request to be queued
+	for bulkhead.Usage()["loyalty"].Queued == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// queue is full
+	_, err = transport.RoundTrip(req)
+	assert.Equal(t, fdmiddleware.ErrBulkheadFull, err)
+
+	readBody(t, first)
+	wg.Wait()
+
+	assert.Equal(t, fdmiddleware.BulkheadUsage{Limit: 1}, bulkhead.Usage()["loyalty"])
+}
+
+func TestBulkhead_QueueTimeout(t *testing.T) {
+	bulkhead := fdmiddleware.NewBulkheadTransport(1, 1)
+	bulkhead.MaxWait = 10 * time.Millisecond
+
+	transport := bulkhead.Wrap(fdmiddleware.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		return newResponse(http.StatusOK, "ok"), nil
+	}))
+
+	req, _ := http.NewRequest(http.MethodGet, "http://loyalty/", nil)
+
+	first, err := transport.RoundTrip(req)
+	assert.NoError(t, err)
+	defer first.Body.Close()
+
+	started := time.Now()
+	_, err = transport.RoundTrip(req)
+	assert.Equal(t, fdmiddleware.ErrBulkheadFull, err)
+	assert.True(t, time.Since(started) >= 10*time.Millisecond)
+}
+
+func TestBulkhead_SetLimitAndKeyFunc(t *testing.T) {
+	bulkhead := fdmiddleware.NewBulkheadTransport(1, 0)
+	bulkhead.KeyFunc = func(req *http.Request) string {
+		return "loyalty"
+	}
+	bulkhead.SetLimit("loyalty", 2, 0)
+
+	transport := bulkhead.Wrap(fdmiddleware.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		return newResponse(http.StatusOK, "ok"), nil
+	}))
+
+	req1, _ := http.NewRequest(http.MethodGet, "http://loyalty-1/", nil)
+	req2, _ := http.NewRequest(http.MethodGet, "http://loyalty-2/", nil)
+
+	_, err := transport.RoundTrip(req1)
+	assert.NoError(t, err)
+	_, err = transport.RoundTrip(req2)
+	assert.NoError(t, err)
+	_, err = transport.RoundTrip(req1)
+	assert.Equal(t, fdmiddleware.ErrBulkheadFull, err)
+}
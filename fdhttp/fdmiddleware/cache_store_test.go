@@ -0,0 +1,70 @@
+package fdmiddleware_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/foodora/go-ranger/fdhttp/fdmiddleware"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryCacheStore_LRU(t *testing.T) {
+	store := fdmiddleware.NewMemoryCacheStore(2)
+
+	store.Set("a", &fdmiddleware.CachedResponse{Body: []byte("a")})
+	store.Set("b", &fdmiddleware.CachedResponse{Body: []byte("b")})
+
+	// a is the most recently used now
+	_, ok := store.Get("a")
+	assert.True(t, ok)
+
+	store.Set("c", &fdmiddleware.CachedResponse{Body: []byte("c")})
+	assert.Equal(t, 2, store.Len())
+
+	_, ok = store.Get("b")
+	assert.False(t, ok)
+
+	resp, ok := store.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, []byte("a"), resp.Body)
+
+	store.Delete("a")
+	_, ok = store.Get("a")
+	assert.False(t, ok)
+}
+
+func TestDiskCacheStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cache")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	store, err := fdmiddleware.NewDiskCacheStore(dir)
+	assert.NoError(t, err)
+
+	stored := time.Now().UTC().Truncate(time.Second)
+	store.Set("http://config/settings", &fdmiddleware.CachedResponse{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Etag": []string{`"v1"`}},
+		Body:       []byte(`{"enabled":true}`),
+		Stored:     stored,
+	})
+
+	// another instance read the same files
+	store, err = fdmiddleware.NewDiskCacheStore(dir)
+	assert.NoError(t, err)
+
+	resp, ok := store.Get("http://config/settings")
+	if assert.True(t, ok) {
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, `"v1"`, resp.Header.Get("ETag"))
+		assert.Equal(t, `{"enabled":true}`, string(resp.Body))
+		assert.True(t, stored.Equal(resp.Stored))
+	}
+
+	store.Delete("http://config/settings")
+	_, ok = store.Get("http://config/settings")
+	assert.False(t, ok)
+}
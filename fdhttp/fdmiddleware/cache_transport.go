@@ -0,0 +1,449 @@
+package fdmiddleware
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CacheHeader is added to responses by CacheTransport, its value is one of
+// HIT, STALE, REVALIDATED or MISS.
+const CacheHeader = "X-Cache"
+
+// DefaultCacheBodySize is the biggest body kept by CacheTransport.
+var DefaultCacheBodySize int64 = 1 << 20
+
+// cacheableStatus can be stored when response has freshness or validators.
+var cacheableStatus = map[int]bool{
+	http.StatusOK:                   true,
+	http.StatusNonAuthoritativeInfo: true,
+	http.StatusNoContent:            true,
+	http.StatusMultipleChoices:      true,
+	http.StatusMovedPermanently:     true,
+	http.StatusNotFound:             true,
+	http.StatusGone:                 true,
+}
+
+// CacheTransport is a private HTTP cache (RFC 7234) for GET requests. It
+// honours Cache-Control max-age, no-store, no-cache, stale-while-revalidate,
+// Expires and Vary, and revalidate stale responses using ETag and
+// Last-Modified. Identical requests in flight are sent only once, and
+// responses to requests with Authorization are cached only when public:
+//  client.Use(fdmiddleware.NewCacheTransport(fdmiddleware.NewMemoryCacheStore(1000)))
+type CacheTransport struct {
+	Store CacheStore
+	// MaxBodySize is the biggest body cached, by default DefaultCacheBodySize.
+	MaxBodySize int64
+	// RevalidateTimeout limit revalidations done in background because of
+	// stale-while-revalidate, by default 10 seconds.
+	RevalidateTimeout time.Duration
+
+	flight flightGroup
+}
+
+// NewCacheTransport create a cache using store, when nil responses are kept in
+// memory without limit.
+func NewCacheTransport(store CacheStore) *CacheTransport {
+	if store == nil {
+		store = NewMemoryCacheStore(0)
+	}
+
+	return &CacheTransport{
+		Store:             store,
+		MaxBodySize:       DefaultCacheBodySize,
+		RevalidateTimeout: 10 * time.Second,
+	}
+}
+
+// cacheFetch is the result of a request shared by coalesced callers.
+type cacheFetch struct {
+	entry  *CachedResponse
+	status string
+	// resp is used only by the caller that did the request when body is
+	// too big to be shared.
+	resp *http.Response
+}
+
+// Wrap implements ClientMiddleware
+func (t *CacheTransport) Wrap(next http.RoundTripper) http.RoundTripper {
+	return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if req.Method != http.MethodGet {
+			return next.RoundTrip(req)
+		}
+
+		reqCC := parseCacheControl(req.Header)
+		if _, ok := reqCC["no-store"]; ok {
+			return next.RoundTrip(req)
+		}
+
+		var key string
+		var entry *CachedResponse
+		if _, ok := reqCC["no-cache"]; ok {
+			key, _ = t.lookup(req)
+		} else {
+			key, entry = t.lookup(req)
+		}
+
+		if entry != nil {
+			age := entryAge(entry)
+			lifetime := freshnessLifetime(entry.Header)
+			respCC := parseCacheControl(entry.Header)
+			_, noCache := respCC["no-cache"]
+
+			if !noCache && age < lifetime {
+				return cachedResponse(req, entry, "HIT"), nil
+			}
+
+			if swr, ok := ccSeconds(respCC, "stale-while-revalidate"); ok && !noCache && age < lifetime+swr {
+				t.revalidate(next, req, key, entry)
+				return cachedResponse(req, entry, "STALE"), nil
+			}
+		}
+
+		return t.fetch(next, req, key, entry)
+	})
+}
+
+// lookup return the key of req in the store and its entry, if there's one
+// that can be used. Responses with Vary are stored by URL and the values of
+// the headers in Vary, with a marker in the URL key listing these headers.
+func (t *CacheTransport) lookup(req *http.Request) (string, *CachedResponse) {
+	key := req.URL.String()
+
+	entry, ok := t.Store.Get(key)
+	if ok && entry.StatusCode == 0 {
+		key = variantKey(key, varyNames(entry.Header), req)
+		entry, ok = t.Store.Get(key)
+	}
+	if !ok || !varyMatches(entry, req) {
+		return key, nil
+	}
+	if req.Header.Get("Authorization") != "" && !isPublic(entry.Header) {
+		return key, nil
+	}
+
+	return key, entry
+}
+
+// fetch do the request, a conditional one if there's a stale entry, sharing
+// the result with identical requests in flight. Authorized requests are not
+// shared, each caller can receive a different response.
+func (t *CacheTransport) fetch(next http.RoundTripper, req *http.Request, key string, entry *CachedResponse) (*http.Response, error) {
+	var result *cacheFetch
+	var err error
+	var shared bool
+
+	if req.Header.Get("Authorization") != "" {
+		result, err = t.roundTrip(next, req, key, entry)
+	} else {
+		var v interface{}
+		v, err, shared = t.flight.do(key, func() (interface{}, error) {
+			return t.roundTrip(next, req, key, entry)
+		})
+		result, _ = v.(*cacheFetch)
+	}
+
+	if shared {
+		// the request was done by another caller, but it can't be used
+		if err != nil && req.Context().Err() == nil && isContextErr(err) {
+			result, err = t.roundTrip(next, req, key, entry)
+		} else if err == nil && (result.entry == nil || !varyMatches(result.entry, req)) {
+			result, err = t.roundTrip(next, req, key, entry)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if result.resp != nil && !shared {
+		result.resp.Header.Set(CacheHeader, result.status)
+		return result.resp, nil
+	}
+
+	return cachedResponse(req, result.entry, result.status), nil
+}
+
+func (t *CacheTransport) roundTrip(next http.RoundTripper, req *http.Request, key string, entry *CachedResponse) (*cacheFetch, error) {
+	r := req
+	if entry != nil {
+		r = cloneRequest(req)
+		if etag := entry.Header.Get("ETag"); etag != "" {
+			r.Header.Set("If-None-Match", etag)
+		}
+		if lastModified := entry.Header.Get("Last-Modified"); lastModified != "" {
+			r.Header.Set("If-Modified-Since", lastModified)
+		}
+	}
+
+	resp, err := next.RoundTrip(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if entry != nil && resp.StatusCode == http.StatusNotModified {
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+
+		updated := *entry
+		updated.Header = cloneHeader(entry.Header)
+		for k, v := range resp.Header {
+			if k == "Content-Length" {
+				continue
+			}
+			updated.Header[k] = append([]string(nil), v...)
+		}
+		updated.Stored = receivedAt(updated.Header)
+		t.Store.Set(key, &updated)
+
+		return &cacheFetch{entry: &updated, status: "REVALIDATED"}, nil
+	}
+
+	maxSize := t.MaxBodySize
+	if maxSize <= 0 {
+		maxSize = DefaultCacheBodySize
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxSize+1))
+	if err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	if int64(len(body)) > maxSize {
+		resp.Body = &multiReadCloser{
+			Reader: io.MultiReader(bytes.NewReader(body), resp.Body),
+			Closer: resp.Body,
+		}
+		return &cacheFetch{status: "MISS", resp: resp}, nil
+	}
+	resp.Body.Close()
+
+	header := cloneHeader(resp.Header)
+	fetched := &CachedResponse{
+		StatusCode:    resp.StatusCode,
+		Header:        header,
+		Body:          body,
+		RequestHeader: varyHeader(resp.Header, req),
+		Stored:        receivedAt(header),
+	}
+
+	if storable(req, resp) {
+		base := req.URL.String()
+		if names := varyNames(resp.Header); len(names) > 0 {
+			t.Store.Set(base, &CachedResponse{Header: http.Header{"Vary": {strings.Join(names, ", ")}}})
+			t.Store.Set(variantKey(base, names, req), fetched)
+		} else {
+			t.Store.Set(base, fetched)
+		}
+	} else if entry != nil {
+		t.Store.Delete(key)
+	}
+
+	return &cacheFetch{entry: fetched, status: "MISS"}, nil
+}
+
+// revalidate update entry in background, the caller already has a response.
+func (t *CacheTransport) revalidate(next http.RoundTripper, req *http.Request, key string, entry *CachedResponse) {
+	timeout := t.RevalidateTimeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	r := cloneRequest(req).WithContext(ctx)
+
+	go func() {
+		defer cancel()
+
+		v, err, _ := t.flight.do(key, func() (interface{}, error) {
+			return t.roundTrip(next, r, key, entry)
+		})
+		if result, ok := v.(*cacheFetch); ok && err == nil && result.resp != nil {
+			result.resp.Body.Close()
+		}
+	}()
+}
+
+func cachedResponse(req *http.Request, entry *CachedResponse, status string) *http.Response {
+	header := cloneHeader(entry.Header)
+	header.Set(CacheHeader, status)
+	if status != "MISS" {
+		header.Set("Age", strconv.Itoa(int(entryAge(entry)/time.Second)))
+	}
+
+	return &http.Response{
+		Status:        strconv.Itoa(entry.StatusCode) + " " + http.StatusText(entry.StatusCode),
+		StatusCode:    entry.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(entry.Body)),
+		ContentLength: int64(len(entry.Body)),
+		Request:       req,
+	}
+}
+
+// storable follow RFC 7234 section 3, a response is stored when it has
+// freshness or validators. Responses to authorized requests must be public.
+func storable(req *http.Request, resp *http.Response) bool {
+	if !cacheableStatus[resp.StatusCode] {
+		return false
+	}
+	if req.Header.Get("Authorization") != "" && !isPublic(resp.Header) {
+		return false
+	}
+
+	if _, ok := parseCacheControl(resp.Header)["no-store"]; ok {
+		return false
+	}
+	if resp.Header.Get("Vary") == "*" {
+		return false
+	}
+
+	return freshnessLifetime(resp.Header) > 0 ||
+		resp.Header.Get("ETag") != "" ||
+		resp.Header.Get("Last-Modified") != ""
+}
+
+// freshnessLifetime use max-age or Expires.
+func freshnessLifetime(header http.Header) time.Duration {
+	cc := parseCacheControl(header)
+	if maxAge, ok := ccSeconds(cc, "max-age"); ok {
+		return maxAge
+	}
+
+	expires, err := http.ParseTime(header.Get("Expires"))
+	if err != nil {
+		return 0
+	}
+
+	date, err := http.ParseTime(header.Get("Date"))
+	if err != nil {
+		return 0
+	}
+
+	return expires.Sub(date)
+}
+
+// receivedAt return when the response was generated, now minus the Age
+// received, and remove Age from header because it's calculated again.
+func receivedAt(header http.Header) time.Time {
+	now := time.Now()
+	if seconds, err := strconv.Atoi(header.Get("Age")); err == nil && seconds > 0 {
+		now = now.Add(-time.Duration(seconds) * time.Second)
+	}
+	header.Del("Age")
+
+	return now
+}
+
+func entryAge(entry *CachedResponse) time.Duration {
+	return time.Since(entry.Stored)
+}
+
+func varyNames(header http.Header) []string {
+	var names []string
+	for _, v := range header["Vary"] {
+		for _, name := range strings.Split(v, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, http.CanonicalHeaderKey(name))
+			}
+		}
+	}
+
+	return names
+}
+
+// variantKey build the key of a response with Vary.
+func variantKey(key string, names []string, req *http.Request) string {
+	var b strings.Builder
+	b.WriteString(key)
+	for _, name := range names {
+		b.WriteString("\n")
+		b.WriteString(name)
+		b.WriteString(": ")
+		b.WriteString(strings.Join(req.Header[name], ","))
+	}
+	return b.String()
+}
+
+func isPublic(header http.Header) bool {
+	_, ok := parseCacheControl(header)["public"]
+	return ok
+}
+
+func varyHeader(header http.Header, req *http.Request) http.Header {
+	names := varyNames(header)
+	if len(names) == 0 {
+		return nil
+	}
+
+	h := make(http.Header, len(names))
+	for _, name := range names {
+		h[name] = append([]string(nil), req.Header[name]...)
+	}
+
+	return h
+}
+
+func varyMatches(entry *CachedResponse, req *http.Request) bool {
+	for _, name := range varyNames(entry.Header) {
+		if strings.Join(entry.RequestHeader[name], ",") != strings.Join(req.Header[name], ",") {
+			return false
+		}
+	}
+
+	return true
+}
+
+// parseCacheControl return directives in lower case with their values.
+func parseCacheControl(header http.Header) map[string]string {
+	cc := make(map[string]string)
+	for _, v := range header["Cache-Control"] {
+		for _, directive := range strings.Split(v, ",") {
+			directive = strings.TrimSpace(directive)
+			if directive == "" {
+				continue
+			}
+
+			name, value := directive, ""
+			if i := strings.Index(directive, "="); i >= 0 {
+				name, value = directive[:i], strings.Trim(directive[i+1:], `"`)
+			}
+			cc[strings.ToLower(strings.TrimSpace(name))] = value
+		}
+	}
+
+	return cc
+}
+
+func ccSeconds(cc map[string]string, directive string) (time.Duration, bool) {
+	v, ok := cc[directive]
+	if !ok {
+		return 0, false
+	}
+
+	seconds, err := strconv.Atoi(v)
+	if err != nil || seconds < 0 {
+		return 0, false
+	}
+
+	return time.Duration(seconds) * time.Second, true
+}
+
+func cloneHeader(header http.Header) http.Header {
+	h := make(http.Header, len(header))
+	for k, v := range header {
+		h[k] = append([]string(nil), v...)
+	}
+	return h
+}
+
+func isContextErr(err error) bool {
+	return err == context.Canceled || err == context.DeadlineExceeded
+}
@@ -0,0 +1,327 @@
+package fdmiddleware_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/foodora/go-ranger/fdhttp/fdmiddleware"
+	"github.com/stretchr/testify/assert"
+)
+
+type cacheUpstream struct {
+	calls   int32
+	handler func(req *http.Request) *http.Response
+}
+
+func (u *cacheUpstream) RoundTrip(req *http.Request) (*http.Response, error) {
+	atomic.AddInt32(&u.calls, 1)
+	return u.handler(req), nil
+}
+
+func (u *cacheUpstream) Calls() int {
+	return int(atomic.LoadInt32(&u.calls))
+}
+
+func cacheResponse(statusCode int, body string, header ...string) *http.Response {
+	resp := &http.Response{
+		StatusCode: statusCode,
+		Header:     http.Header{},
+		Body:       ioutil.NopCloser(strings.NewReader(body)),
+	}
+	for i := 0; i+1 < len(header); i += 2 {
+		resp.Header.Add(header[i], header[i+1])
+	}
+	return resp
+}
+
+func cacheGet(t *testing.T, transport http.RoundTripper, header ...string) (*http.Response, string) {
+	req, _ := http.NewRequest(http.MethodGet, "http://config/settings", nil)
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Add(header[i], header[i+1])
+	}
+
+	resp, err := transport.RoundTrip(req)
+	assert.NoError(t, err)
+	return resp, readBody(t, resp)
+}
+
+func TestCacheTransport_MaxAge(t *testing.T) {
+	upstream := &cacheUpstream{handler: func(req *http.Request) *http.Response {
+		return cacheResponse(http.StatusOK, "settings", "Cache-Control", "max-age=60")
+	}}
+	transport := fdmiddleware.NewCacheTransport(nil).Wrap(upstream)
+
+	resp, body := cacheGet(t, transport)
+	assert.Equal(t, "MISS", resp.Header.Get(fdmiddleware.CacheHeader))
+	assert.Equal(t, "settings", body)
+
+	resp, body = cacheGet(t, transport)
+	assert.Equal(t, "HIT", resp.Header.Get(fdmiddleware.CacheHeader))
+	assert.Equal(t, "0", resp.Header.Get("Age"))
+	assert.Equal(t, "settings", body)
+	assert.Equal(t, 1, upstream.Calls())
+
+	// request asking to not use the cache
+	resp, _ = cacheGet(t, transport, "Cache-Control", "no-cache")
+	assert.Equal(t, "MISS", resp.Header.Get(fdmiddleware.CacheHeader))
+	assert.Equal(t, 2, upstream.Calls())
+}
+
+func TestCacheTransport_NoStore(t *testing.T) {
+	upstream := &cacheUpstream{handler: func(req *http.Request) *http.Response {
+		return cacheResponse(http.StatusOK, "secret", "Cache-Control", "no-store, max-age=60")
+	}}
+	store := fdmiddleware.NewMemoryCacheStore(10)
+	transport := fdmiddleware.NewCacheTransport(store).Wrap(upstream)
+
+	cacheGet(t, transport)
+	cacheGet(t, transport)
+	assert.Equal(t, 2, upstream.Calls())
+	assert.Equal(t, 0, store.Len())
+}
+
+func TestCacheTransport_Revalidate(t *testing.T) {
+	upstream := &cacheUpstream{handler: func(req *http.Request) *http.Response {
+		if req.Header.Get("If-None-Match") == `"v1"` {
+			return cacheResponse(http.StatusNotModified, "", "Cache-Control", "max-age=60")
+		}
+		// Age bigger than max-age makes it stale right away
+		return cacheResponse(http.StatusOK, "v1", "ETag", `"v1"`, "Cache-Control", "max-age=60", "Age", "120")
+	}}
+	transport := fdmiddleware.NewCacheTransport(nil).Wrap(upstream)
+
+	resp, _ := cacheGet(t, transport)
+	assert.Equal(t, "MISS", resp.Header.Get(fdmiddleware.CacheHeader))
+
+	resp, body := cacheGet(t, transport)
+	assert.Equal(t, "REVALIDATED", resp.Header.Get(fdmiddleware.CacheHeader))
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "v1", body)
+
+	// fresh again after revalidation
+	resp, _ = cacheGet(t, transport)
+	assert.Equal(t, "HIT", resp.Header.Get(fdmiddleware.CacheHeader))
+	assert.Equal(t, 2, upstream.Calls())
+}
+
+func TestCacheTransport_LastModified(t *testing.T) {
+	lastModified := "Mon, 02 Jan 2006 15:04:05 GMT"
+	upstream := &cacheUpstream{handler: func(req *http.Request) *http.Response {
+		if req.Header.Get("If-Modified-Since") == lastModified {
+			return cacheResponse(http.StatusNotModified, "")
+		}
+		return cacheResponse(http.StatusOK, "v1", "Last-Modified", lastModified)
+	}}
+	transport := fdmiddleware.NewCacheTransport(nil).Wrap(upstream)
+
+	cacheGet(t, transport)
+	resp, body := cacheGet(t, transport)
+	assert.Equal(t, "REVALIDATED", resp.Header.Get(fdmiddleware.CacheHeader))
+	assert.Equal(t, "v1", body)
+}
+
+func TestCacheTransport_StaleWhileRevalidate(t *testing.T) {
+	var version int32 = 1
+	revalidated := make(chan struct{}, 1)
+	upstream := &cacheUpstream{handler: func(req *http.Request) *http.Response {
+		if atomic.LoadInt32(&version) == 2 {
+			defer func() { revalidated <- struct{}{} }()
+			return cacheResponse(http.StatusOK, "v2", "Cache-Control", "max-age=60")
+		}
+		return cacheResponse(http.StatusOK, "v1", "Cache-Control", "max-age=60, stale-while-revalidate=120", "Age", "61")
+	}}
+	transport := fdmiddleware.NewCacheTransport(nil).Wrap(upstream)
+
+	cacheGet(t, transport)
+	atomic.StoreInt32(&version, 2)
+
+	resp, body := cacheGet(t, transport)
+	assert.Equal(t, "STALE", resp.Header.Get(fdmiddleware.CacheHeader))
+	assert.Equal(t, "v1", body)
+
+	select {
+	case <-revalidated:
+	case <-time.After(time.Second):
+		t.Fatal("response was not revalidated in background")
+	}
+
+	// wait revalidation to be stored
+	for i := 0; i < 100; i++ {
+		resp, body = cacheGet(t, transport)
+		if body == "v2" {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	assert.Equal(t, "HIT", resp.Header.Get(fdmiddleware.CacheHeader))
+	assert.Equal(t, "v2", body)
+}
+
+func TestCacheTransport_Vary(t *testing.T) {
+	upstream := &cacheUpstream{handler: func(req *http.Request) *http.Response {
+		return cacheResponse(http.StatusOK, req.Header.Get("Accept-Language"),
+			"Cache-Control", "max-age=60", "Vary", "Accept-Language")
+	}}
+	transport := fdmiddleware.NewCacheTransport(nil).Wrap(upstream)
+
+	_, body := cacheGet(t, transport, "Accept-Language", "de")
+	assert.Equal(t, "de", body)
+
+	resp, body := cacheGet(t, transport, "Accept-Language", "de")
+	assert.Equal(t, "HIT", resp.Header.Get(fdmiddleware.CacheHeader))
+	assert.Equal(t, "de", body)
+
+	resp, body = cacheGet(t, transport, "Accept-Language", "en")
+	assert.Equal(t, "MISS", resp.Header.Get(fdmiddleware.CacheHeader))
+	assert.Equal(t, "en", body)
+}
+
+func TestCacheTransport_Coalesce(t *testing.T) {
+	release := make(chan struct{})
+	upstream := &cacheUpstream{handler: func(req *http.Request) *http.Response {
+		<-release
+		return cacheResponse(http.StatusOK, "settings", "Cache-Control", "no-cache")
+	}}
+	transport := fdmiddleware.NewCacheTransport(nil).Wrap(upstream)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, body := cacheGet(t, transport)
+			assert.Equal(t, "settings", body)
+		}()
+	}
+
+	// wait the first request to arrive
+	for upstream.Calls() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.True(t, upstream.Calls() < 10, "%d calls", upstream.Calls())
+}
+
+func TestCacheTransport_BodyTooBig(t *testing.T) {
+	upstream := &cacheUpstream{handler: func(req *http.Request) *http.Response {
+		return cacheResponse(http.StatusOK, "0123456789", "Cache-Control", "max-age=60")
+	}}
+	cache := fdmiddleware.NewCacheTransport(nil)
+	cache.MaxBodySize = 4
+	transport := cache.Wrap(upstream)
+
+	_, body := cacheGet(t, transport)
+	assert.Equal(t, "0123456789", body)
+	_, body = cacheGet(t, transport)
+	assert.Equal(t, "0123456789", body)
+	assert.Equal(t, 2, upstream.Calls())
+}
+
+func TestCacheTransport_CoalesceVary(t *testing.T) {
+	release := make(chan struct{})
+	upstream := &cacheUpstream{handler: func(req *http.Request) *http.Response {
+		<-release
+		return cacheResponse(http.StatusOK, req.Header.Get("Accept-Language"),
+			"Cache-Control", "max-age=60", "Vary", "Accept-Language")
+	}}
+	transport := fdmiddleware.NewCacheTransport(nil).Wrap(upstream)
+
+	var wg sync.WaitGroup
+	for _, lang := range []string{"de", "en", "de", "en"} {
+		wg.Add(1)
+		go func(lang string) {
+			defer wg.Done()
+			_, body := cacheGet(t, transport, "Accept-Language", lang)
+			assert.Equal(t, lang, body)
+		}(lang)
+	}
+
+	for upstream.Calls() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	// both variants are cached
+	for _, lang := range []string{"de", "en"} {
+		resp, body := cacheGet(t, transport, "Accept-Language", lang)
+		assert.Equal(t, "HIT", resp.Header.Get(fdmiddleware.CacheHeader))
+		assert.Equal(t, lang, body)
+	}
+}
+
+func TestCacheTransport_Authorization(t *testing.T) {
+	public := false
+	upstream := &cacheUpstream{handler: func(req *http.Request) *http.Response {
+		cc := "max-age=60"
+		if public {
+			cc = "public, max-age=60"
+		}
+		return cacheResponse(http.StatusOK, req.Header.Get("Authorization"), "Cache-Control", cc)
+	}}
+	transport := fdmiddleware.NewCacheTransport(nil).Wrap(upstream)
+
+	_, body := cacheGet(t, transport, "Authorization", "Bearer alice")
+	assert.Equal(t, "Bearer alice", body)
+	resp, body := cacheGet(t, transport, "Authorization", "Bearer bob")
+	assert.Equal(t, "MISS", resp.Header.Get(fdmiddleware.CacheHeader))
+	assert.Equal(t, "Bearer bob", body)
+
+	public = true
+	cacheGet(t, transport, "Authorization", "Bearer alice")
+	resp, body = cacheGet(t, transport, "Authorization", "Bearer bob")
+	assert.Equal(t, "HIT", resp.Header.Get(fdmiddleware.CacheHeader))
+	assert.Equal(t, "Bearer alice", body)
+}
+
+func TestCacheTransport_CoalescePanic(t *testing.T) {
+	release := make(chan struct{})
+	upstream := &cacheUpstream{handler: func(req *http.Request) *http.Response {
+		<-release
+		panic("upstream panic")
+	}}
+	transport := fdmiddleware.NewCacheTransport(nil).Wrap(upstream)
+
+	leader := make(chan interface{})
+	go func() {
+		defer func() { leader <- recover() }()
+		req, _ := http.NewRequest(http.MethodGet, "http://config/settings", nil)
+		transport.RoundTrip(req)
+	}()
+
+	for upstream.Calls() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	waiter := make(chan error)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				waiter <- fmt.Errorf("%v", r)
+			}
+		}()
+		req, _ := http.NewRequest(http.MethodGet, "http://config/settings", nil)
+		_, err := transport.RoundTrip(req)
+		waiter <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+
+	assert.Equal(t, "upstream panic", <-leader)
+	select {
+	case err := <-waiter:
+		assert.Error(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("waiter is blocked after panic")
+	}
+}
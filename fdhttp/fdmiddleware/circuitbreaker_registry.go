@@ -0,0 +1,126 @@
+package fdmiddleware
+
+import (
+	"context"
+	"net/http"
+	"sync"
+
+	"github.com/foodora/go-ranger/fdbackoff"
+)
+
+// CircuitBreakerRegistry keep one circuit breaker per key, by default the
+// request host, so a dependency that is down doesn't open the circuit for
+// all the others:
+//  registry := fdmiddleware.NewCircuitBreakerRegistry(fdbackoff.Exponential(time.Second), 0.5, 20)
+//  registry.OnStateChange = func(key string, from, to fdmiddleware.CircuitState) {
+//      log.Printf("circuit %s changed from %s to %s", key, from, to)
+//  }
+//  client.Use(registry)
+//  healthCheck.Register("circuits", registry)
+type CircuitBreakerRegistry struct {
+	// KeyFunc return which circuit is used by req, by default req.URL.Host.
+	KeyFunc func(req *http.Request) string
+	// IsFailure is used by circuits created after it's set, by default
+	// DefaultCircuitFailure.
+	IsFailure func(resp *http.Response, err error) bool
+	// OnStateChange is called when any circuit change its state.
+	OnStateChange func(key string, from, to CircuitState)
+
+	backoffFunc fdbackoff.Func
+	rate        float64
+	minSamples  int64
+
+	mu       sync.Mutex
+	circuits map[string]*Circuit
+}
+
+// NewCircuitBreakerRegistry receive the same parameters of
+// NewCircuitBreakerTransport, they are used for each circuit created.
+func NewCircuitBreakerRegistry(backoffFunc fdbackoff.Func, rate float64, minSamples int64) *CircuitBreakerRegistry {
+	return &CircuitBreakerRegistry{
+		KeyFunc:     hostKey,
+		IsFailure:   DefaultCircuitFailure,
+		backoffFunc: backoffFunc,
+		rate:        rate,
+		minSamples:  minSamples,
+		circuits:    make(map[string]*Circuit),
+	}
+}
+
+func hostKey(req *http.Request) string {
+	return req.URL.Host
+}
+
+// Circuit return the circuit of key, creating it if needed.
+func (r *CircuitBreakerRegistry) Circuit(key string) *Circuit {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if c, ok := r.circuits[key]; ok {
+		return c
+	}
+
+	c := NewCircuitBreakerTransport(r.backoffFunc, r.rate, r.minSamples)
+	if r.IsFailure != nil {
+		c.IsFailure = r.IsFailure
+	}
+	c.OnStateChange = func(from, to CircuitState) {
+		if r.OnStateChange != nil {
+			r.OnStateChange(key, from, to)
+		}
+	}
+
+	r.circuits[key] = c
+	return c
+}
+
+// Configure updates the error rate of all circuits, including the ones
+// created later.
+func (r *CircuitBreakerRegistry) Configure(rate float64, minSamples int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.rate = rate
+	r.minSamples = minSamples
+	for _, c := range r.circuits {
+		c.Configure(rate, minSamples)
+	}
+}
+
+// States return the state of each circuit created.
+func (r *CircuitBreakerRegistry) States() map[string]CircuitState {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	states := make(map[string]CircuitState, len(r.circuits))
+	for key, c := range r.circuits {
+		states[key] = c.State()
+	}
+
+	return states
+}
+
+// HealthCheck implements fdhandler.HealthChecker reporting the state of
+// each circuit. Open circuits don't make the check fail, because the service
+// can still work without some dependencies.
+func (r *CircuitBreakerRegistry) HealthCheck(ctx context.Context) (interface{}, error) {
+	states := r.States()
+
+	detail := make(map[string]string, len(states))
+	for key, state := range states {
+		detail[key] = state.String()
+	}
+
+	return detail, nil
+}
+
+func (r *CircuitBreakerRegistry) Wrap(next http.RoundTripper) http.RoundTripper {
+	return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		keyFunc := r.KeyFunc
+		if keyFunc == nil {
+			keyFunc = hostKey
+		}
+
+		return r.Circuit(keyFunc(req)).Wrap(next).RoundTrip(req)
+	})
+}
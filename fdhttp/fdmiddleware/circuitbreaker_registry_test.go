@@ -0,0 +1,167 @@
+package fdmiddleware_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/foodora/go-ranger/fdbackoff"
+	"github.com/foodora/go-ranger/fdhttp/fdmiddleware"
+	"github.com/stretchr/testify/assert"
+)
+
+type stateChange struct {
+	key      string
+	from, to fdmiddleware.CircuitState
+}
+
+func TestCircuitBreakerRegistry_PerHost(t *testing.T) {
+	registry := fdmiddleware.NewCircuitBreakerRegistry(fdbackoff.Constant(time.Minute), 1.0, 3)
+
+	var changes []stateChange
+	registry.OnStateChange = func(key string, from, to fdmiddleware.CircuitState) {
+		changes = append(changes, stateChange{key, from, to})
+	}
+
+	transport := registry.Wrap(fdmiddleware.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if req.URL.Host == "down" {
+			return nil, errors.New("connection refused")
+		}
+		return &http.Response{StatusCode: http.StatusOK}, nil
+	}))
+
+	down, _ := http.NewRequest(http.MethodGet, "http://down/", nil)
+	up, _ := http.NewRequest(http.MethodGet, "http://up/", nil)
+
+	for i := 0; i < 3; i++ {
+		transport.RoundTrip(down)
+		transport.RoundTrip(up)
+	}
+
+	_, err := transport.RoundTrip(down)
+	assert.Equal(t, fdmiddleware.ErrCircuitOpen, err)
+
+	resp, err := transport.RoundTrip(up)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	assert.Equal(t, map[string]fdmiddleware.CircuitState{
+		"down": fdmiddleware.CircuitOpen,
+		"up":   fdmiddleware.CircuitClosed,
+	}, registry.States())
+	assert.Equal(t, []stateChange{
+		{"down", fdmiddleware.CircuitClosed, fdmiddleware.CircuitOpen},
+	}, changes)
+
+	detail, err := registry.HealthCheck(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"down": "open", "up": "closed"}, detail)
+}
+
+func TestCircuitBreakerRegistry_HalfOpen(t *testing.T) {
+	registry := fdmiddleware.NewCircuitBreakerRegistry(fdbackoff.Constant(time.Millisecond), 1.0, 2)
+
+	var changes []stateChange
+	registry.OnStateChange = func(key string, from, to fdmiddleware.CircuitState) {
+		changes = append(changes, stateChange{key, from, to})
+	}
+
+	fail := true
+	transport := registry.Wrap(fdmiddleware.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if fail {
+			return &http.Response{StatusCode: http.StatusServiceUnavailable}, nil
+		}
+		return &http.Response{StatusCode: http.StatusOK}, nil
+	}))
+
+	req, _ := http.NewRequest(http.MethodGet, "http://localhost/", nil)
+	transport.RoundTrip(req)
+	transport.RoundTrip(req)
+	assert.Equal(t, fdmiddleware.CircuitOpen, registry.Circuit("localhost").State())
+
+	time.Sleep(5 * time.Millisecond)
+	fail = false
+
+	_, err := transport.RoundTrip(req)
+	assert.NoError(t, err)
+	assert.Equal(t, fdmiddleware.CircuitClosed, registry.Circuit("localhost").State())
+
+	assert.Equal(t, []stateChange{
+		{"localhost", fdmiddleware.CircuitClosed, fdmiddleware.CircuitOpen},
+		{"localhost", fdmiddleware.CircuitOpen, fdmiddleware.CircuitHalfOpen},
+		{"localhost", fdmiddleware.CircuitHalfOpen, fdmiddleware.CircuitClosed},
+	}, changes)
+}
+
+func TestCircuitBreakerRegistry_KeyFuncAndIsFailure(t *testing.T) {
+	registry := fdmiddleware.NewCircuitBreakerRegistry(fdbackoff.Constant(time.Minute), 1.0, 2)
+	registry.KeyFunc = func(req *http.Request) string {
+		return req.Header.Get("X-Service")
+	}
+	registry.IsFailure = func(resp *http.Response, err error) bool {
+		return err != nil || resp.StatusCode == http.StatusTooManyRequests
+	}
+
+	transport := registry.Wrap(fdmiddleware.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if req.Header.Get("X-Service") == "orders" {
+			return &http.Response{StatusCode: http.StatusTooManyRequests}, nil
+		}
+		return &http.Response{StatusCode: http.StatusInternalServerError}, nil
+	}))
+
+	orders, _ := http.NewRequest(http.MethodGet, "http://localhost/", nil)
+	orders.Header.Set("X-Service", "orders")
+	users, _ := http.NewRequest(http.MethodGet, "http://localhost/", nil)
+	users.Header.Set("X-Service", "users")
+
+	for i := 0; i < 3; i++ {
+		transport.RoundTrip(orders)
+		_, err := transport.RoundTrip(users)
+		assert.NoError(t, err)
+	}
+
+	assert.Equal(t, map[string]fdmiddleware.CircuitState{
+		"orders": fdmiddleware.CircuitOpen,
+		"users":  fdmiddleware.CircuitClosed,
+	}, registry.States())
+}
+
+func TestCircuitBreakerRegistry_StateOnQuery(t *testing.T) {
+	registry := fdmiddleware.NewCircuitBreakerRegistry(fdbackoff.Constant(50*time.Millisecond), 1.0, 2)
+
+	var changes []stateChange
+	registry.OnStateChange = func(key string, from, to fdmiddleware.CircuitState) {
+		changes = append(changes, stateChange{key, from, to})
+	}
+
+	transport := registry.Wrap(fdmiddleware.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		time.Sleep(time.Millisecond)
+		return nil, errors.New("connection refused")
+	}))
+
+	// concurrent failures report the transition once
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req, _ := http.NewRequest(http.MethodGet, "http://down/", nil)
+			transport.RoundTrip(req)
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, []stateChange{
+		{"down", fdmiddleware.CircuitClosed, fdmiddleware.CircuitOpen},
+	}, changes)
+	assert.Equal(t, fdmiddleware.CircuitOpen, registry.Circuit("down").State())
+
+	// state is read when queried, without calls after the backoff
+	time.Sleep(60 * time.Millisecond)
+	detail, err := registry.HealthCheck(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"down": "half-open"}, detail)
+}
@@ -1,9 +1,11 @@
 package fdmiddleware
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/foodora/go-ranger/fdbackoff"
@@ -17,9 +19,53 @@ var CircuitWindowTime = 10 * time.Second
 // ErrCircuitOpen ...
 var ErrCircuitOpen = circuit.ErrBreakerOpen
 
+// CircuitState is the state of a circuit breaker.
+type CircuitState int
+
+const (
+	// CircuitClosed let all calls pass.
+	CircuitClosed CircuitState = iota
+	// CircuitOpen reject all calls with ErrCircuitOpen.
+	CircuitOpen
+	// CircuitHalfOpen let one call pass to check if the circuit can be closed.
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	}
+	return "closed"
+}
+
+// DefaultCircuitFailure consider errors and status code >= 500 as failure.
+func DefaultCircuitFailure(resp *http.Response, err error) bool {
+	return err != nil || (resp != nil && resp.StatusCode >= 500)
+}
+
 type Circuit struct {
 	mu      sync.RWMutex
 	breaker *circuit.Breaker
+
+	// IsFailure decide which calls count as failure, by default
+	// DefaultCircuitFailure.
+	IsFailure func(resp *http.Response, err error) bool
+	// OnStateChange is called when circuit change its state, use it to
+	// log or send metrics. Calls are not concurrent.
+	OnStateChange func(from, to CircuitState)
+
+	backoff *circuitBreakerBackoff
+	// failedAt is the last failure in unix nanoseconds, an open circuit is
+	// half-open after backoff.
+	failedAt int64
+
+	// stateMu serialize transitions and OnStateChange calls, state is the
+	// last state reported.
+	stateMu sync.Mutex
+	state   CircuitState
 }
 
 // NewCircuitBreakerTransport receive a backoffFunc that will be used to decide
@@ -28,17 +74,22 @@ type Circuit struct {
 // rate is calculated over a sliding window of 10 secs (by default, check DefaultWindowTime).
 // Circuit will not open until there have been at least minSamples events.
 func NewCircuitBreakerTransport(backoffFunc fdbackoff.Func, rate float64, minSamples int64) *Circuit {
+	backoff := &circuitBreakerBackoff{
+		attempt: 1,
+		fn:      backoffFunc,
+	}
 	breaker := circuit.NewBreakerWithOptions(&circuit.Options{
-		BackOff: &circuitBreakerBackoff{
-			attempt: 1,
-			fn:      backoffFunc,
-		},
+		BackOff:       backoff,
 		ShouldTrip:    nil,
 		WindowTime:    CircuitWindowTime,
 		WindowBuckets: circuit.DefaultWindowBuckets,
 	})
 
-	circuit := &Circuit{breaker: breaker}
+	circuit := &Circuit{
+		breaker:   breaker,
+		backoff:   backoff,
+		IsFailure: DefaultCircuitFailure,
+	}
 	circuit.Configure(rate, minSamples)
 
 	return circuit
@@ -58,39 +109,121 @@ func (c *Circuit) Configure(rate float64, minSamples int64) {
 	c.mu.Unlock()
 }
 
+// State return the current state of the circuit, an open circuit is
+// half-open when its backoff has passed and the next call can be done.
+func (c *Circuit) State() CircuitState {
+	if !c.breaker.Tripped() {
+		return CircuitClosed
+	}
+
+	wait := c.backoff.wait()
+	failedAt := time.Unix(0, atomic.LoadInt64(&c.failedAt))
+	if wait != fdbackoff.Stop && time.Since(failedAt) > wait {
+		return CircuitHalfOpen
+	}
+	return CircuitOpen
+}
+
 func (c *Circuit) Wrap(next http.RoundTripper) http.RoundTripper {
 	return RoundTripperFunc(func(req *http.Request) (resp *http.Response, err error) {
 		c.mu.RLock()
 		defer c.mu.RUnlock()
 
+		wasTripped := c.breaker.Tripped()
+		var called bool
+
+		var failed bool
+
 		breakerErr := c.breaker.CallContext(req.Context(), func() error {
+			called = true
+
 			resp, err = next.RoundTrip(req)
+			if !c.isFailure(resp, err) {
+				return nil
+			}
+			failed = true
+
 			if err != nil {
 				return err
 			}
-
-			if resp != nil && resp.StatusCode >= 500 {
+			if resp != nil {
 				return fmt.Errorf("%s %s: %s", req.Method, req.URL.String(), http.StatusText(resp.StatusCode))
 			}
-
-			return nil
+			return fmt.Errorf("%s %s: failed", req.Method, req.URL.String())
 		}, 0)
 
 		if err == nil && breakerErr != nil {
 			err = breakerErr
 		}
+		if failed && req.Context().Err() != context.Canceled {
+			// breaker doesn't count canceled calls
+			atomic.StoreInt64(&c.failedAt, time.Now().UnixNano())
+		}
+
+		c.updateState(wasTripped, called)
 
 		return
 	})
 }
 
+func (c *Circuit) isFailure(resp *http.Response, err error) bool {
+	if c.IsFailure == nil {
+		return DefaultCircuitFailure(resp, err)
+	}
+	return c.IsFailure(resp, err)
+}
+
+// updateState find out the state transitions after a call, a call done when
+// circuit was tripped means that it was half-open. Concurrent calls report
+// each transition once.
+func (c *Circuit) updateState(wasTripped, called bool) {
+	c.stateMu.Lock()
+	defer c.stateMu.Unlock()
+
+	if wasTripped && called {
+		c.setState(CircuitHalfOpen)
+	}
+
+	if c.breaker.Tripped() {
+		c.setState(CircuitOpen)
+	} else {
+		c.setState(CircuitClosed)
+	}
+}
+
+// setState need to be called with stateMu.
+func (c *Circuit) setState(state CircuitState) {
+	from := c.state
+	c.state = state
+
+	if from != state && c.OnStateChange != nil {
+		c.OnStateChange(from, state)
+	}
+}
+
 type circuitBreakerBackoff struct {
 	attempt int
 	fn      fdbackoff.Func
+
+	mu      sync.Mutex
+	current time.Duration
 }
 
 func (b *circuitBreakerBackoff) NextBackOff() time.Duration {
-	return b.fn(b.attempt)
+	d := b.fn(b.attempt)
+
+	b.mu.Lock()
+	b.current = d
+	b.mu.Unlock()
+
+	return d
+}
+
+// wait return the last backoff used by the breaker.
+func (b *circuitBreakerBackoff) wait() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.current
 }
 
 func (b *circuitBreakerBackoff) Reset() {
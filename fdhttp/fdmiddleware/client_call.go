@@ -0,0 +1,250 @@
+package fdmiddleware
+
+import (
+	"bytes"
+	"crypto/tls"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// UnknownRoute is the route of requests without route template.
+const UnknownRoute = "unknown"
+
+// ClientTiming split the latency of an outgoing request, phases that didn't
+// happen, like DNS and connect of a reused connection, are zero.
+type ClientTiming struct {
+	DNS     time.Duration
+	Connect time.Duration
+	TLS     time.Duration
+	// TTFB is the time until the first byte of the response.
+	TTFB time.Duration
+	// Total is the time until the response headers, reading the body is
+	// not included.
+	Total      time.Duration
+	ConnReused bool
+}
+
+// ClientCall describe an outgoing request, it's sent to client logs and
+// metrics when the response body is closed or the request fails.
+type ClientCall struct {
+	Method string
+	Host   string
+	// Route is the route template set by SetRouteTemplate, or UnknownRoute.
+	Route string
+	// URL and RequestHeader have secrets redacted.
+	URL           string
+	RequestHeader http.Header
+	StatusCode    int
+	Err           error
+	// Attempt is the retry attempt, 0 outside of RetryPolicyTransport.
+	Attempt       int
+	RequestBytes  int64
+	ResponseBytes int64
+	Timing        ClientTiming
+	// RequestBody and ResponseBody are filled only when bodies are logged,
+	// json fields are redacted.
+	RequestBody  string
+	ResponseBody string
+}
+
+// Fields return the call as log fields.
+func (c *ClientCall) Fields() map[string]interface{} {
+	fields := map[string]interface{}{
+		"http_method":    c.Method,
+		"http_host":      c.Host,
+		"http_route":     c.Route,
+		"http_url":       c.URL,
+		"http_status":    c.StatusCode,
+		"request_bytes":  c.RequestBytes,
+		"response_bytes": c.ResponseBytes,
+		"duration_ms":    milliseconds(c.Timing.Total),
+		"dns_ms":         milliseconds(c.Timing.DNS),
+		"connect_ms":     milliseconds(c.Timing.Connect),
+		"tls_ms":         milliseconds(c.Timing.TLS),
+		"ttfb_ms":        milliseconds(c.Timing.TTFB),
+		"conn_reused":    c.Timing.ConnReused,
+	}
+
+	if c.Attempt > 0 {
+		fields["retry_attempt"] = c.Attempt
+	}
+	if c.Err != nil {
+		fields["error"] = c.Err.Error()
+	}
+	if c.RequestBody != "" {
+		fields["request_body"] = c.RequestBody
+	}
+	if c.ResponseBody != "" {
+		fields["response_body"] = c.ResponseBody
+	}
+
+	return fields
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// observeCall send req measuring it with httptrace, done is called once when
+// the response body is read until the end or closed, or when req fails.
+// Bodies up to maxBody bytes are kept in call, bigger ones are skipped
+// because they can't be redacted.
+func observeCall(next http.RoundTripper, req *http.Request, redactor *Redactor, maxBody int64, done func(call *ClientCall)) (*http.Response, error) {
+	route := RouteTemplate(req.Context())
+	if route == "" {
+		// paths have ids, they would create a metric for each one
+		route = UnknownRoute
+	}
+
+	call := &ClientCall{
+		Method:        req.Method,
+		Host:          req.URL.Host,
+		Route:         route,
+		URL:           redactor.URL(req.URL),
+		RequestHeader: redactor.Header(req.Header),
+		Attempt:       RetryAttempt(req.Context()),
+	}
+	if req.ContentLength > 0 {
+		call.RequestBytes = req.ContentLength
+	}
+	if maxBody > 0 && req.GetBody != nil && req.ContentLength <= maxBody {
+		if body, err := req.GetBody(); err == nil {
+			b, err := ioutil.ReadAll(io.LimitReader(body, maxBody+1))
+			body.Close()
+			if err == nil && int64(len(b)) <= maxBody {
+				call.RequestBody = redactor.Body(req.Header, b)
+			}
+		}
+	}
+
+	tracer := &clientTracer{}
+	started := time.Now()
+	r := req.WithContext(httptrace.WithClientTrace(req.Context(), tracer.trace(started)))
+
+	resp, err := next.RoundTrip(r)
+	call.Timing = tracer.timing()
+	call.Timing.Total = time.Since(started)
+
+	if err != nil || resp == nil || resp.Body == nil {
+		call.Err = err
+		if resp != nil {
+			call.StatusCode = resp.StatusCode
+		}
+		done(call)
+		return resp, err
+	}
+
+	call.StatusCode = resp.StatusCode
+	body := &countingBody{ReadCloser: resp.Body, max: maxBody}
+	body.done = func() {
+		call.ResponseBytes = body.n
+		// partial bodies are not json, they can't be redacted
+		if maxBody > 0 && body.eof && body.n <= maxBody {
+			call.ResponseBody = redactor.Body(resp.Header, body.buf.Bytes())
+		}
+		done(call)
+	}
+	resp.Body = body
+
+	return resp, nil
+}
+
+// clientTracer collect timings from httptrace hooks, they can be called
+// from other goroutines.
+type clientTracer struct {
+	mu           sync.Mutex
+	dnsStart     time.Time
+	connectStart time.Time
+	tlsStart     time.Time
+	t            ClientTiming
+}
+
+func (c *clientTracer) trace(started time.Time) *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			c.mu.Lock()
+			c.dnsStart = time.Now()
+			c.mu.Unlock()
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			c.mu.Lock()
+			c.t.DNS = time.Since(c.dnsStart)
+			c.mu.Unlock()
+		},
+		ConnectStart: func(network, addr string) {
+			c.mu.Lock()
+			c.connectStart = time.Now()
+			c.mu.Unlock()
+		},
+		ConnectDone: func(network, addr string, err error) {
+			c.mu.Lock()
+			c.t.Connect = time.Since(c.connectStart)
+			c.mu.Unlock()
+		},
+		TLSHandshakeStart: func() {
+			c.mu.Lock()
+			c.tlsStart = time.Now()
+			c.mu.Unlock()
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			c.mu.Lock()
+			c.t.TLS = time.Since(c.tlsStart)
+			c.mu.Unlock()
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			c.mu.Lock()
+			c.t.ConnReused = info.Reused
+			c.mu.Unlock()
+		},
+		GotFirstResponseByte: func() {
+			c.mu.Lock()
+			c.t.TTFB = time.Since(started)
+			c.mu.Unlock()
+		},
+	}
+}
+
+func (c *clientTracer) timing() ClientTiming {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.t
+}
+
+// countingBody count bytes read, keeping up to max bytes, and call done once
+// when body is read until the end or closed.
+type countingBody struct {
+	io.ReadCloser
+	n    int64
+	eof  bool
+	max  int64
+	buf  bytes.Buffer
+	once sync.Once
+	done func()
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if keep := b.max - b.n; keep > 0 {
+		if keep > int64(n) {
+			keep = int64(n)
+		}
+		b.buf.Write(p[:keep])
+	}
+	b.n += int64(n)
+
+	if err == io.EOF {
+		b.eof = true
+		b.once.Do(b.done)
+	}
+	return n, err
+}
+
+func (b *countingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.done)
+	return err
+}
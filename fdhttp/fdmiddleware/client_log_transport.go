@@ -0,0 +1,63 @@
+package fdmiddleware
+
+import (
+	"bytes"
+	"net/http"
+	"text/template"
+)
+
+// ClientLogFormat is the default template used by ClientLogTransport.SetLogger
+var ClientLogFormat = "{{.Method}} {{.URL}} {{.StatusCode}} [{{.Timing.Total}}] {{.ResponseBytes}} bytes{{if .Err}}: {{.Err}}{{end}}"
+
+// ClientLogTransport log outgoing calls, with secrets redacted:
+//  logTransport := fdmiddleware.NewClientLogTransport()
+//  logTransport.SetLogger(log.New(os.Stdout, "", log.LstdFlags))
+//  client.Use(logTransport)
+// A call is logged when its response body is closed, don't forget to close it.
+type ClientLogTransport struct {
+	Redactor *Redactor
+	// MaxBodySize log request and response bodies up to this size, zero
+	// doesn't log bodies.
+	MaxBodySize int64
+
+	fn func(call *ClientCall)
+}
+
+// NewClientLogTransport create a log transport redacting DefaultRedactHeaders.
+func NewClientLogTransport() *ClientLogTransport {
+	return &ClientLogTransport{
+		Redactor: NewRedactor(),
+	}
+}
+
+// SetLogger set a Logger to send logs using ClientLogFormat.
+func (t *ClientLogTransport) SetLogger(log Logger) {
+	tmpl := template.Must(template.New("client-log-template").Parse(ClientLogFormat))
+
+	t.fn = func(call *ClientCall) {
+		var b bytes.Buffer
+		tmpl.Execute(&b, call)
+		log.Printf("%s", b.String())
+	}
+}
+
+// SetLoggerFunc set a function that is called for each call.
+func (t *ClientLogTransport) SetLoggerFunc(fn func(call *ClientCall)) {
+	t.fn = fn
+}
+
+// Wrap implements ClientMiddleware
+func (t *ClientLogTransport) Wrap(next http.RoundTripper) http.RoundTripper {
+	if t.fn == nil {
+		panic("Using ClientLogTransport without set a log function (See: SetLogger or SetLoggerFunc)")
+	}
+
+	redactor := t.Redactor
+	if redactor == nil {
+		redactor = NewRedactor()
+	}
+
+	return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		return observeCall(next, req, redactor, t.MaxBodySize, t.fn)
+	})
+}
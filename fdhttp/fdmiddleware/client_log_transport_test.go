@@ -0,0 +1,141 @@
+package fdmiddleware_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/foodora/go-ranger/fdhttp/fdmiddleware"
+	"github.com/stretchr/testify/assert"
+)
+
+// bufferLogger can be written by a server while the test reads it.
+type bufferLogger struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (l *bufferLogger) Printf(format string, v ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	fmt.Fprintf(&l.buf, format, v...)
+}
+
+func (l *bufferLogger) String() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.buf.String()
+}
+
+func (l *bufferLogger) Reset() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.buf.Reset()
+}
+
+func TestClientLogTransport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(`{"id":10,"token":"k3y"}`))
+	}))
+	defer server.Close()
+
+	logTransport := fdmiddleware.NewClientLogTransport()
+	logTransport.Redactor.BodyFields = []string{"password", "token"}
+	logTransport.MaxBodySize = 1024
+
+	var calls []*fdmiddleware.ClientCall
+	logTransport.SetLoggerFunc(func(call *fdmiddleware.ClientCall) {
+		calls = append(calls, call)
+	})
+
+	client := &http.Client{Transport: logTransport.Wrap(http.DefaultTransport)}
+
+	req, _ := http.NewRequest(http.MethodPost, server.URL+"/users/10/orders", strings.NewReader(`{"password":"hunter2"}`))
+	req.Header.Set("Authorization", "Bearer secret")
+	req = req.WithContext(fdmiddleware.SetRouteTemplate(context.Background(), "/users/:id/orders"))
+
+	resp, err := client.Do(req)
+	assert.NoError(t, err)
+	ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if assert.Len(t, calls, 1) {
+		call := calls[0]
+		assert.Equal(t, http.MethodPost, call.Method)
+		assert.Equal(t, strings.TrimPrefix(server.URL, "http://"), call.Host)
+		assert.Equal(t, "/users/:id/orders", call.Route)
+		assert.Equal(t, http.StatusOK, call.StatusCode)
+		assert.Equal(t, int64(22), call.RequestBytes)
+		assert.Equal(t, int64(23), call.ResponseBytes)
+		assert.Equal(t, fdmiddleware.RedactedValue, call.RequestHeader.Get("Authorization"))
+		assert.JSONEq(t, `{"password":"REDACTED"}`, call.RequestBody)
+		assert.JSONEq(t, `{"id":10,"token":"REDACTED"}`, call.ResponseBody)
+		assert.True(t, call.Timing.Total > 0)
+		assert.True(t, call.Timing.TTFB > 0)
+		assert.True(t, call.Timing.Connect > 0)
+		assert.False(t, call.Timing.ConnReused)
+
+		fields := call.Fields()
+		assert.Equal(t, "/users/:id/orders", fields["http_route"])
+		assert.Equal(t, http.StatusOK, fields["http_status"])
+		assert.NotContains(t, fields, "error")
+	}
+}
+
+func TestClientLogTransport_SetLogger(t *testing.T) {
+	logger := &bufferLogger{}
+	logTransport := fdmiddleware.NewClientLogTransport()
+	logTransport.SetLogger(logger)
+
+	expectedErr := errors.New("connection refused")
+	transport := logTransport.Wrap(fdmiddleware.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		return nil, expectedErr
+	}))
+
+	req, _ := http.NewRequest(http.MethodGet, "http://partner/orders?page=1", nil)
+	_, err := transport.RoundTrip(req)
+	assert.Equal(t, expectedErr, err)
+
+	assert.Contains(t, logger.String(), "GET http://partner/orders?page=1 0 [")
+	assert.Contains(t, logger.String(), "0 bytes: connection refused")
+}
+
+func TestClientLogTransport_RetryAttempt(t *testing.T) {
+	var call *fdmiddleware.ClientCall
+	logTransport := fdmiddleware.NewClientLogTransport()
+	logTransport.SetLoggerFunc(func(c *fdmiddleware.ClientCall) {
+		call = c
+	})
+
+	transport := logTransport.Wrap(fdmiddleware.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		return newResponse(http.StatusOK, "ok"), nil
+	}))
+
+	req, _ := http.NewRequest(http.MethodGet, "http://partner/orders", nil)
+	req = req.WithContext(fdmiddleware.SetRetryAttempt(req.Context(), 2))
+
+	resp, err := transport.RoundTrip(req)
+	assert.NoError(t, err)
+	assert.Nil(t, call, "call is logged when body is closed")
+
+	resp.Body.Close()
+	if assert.NotNil(t, call) {
+		assert.Equal(t, 2, call.Attempt)
+		assert.Equal(t, fdmiddleware.UnknownRoute, call.Route, "paths are not used as route")
+		assert.Empty(t, call.ResponseBody)
+		assert.Equal(t, 2, call.Fields()["retry_attempt"])
+	}
+}
+
+func TestClientLogTransport_WithoutLogger(t *testing.T) {
+	assert.Panics(t, func() {
+		fdmiddleware.NewClientLogTransport().Wrap(http.DefaultTransport)
+	})
+}
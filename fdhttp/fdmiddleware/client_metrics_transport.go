@@ -0,0 +1,142 @@
+package fdmiddleware
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Metrics sent by ClientMetricsTransport, all of them have the labels
+// method, host, route and status ("error" when the request failed).
+const (
+	MetricClientRequests      = "http_client_requests_total"
+	MetricClientDuration      = "http_client_request_duration"
+	MetricClientDNS           = "http_client_dns_duration"
+	MetricClientConnect       = "http_client_connect_duration"
+	MetricClientTLS           = "http_client_tls_duration"
+	MetricClientTTFB          = "http_client_ttfb_duration"
+	MetricClientRequestBytes  = "http_client_request_bytes_total"
+	MetricClientResponseBytes = "http_client_response_bytes_total"
+)
+
+// MetricsRecorder is a metrics registry, implement it to send metrics to
+// your backend.
+type MetricsRecorder interface {
+	AddCounter(name string, labels map[string]string, value float64)
+	ObserveDuration(name string, labels map[string]string, d time.Duration)
+}
+
+// ClientMetricsTransport measure outgoing calls:
+//  metrics := fdmiddleware.NewMemoryMetrics()
+//  client.Use(fdmiddleware.NewClientMetricsTransport(metrics))
+// A call is measured when its response body is closed, don't forget to
+// close it.
+type ClientMetricsTransport struct {
+	recorder MetricsRecorder
+}
+
+// NewClientMetricsTransport send metrics to recorder.
+func NewClientMetricsTransport(recorder MetricsRecorder) *ClientMetricsTransport {
+	return &ClientMetricsTransport{recorder: recorder}
+}
+
+// Wrap implements ClientMiddleware
+func (t *ClientMetricsTransport) Wrap(next http.RoundTripper) http.RoundTripper {
+	redactor := &Redactor{}
+
+	return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		return observeCall(next, req, redactor, 0, t.record)
+	})
+}
+
+func (t *ClientMetricsTransport) record(call *ClientCall) {
+	status := strconv.Itoa(call.StatusCode)
+	if call.Err != nil {
+		status = "error"
+	}
+
+	labels := map[string]string{
+		"method": call.Method,
+		"host":   call.Host,
+		"route":  call.Route,
+		"status": status,
+	}
+
+	t.recorder.AddCounter(MetricClientRequests, labels, 1)
+	t.recorder.AddCounter(MetricClientRequestBytes, labels, float64(call.RequestBytes))
+	t.recorder.AddCounter(MetricClientResponseBytes, labels, float64(call.ResponseBytes))
+	t.recorder.ObserveDuration(MetricClientDuration, labels, call.Timing.Total)
+	t.recorder.ObserveDuration(MetricClientTTFB, labels, call.Timing.TTFB)
+
+	// reused connections don't have these phases
+	if !call.Timing.ConnReused {
+		t.recorder.ObserveDuration(MetricClientDNS, labels, call.Timing.DNS)
+		t.recorder.ObserveDuration(MetricClientConnect, labels, call.Timing.Connect)
+		t.recorder.ObserveDuration(MetricClientTLS, labels, call.Timing.TLS)
+	}
+}
+
+// MemoryMetrics keep metrics in memory, use it in tests or to expose them
+// in a debug endpoint.
+type MemoryMetrics struct {
+	mu        sync.Mutex
+	counters  map[string]float64
+	durations map[string][]time.Duration
+}
+
+// NewMemoryMetrics create an empty registry.
+func NewMemoryMetrics() *MemoryMetrics {
+	return &MemoryMetrics{
+		counters:  make(map[string]float64),
+		durations: make(map[string][]time.Duration),
+	}
+}
+
+// AddCounter implements MetricsRecorder
+func (m *MemoryMetrics) AddCounter(name string, labels map[string]string, value float64) {
+	m.mu.Lock()
+	m.counters[metricKey(name, labels)] += value
+	m.mu.Unlock()
+}
+
+// ObserveDuration implements MetricsRecorder
+func (m *MemoryMetrics) ObserveDuration(name string, labels map[string]string, d time.Duration) {
+	key := metricKey(name, labels)
+
+	m.mu.Lock()
+	m.durations[key] = append(m.durations[key], d)
+	m.mu.Unlock()
+}
+
+// Counter return the value of a counter.
+func (m *MemoryMetrics) Counter(name string, labels map[string]string) float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.counters[metricKey(name, labels)]
+}
+
+// Durations return all durations observed.
+func (m *MemoryMetrics) Durations(name string, labels map[string]string) []time.Duration {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]time.Duration(nil), m.durations[metricKey(name, labels)]...)
+}
+
+// metricKey is name{label="value",...} with labels sorted.
+func metricKey(name string, labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		pairs = append(pairs, k+"="+strconv.Quote(labels[k]))
+	}
+
+	return name + "{" + strings.Join(pairs, ",") + "}"
+}
@@ -0,0 +1,49 @@
+package fdmiddleware_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/foodora/go-ranger/fdhttp/fdmiddleware"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientMetricsTransport(t *testing.T) {
+	metrics := fdmiddleware.NewMemoryMetrics()
+
+	fail := false
+	transport := fdmiddleware.NewClientMetricsTransport(metrics).Wrap(fdmiddleware.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if fail {
+			return nil, errors.New("connection refused")
+		}
+		return newResponse(http.StatusOK, "ok"), nil
+	}))
+
+	ctx := fdmiddleware.SetRouteTemplate(context.Background(), "/menus/:id")
+	for _, id := range []string{"1", "2"} {
+		req, _ := http.NewRequest(http.MethodGet, "http://menu-service/menus/"+id, nil)
+		resp, err := transport.RoundTrip(req.WithContext(ctx))
+		assert.NoError(t, err)
+		readBody(t, resp)
+	}
+
+	fail = true
+	req, _ := http.NewRequest(http.MethodGet, "http://menu-service/menus/3", nil)
+	transport.RoundTrip(req.WithContext(ctx))
+
+	labels := map[string]string{
+		"method": http.MethodGet,
+		"host":   "menu-service",
+		"route":  "/menus/:id",
+		"status": "200",
+	}
+	assert.Equal(t, 2.0, metrics.Counter(fdmiddleware.MetricClientRequests, labels))
+	assert.Equal(t, 4.0, metrics.Counter(fdmiddleware.MetricClientResponseBytes, labels))
+	assert.Len(t, metrics.Durations(fdmiddleware.MetricClientDuration, labels), 2)
+	assert.Len(t, metrics.Durations(fdmiddleware.MetricClientTTFB, labels), 2)
+
+	labels["status"] = "error"
+	assert.Equal(t, 1.0, metrics.Counter(fdmiddleware.MetricClientRequests, labels))
+}
@@ -0,0 +1,139 @@
+package fdmiddleware
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ConcurrencyLimiter is a middleware that shed load when there're too many
+// requests in flight, answering 503 Service Unavailable with Retry-After
+// instead of queueing them until everything times out.
+type ConcurrencyLimiter struct {
+	global *limiter
+
+	// MaxWait is how long a request can wait in the queue for a free slot.
+	// Zero rejects requests right away when the limit is reached.
+	MaxWait time.Duration
+	// RetryAfter is sent to rejected clients, by default 1 second.
+	RetryAfter time.Duration
+
+	adaptiveMu sync.Mutex
+	adaptive   *AdaptiveLimit
+	estimated  float64
+	decreased  time.Time
+}
+
+// AdaptiveLimit change the limit based on latency using AIMD (additive increase,
+// multiplicative decrease): a request slower than TargetLatency multiply
+// the limit by Backoff, unless it started before the last decrease, so
+// requests in flight together decrease it only once. Otherwise the limit
+// grows by 1 after limit requests.
+type AdaptiveLimit struct {
+	MinLimit      int
+	MaxLimit      int
+	TargetLatency time.Duration
+	// Backoff is the multiplicative decrease, by default 0.9
+	Backoff float64
+}
+
+// NewConcurrencyLimitMiddleware accept limit requests in flight, and keep
+// up to queueSize requests waiting for MaxWait.
+func NewConcurrencyLimitMiddleware(limit, queueSize int) *ConcurrencyLimiter {
+	return &ConcurrencyLimiter{
+		global:     newLimiter(limit, queueSize),
+		RetryAfter: 1 * time.Second,
+	}
+}
+
+// SetAdaptive enable the adaptive limit, the global limit starts with MaxLimit.
+func (m *ConcurrencyLimiter) SetAdaptive(a AdaptiveLimit) {
+	if a.Backoff <= 0 || a.Backoff >= 1 {
+		a.Backoff = 0.9
+	}
+	if a.MinLimit <= 0 {
+		a.MinLimit = 1
+	}
+
+	m.adaptiveMu.Lock()
+	m.adaptive = &a
+	m.estimated = float64(a.MaxLimit)
+	m.decreased = time.Time{}
+	m.adaptiveMu.Unlock()
+
+	m.global.setLimit(a.MaxLimit)
+}
+
+// Limit return the current global limit.
+func (m *ConcurrencyLimiter) Limit() int {
+	_, _, limit := m.global.usage()
+	return limit
+}
+
+// Wrap will be called in every request
+func (m *ConcurrencyLimiter) Wrap(next http.Handler) http.Handler {
+	return m.wrap(m.global, true, next)
+}
+
+// Group return a middleware with its own limit besides the global limit.
+// The limit is shared by all routes it wraps, use it with a sub router to
+// limit some endpoints together, or call it once for each route that needs
+// its own limit:
+//  orders := router.SubRouter()
+//  orders.Use(limiter.Group(20, 10))
+func (m *ConcurrencyLimiter) Group(limit, queueSize int) Middleware {
+	l := newLimiter(limit, queueSize)
+	return MiddlewareFunc(func(next http.Handler) http.Handler {
+		return m.wrap(l, false, next)
+	})
+}
+
+func (m *ConcurrencyLimiter) wrap(l *limiter, adapt bool, next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, req *http.Request) {
+		if !l.acquire(req.Context(), m.MaxWait) {
+			retryAfter := int(math.Ceil(m.RetryAfter.Seconds()))
+			if retryAfter > 0 {
+				w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+			}
+			responseError(w, http.StatusServiceUnavailable, "service_overloaded", "Too many requests in progress, try again later")
+			return
+		}
+		defer l.release()
+
+		started := time.Now()
+		next.ServeHTTP(w, req)
+
+		if adapt {
+			m.observe(started, time.Since(started))
+		}
+	}
+
+	return http.HandlerFunc(fn)
+}
+
+// observe update the adaptive limit with the latency of a request.
+func (m *ConcurrencyLimiter) observe(started time.Time, latency time.Duration) {
+	m.adaptiveMu.Lock()
+	a := m.adaptive
+	if a == nil {
+		m.adaptiveMu.Unlock()
+		return
+	}
+
+	if latency > a.TargetLatency {
+		if !started.Before(m.decreased) {
+			m.estimated = math.Max(float64(a.MinLimit), m.estimated*a.Backoff)
+			m.decreased = time.Now()
+		}
+	} else {
+		m.estimated = math.Min(float64(a.MaxLimit), m.estimated+1/m.estimated)
+	}
+	limit := int(m.estimated)
+	m.adaptiveMu.Unlock()
+
+	if limit != m.Limit() {
+		m.global.setLimit(limit)
+	}
+}
@@ -0,0 +1,185 @@
+package fdmiddleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/foodora/go-ranger/fdhttp/fdmiddleware"
+	"github.com/stretchr/testify/assert"
+)
+
+// blockingHandler block requests until release is closed, started
+// receive a value when each request starts.
+func blockingHandler(started chan struct{}, release chan struct{}) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		started <- struct{}{}
+		<-release
+	})
+}
+
+func TestConcurrencyLimiter_RejectWhenLimitIsReached(t *testing.T) {
+	m := fdmiddleware.NewConcurrencyLimitMiddleware(2, 0)
+	m.RetryAfter = 3 * time.Second
+
+	started := make(chan struct{}, 2)
+	release := make(chan struct{})
+	h := m.Wrap(blockingHandler(started, release))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+		}()
+		<-started
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "3", w.Header().Get("Retry-After"))
+	assert.Contains(t, w.Body.String(), `"code":"service_overloaded"`)
+
+	close(release)
+	wg.Wait()
+
+	// slots were released
+	started = make(chan struct{}, 1)
+	h = m.Wrap(blockingHandler(started, release))
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestConcurrencyLimiter_WaitInQueue(t *testing.T) {
+	m := fdmiddleware.NewConcurrencyLimitMiddleware(1, 1)
+	m.MaxWait = time.Second
+
+	started := make(chan struct{}, 3)
+	release := make(chan struct{})
+	h := m.Wrap(blockingHandler(started, release))
+
+	codes := make(chan int, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+			codes <- w.Code
+		}()
+	}
+	<-started
+
+	// wait second request to be in the queue
+	time.Sleep(20 * time.Millisecond)
+
+	// queue is full
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+
+	close(release)
+	assert.Equal(t, http.StatusOK, <-codes)
+	assert.Equal(t, http.StatusOK, <-codes)
+}
+
+func TestConcurrencyLimiter_QueueTimeout(t *testing.T) {
+	m := fdmiddleware.NewConcurrencyLimitMiddleware(1, 1)
+	m.MaxWait = 10 * time.Millisecond
+
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	defer close(release)
+	h := m.Wrap(blockingHandler(started, release))
+
+	go h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	<-started
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+}
+
+func TestConcurrencyLimiter_Group(t *testing.T) {
+	m := fdmiddleware.NewConcurrencyLimitMiddleware(10, 0)
+
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	defer close(release)
+	h := m.Wrap(m.Group(1, 0).Wrap(blockingHandler(started, release)))
+
+	go h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	<-started
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+}
+
+func TestConcurrencyLimiter_Adaptive(t *testing.T) {
+	m := fdmiddleware.NewConcurrencyLimitMiddleware(0, 0)
+	m.SetAdaptive(fdmiddleware.AdaptiveLimit{
+		MinLimit:      2,
+		MaxLimit:      10,
+		TargetLatency: 5 * time.Millisecond,
+		Backoff:       0.5,
+	})
+	assert.Equal(t, 10, m.Limit())
+
+	var sleep time.Duration
+	h := m.Wrap(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		time.Sleep(sleep)
+	}))
+
+	sleep = 10 * time.Millisecond
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, 5, m.Limit())
+
+	for i := 0; i < 3; i++ {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	}
+	assert.Equal(t, 2, m.Limit())
+
+	// fast requests increase the limit slowly
+	sleep = 0
+	for i := 0; i < 6; i++ {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	}
+	assert.Equal(t, 4, m.Limit())
+}
+
+func TestConcurrencyLimiter_AdaptiveConcurrent(t *testing.T) {
+	m := fdmiddleware.NewConcurrencyLimitMiddleware(0, 0)
+	m.SetAdaptive(fdmiddleware.AdaptiveLimit{
+		MinLimit:      1,
+		MaxLimit:      10,
+		TargetLatency: 5 * time.Millisecond,
+		Backoff:       0.5,
+	})
+
+	var inFlight sync.WaitGroup
+	inFlight.Add(10)
+	h := m.Wrap(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		inFlight.Done()
+		inFlight.Wait()
+		time.Sleep(10 * time.Millisecond)
+	}))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+			assert.Equal(t, http.StatusOK, w.Code)
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, 5, m.Limit(), "slow requests in flight together decrease the limit once")
+}
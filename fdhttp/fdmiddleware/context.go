@@ -0,0 +1,74 @@
+package fdmiddleware
+
+import "context"
+
+// contextKey is a value for use with context.WithValue.
+type contextKey struct {
+	name string
+}
+
+func (c contextKey) String() string {
+	return "fdmiddleware context key " + c.name
+}
+
+var (
+	// JWTClaimsContextKey is the key used to save claims from a valid bearer token.
+	JWTClaimsContextKey = &contextKey{"jwt-claims"}
+
+	// ClientIPContextKey is the key used to save the client ip resolved by RealIP.
+	ClientIPContextKey = &contextKey{"client-ip"}
+
+	// RetryAttemptContextKey is the key used to save the attempt number of
+	// a request sent by RetryPolicyTransport.
+	RetryAttemptContextKey = &contextKey{"retry-attempt"}
+
+	// RouteTemplateContextKey is the key used to save the route template of
+	// an outgoing request, like /orders/:id.
+	RouteTemplateContextKey = &contextKey{"route-template"}
+)
+
+// Claims get the claims from the bearer token validated by JWTMiddleware.
+func Claims(ctx context.Context) JWTClaims {
+	v, _ := ctx.Value(JWTClaimsContextKey).(JWTClaims)
+	return v
+}
+
+// SetClaims set claims into context.
+func SetClaims(ctx context.Context, claims JWTClaims) context.Context {
+	return context.WithValue(ctx, JWTClaimsContextKey, claims)
+}
+
+// ClientIP get the client ip resolved by RealIP middleware.
+func ClientIP(ctx context.Context) string {
+	v, _ := ctx.Value(ClientIPContextKey).(string)
+	return v
+}
+
+// SetClientIP set client ip into context.
+func SetClientIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, ClientIPContextKey, ip)
+}
+
+// RetryAttempt get the attempt number, starting from 1, of a request sent by
+// RetryPolicyTransport. It returns 0 outside of a retry.
+func RetryAttempt(ctx context.Context) int {
+	v, _ := ctx.Value(RetryAttemptContextKey).(int)
+	return v
+}
+
+// SetRetryAttempt set the attempt number into context.
+func SetRetryAttempt(ctx context.Context, attempt int) context.Context {
+	return context.WithValue(ctx, RetryAttemptContextKey, attempt)
+}
+
+// RouteTemplate get the route template of an outgoing request, it's used
+// by client logs and metrics instead of the path with ids.
+func RouteTemplate(ctx context.Context) string {
+	v, _ := ctx.Value(RouteTemplateContextKey).(string)
+	return v
+}
+
+// SetRouteTemplate set the route template into context.
+func SetRouteTemplate(ctx context.Context, route string) context.Context {
+	return context.WithValue(ctx, RouteTemplateContextKey, route)
+}
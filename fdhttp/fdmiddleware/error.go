@@ -0,0 +1,21 @@
+package fdmiddleware
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// responseError send an error to the client using the same json format
+// of fdhttp.Error. We cannot use fdhttp here because it imports fdmiddleware.
+func responseError(w http.ResponseWriter, statusCode int, code, message string) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(statusCode)
+
+	json.NewEncoder(w).Encode(struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	}{
+		Code:    code,
+		Message: message,
+	})
+}
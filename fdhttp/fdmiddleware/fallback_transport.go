@@ -0,0 +1,303 @@
+package fdmiddleware
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FallbackHeader is added to responses that didn't come from upstream, its
+// value is the reason: circuit-open, timeout, error or the status code.
+const FallbackHeader = "X-Fallback"
+
+// DefaultFallbackCacheSize is the biggest body kept as last good response.
+var DefaultFallbackCacheSize int64 = 1 << 20
+
+// DefaultFallbackCacheEntries is the number of last good responses kept.
+var DefaultFallbackCacheEntries = 1000
+
+// DefaultFallbackCacheTTL is how long a last good response can be used.
+var DefaultFallbackCacheTTL = 1 * time.Hour
+
+// FallbackFunc build a response to req when upstream failed, resp is nil
+// when err is not. Return a nil response to keep the original result.
+type FallbackFunc func(req *http.Request, resp *http.Response, err error) (*http.Response, error)
+
+// StaticFallback always respond with the same payload.
+func StaticFallback(statusCode int, header http.Header, body []byte) FallbackFunc {
+	return func(req *http.Request, resp *http.Response, err error) (*http.Response, error) {
+		return newFallbackResponse(req, statusCode, header, body), nil
+	}
+}
+
+// DefaultShouldFallback use a fallback when circuit is open, request timed
+// out or upstream returned 5xx.
+func DefaultShouldFallback(resp *http.Response, err error) bool {
+	if err != nil {
+		return err == ErrCircuitOpen || isTimeout(err)
+	}
+
+	return resp.StatusCode >= 500
+}
+
+// FallbackTransport return a degraded response when upstream fails, it can
+// be the last good response received to the same url or one built by Fallback.
+// Responses are marked with FallbackHeader:
+//  client.Use(fdmiddleware.NewCircuitBreakerTransport(backoff, 0.5, 20))
+//  client.Use(fdmiddleware.NewFallbackTransport(fdmiddleware.StaticFallback(http.StatusOK, nil, []byte(`[]`))))
+type FallbackTransport struct {
+	// ShouldFallback decide when upstream failed, by default
+	// DefaultShouldFallback.
+	ShouldFallback func(resp *http.Response, err error) bool
+	// Fallback is used when there is no last good response, it can be nil.
+	Fallback FallbackFunc
+	// CacheLastGood keep the last 2xx response of each GET request. Responses
+	// to requests with Authorization or Cookie are kept only when public, and
+	// Vary is respected like in CacheTransport.
+	CacheLastGood bool
+	// MaxCacheBodySize is the biggest body cached, by default
+	// DefaultFallbackCacheSize.
+	MaxCacheBodySize int64
+	// MaxCacheEntries is the number of responses kept, the least recently
+	// used are removed first. By default DefaultFallbackCacheEntries.
+	MaxCacheEntries int
+	// CacheTTL is how long a last good response can be used, by default
+	// DefaultFallbackCacheTTL.
+	CacheTTL time.Duration
+	// KeyFunc return the key of last good responses, by default the url.
+	// Use it to share a response between urls, like ignoring some ids.
+	KeyFunc func(req *http.Request) string
+
+	once  sync.Once
+	cache *MemoryCacheStore
+}
+
+// NewFallbackTransport call fn when upstream fails.
+func NewFallbackTransport(fn FallbackFunc) *FallbackTransport {
+	return &FallbackTransport{
+		ShouldFallback:   DefaultShouldFallback,
+		Fallback:         fn,
+		MaxCacheBodySize: DefaultFallbackCacheSize,
+		MaxCacheEntries:  DefaultFallbackCacheEntries,
+		CacheTTL:         DefaultFallbackCacheTTL,
+	}
+}
+
+// NewLastGoodFallbackTransport respond with the last good response when
+// upstream fails, fn is used when there is none and can be nil.
+func NewLastGoodFallbackTransport(fn FallbackFunc) *FallbackTransport {
+	t := NewFallbackTransport(fn)
+	t.CacheLastGood = true
+	return t
+}
+
+// Wrap implements ClientMiddleware
+func (t *FallbackTransport) Wrap(next http.RoundTripper) http.RoundTripper {
+	return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		resp, err := next.RoundTrip(req)
+
+		shouldFallback := t.ShouldFallback
+		if shouldFallback == nil {
+			shouldFallback = DefaultShouldFallback
+		}
+
+		if !shouldFallback(resp, err) {
+			if err == nil && t.cacheable(req, resp) {
+				resp = t.store(req, resp)
+			}
+			return resp, err
+		}
+
+		reason := fallbackReason(resp, err)
+
+		if t.CacheLastGood {
+			if entry := t.lastGood(req); entry != nil {
+				closeBody(resp)
+				fallbackResp := newFallbackResponse(req, entry.StatusCode, entry.Header, entry.Body)
+				fallbackResp.Header.Set(FallbackHeader, reason)
+				return fallbackResp, nil
+			}
+		}
+
+		if t.Fallback == nil {
+			return resp, err
+		}
+
+		fallbackResp, fallbackErr := t.Fallback(req, resp, err)
+		if fallbackResp == nil && fallbackErr == nil {
+			return resp, err
+		}
+
+		closeBody(resp)
+		if fallbackResp != nil {
+			if fallbackResp.Header == nil {
+				fallbackResp.Header = http.Header{}
+			}
+			fallbackResp.Header.Set(FallbackHeader, reason)
+		}
+
+		return fallbackResp, fallbackErr
+	})
+}
+
+func (t *FallbackTransport) cacheable(req *http.Request, resp *http.Response) bool {
+	return t.CacheLastGood &&
+		req.Method == http.MethodGet &&
+		resp.StatusCode >= 200 && resp.StatusCode < 300 &&
+		resp.Header.Get("Vary") != "*" &&
+		(!hasCredentials(req) || isPublic(resp.Header))
+}
+
+// store read the body to keep a copy, returning a response with a new body.
+// Bodies bigger than MaxCacheBodySize are not cached.
+func (t *FallbackTransport) store(req *http.Request, resp *http.Response) *http.Response {
+	maxSize := t.MaxCacheBodySize
+	if maxSize <= 0 {
+		maxSize = DefaultFallbackCacheSize
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxSize+1))
+	if err != nil || int64(len(body)) > maxSize {
+		resp.Body = &multiReadCloser{
+			Reader: io.MultiReader(bytes.NewReader(body), resp.Body),
+			Closer: resp.Body,
+		}
+		return resp
+	}
+	resp.Body.Close()
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	entry := &CachedResponse{
+		StatusCode:    resp.StatusCode,
+		Header:        cloneHeader(resp.Header),
+		Body:          body,
+		RequestHeader: varyHeader(resp.Header, req),
+		Stored:        time.Now(),
+	}
+
+	key := t.key(req)
+	if names := varyNames(resp.Header); len(names) > 0 {
+		t.lastGoodStore().Set(key, &CachedResponse{Header: http.Header{"Vary": {strings.Join(names, ", ")}}})
+		key = variantKey(key, names, req)
+	}
+	t.lastGoodStore().Set(key, entry)
+
+	return resp
+}
+
+func (t *FallbackTransport) lastGood(req *http.Request) *CachedResponse {
+	if req.Method != http.MethodGet {
+		return nil
+	}
+
+	key := t.key(req)
+	entry, ok := t.lastGoodStore().Get(key)
+	if ok && entry.StatusCode == 0 {
+		key = variantKey(key, varyNames(entry.Header), req)
+		entry, ok = t.lastGoodStore().Get(key)
+	}
+	if !ok || !varyMatches(entry, req) {
+		return nil
+	}
+	if hasCredentials(req) && !isPublic(entry.Header) {
+		return nil
+	}
+
+	ttl := t.CacheTTL
+	if ttl <= 0 {
+		ttl = DefaultFallbackCacheTTL
+	}
+	if time.Since(entry.Stored) > ttl {
+		t.lastGoodStore().Delete(key)
+		return nil
+	}
+
+	return entry
+}
+
+func (t *FallbackTransport) lastGoodStore() *MemoryCacheStore {
+	t.once.Do(func() {
+		max := t.MaxCacheEntries
+		if max <= 0 {
+			max = DefaultFallbackCacheEntries
+		}
+		t.cache = NewMemoryCacheStore(max)
+	})
+	return t.cache
+}
+
+func (t *FallbackTransport) key(req *http.Request) string {
+	if t.KeyFunc != nil {
+		return t.KeyFunc(req)
+	}
+	return req.URL.String()
+}
+
+// hasCredentials check if the response to req can be specific to a user.
+func hasCredentials(req *http.Request) bool {
+	return req.Header.Get("Authorization") != "" || req.Header.Get("Cookie") != ""
+}
+
+func newFallbackResponse(req *http.Request, statusCode int, header http.Header, body []byte) *http.Response {
+	h := make(http.Header, len(header)+1)
+	for k, v := range header {
+		h[k] = append([]string(nil), v...)
+	}
+
+	return &http.Response{
+		Status:        strconv.Itoa(statusCode) + " " + http.StatusText(statusCode),
+		StatusCode:    statusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        h,
+		Body:          ioutil.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
+
+func fallbackReason(resp *http.Response, err error) string {
+	switch {
+	case err == ErrCircuitOpen:
+		return "circuit-open"
+	case err != nil && isTimeout(err):
+		return "timeout"
+	case err != nil:
+		return "error"
+	}
+
+	return strconv.Itoa(resp.StatusCode)
+}
+
+// isTimeout unwrap errors returned by http.Client.
+func isTimeout(err error) bool {
+	if urlErr, ok := err.(*url.Error); ok {
+		err = urlErr.Err
+	}
+	if err == context.DeadlineExceeded {
+		return true
+	}
+
+	netErr, ok := err.(net.Error)
+	return ok && netErr.Timeout()
+}
+
+func closeBody(resp *http.Response) {
+	if resp != nil && resp.Body != nil {
+		resp.Body.Close()
+	}
+}
+
+type multiReadCloser struct {
+	io.Reader
+	io.Closer
+}
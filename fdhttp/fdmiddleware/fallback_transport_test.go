@@ -0,0 +1,280 @@
+package fdmiddleware_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/foodora/go-ranger/fdhttp/fdmiddleware"
+	"github.com/stretchr/testify/assert"
+)
+
+func newResponse(statusCode int, body string) *http.Response {
+	return &http.Response{
+		StatusCode: statusCode,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       ioutil.NopCloser(strings.NewReader(body)),
+	}
+}
+
+func readBody(t *testing.T, resp *http.Response) string {
+	body, err := ioutil.ReadAll(resp.Body)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	return string(body)
+}
+
+func TestFallbackTransport_Static(t *testing.T) {
+	fallback := fdmiddleware.NewFallbackTransport(fdmiddleware.StaticFallback(
+		http.StatusOK,
+		http.Header{"Content-Type": []string{"application/json"}},
+		[]byte(`[]`),
+	))
+
+	tests := map[string]struct {
+		resp   *http.Response
+		err    error
+		reason string
+	}{
+		"circuit open": {err: fdmiddleware.ErrCircuitOpen, reason: "circuit-open"},
+		"timeout":      {err: context.DeadlineExceeded, reason: "timeout"},
+		"url timeout":  {err: &url.Error{Op: "Get", URL: "http://localhost", Err: context.DeadlineExceeded}, reason: "timeout"},
+		"5xx":          {resp: newResponse(http.StatusBadGateway, "bad gateway"), reason: "502"},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			transport := fallback.Wrap(fdmiddleware.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				return tt.resp, tt.err
+			}))
+
+			req, _ := http.NewRequest(http.MethodGet, "http://localhost/restaurants", nil)
+			resp, err := transport.RoundTrip(req)
+			assert.NoError(t, err)
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			assert.Equal(t, tt.reason, resp.Header.Get(fdmiddleware.FallbackHeader))
+			assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+			assert.Equal(t, `[]`, readBody(t, resp))
+		})
+	}
+}
+
+func TestFallbackTransport_KeepOriginalResult(t *testing.T) {
+	fallback := fdmiddleware.NewFallbackTransport(fdmiddleware.StaticFallback(http.StatusOK, nil, nil))
+
+	expectedErr := errors.New("connection refused")
+	var (
+		resp *http.Response
+		err  error
+	)
+	transport := fallback.Wrap(fdmiddleware.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		return resp, err
+	}))
+
+	req, _ := http.NewRequest(http.MethodGet, "http://localhost/", nil)
+
+	resp, err = newResponse(http.StatusNotFound, "not found"), nil
+	r, e := transport.RoundTrip(req)
+	assert.NoError(t, e)
+	assert.Equal(t, http.StatusNotFound, r.StatusCode)
+	assert.Empty(t, r.Header.Get(fdmiddleware.FallbackHeader))
+
+	resp, err = nil, expectedErr
+	_, e = transport.RoundTrip(req)
+	assert.Equal(t, expectedErr, e)
+}
+
+func TestFallbackTransport_Func(t *testing.T) {
+	fallback := fdmiddleware.NewFallbackTransport(func(req *http.Request, resp *http.Response, err error) (*http.Response, error) {
+		if req.URL.Path == "/none" {
+			return nil, nil
+		}
+		return newResponse(http.StatusOK, `{"from":"`+req.URL.Path+`"}`), nil
+	})
+
+	transport := fallback.Wrap(fdmiddleware.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		return newResponse(http.StatusServiceUnavailable, "unavailable"), nil
+	}))
+
+	req, _ := http.NewRequest(http.MethodGet, "http://localhost/menu", nil)
+	resp, err := transport.RoundTrip(req)
+	assert.NoError(t, err)
+	assert.Equal(t, "503", resp.Header.Get(fdmiddleware.FallbackHeader))
+	assert.Equal(t, `{"from":"/menu"}`, readBody(t, resp))
+
+	req, _ = http.NewRequest(http.MethodGet, "http://localhost/none", nil)
+	resp, err = transport.RoundTrip(req)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.Empty(t, resp.Header.Get(fdmiddleware.FallbackHeader))
+}
+
+func TestFallbackTransport_LastGood(t *testing.T) {
+	fallback := fdmiddleware.NewLastGoodFallbackTransport(fdmiddleware.StaticFallback(http.StatusOK, nil, []byte(`static`)))
+
+	var fail bool
+	transport := fallback.Wrap(fdmiddleware.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if fail {
+			return nil, fdmiddleware.ErrCircuitOpen
+		}
+		return newResponse(http.StatusOK, `{"path":"`+req.URL.Path+`"}`), nil
+	}))
+
+	req, _ := http.NewRequest(http.MethodGet, "http://localhost/a", nil)
+	resp, err := transport.RoundTrip(req)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"path":"/a"}`, readBody(t, resp))
+
+	fail = true
+
+	resp, err = transport.RoundTrip(req)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "circuit-open", resp.Header.Get(fdmiddleware.FallbackHeader))
+	assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+	assert.Equal(t, `{"path":"/a"}`, readBody(t, resp))
+
+	// no last good response to /b
+	req, _ = http.NewRequest(http.MethodGet, "http://localhost/b", nil)
+	resp, err = transport.RoundTrip(req)
+	assert.NoError(t, err)
+	assert.Equal(t, `static`, readBody(t, resp))
+}
+
+func TestFallbackTransport_LastGoodCredentials(t *testing.T) {
+	fallback := fdmiddleware.NewLastGoodFallbackTransport(fdmiddleware.StaticFallback(http.StatusOK, nil, []byte(`static`)))
+
+	var fail bool
+	transport := fallback.Wrap(fdmiddleware.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if fail {
+			return nil, fdmiddleware.ErrCircuitOpen
+		}
+
+		user := req.Header.Get("Authorization") + req.Header.Get("Cookie")
+		resp := newResponse(http.StatusOK, `{"user":"`+user+`"}`)
+		if req.URL.Path == "/menu" {
+			resp.Header.Set("Cache-Control", "public")
+			resp.Header.Set("Vary", "Accept-Language")
+		}
+		return resp, nil
+	}))
+
+	call := func(path, name, value string) string {
+		req, _ := http.NewRequest(http.MethodGet, "http://localhost"+path, nil)
+		req.Header.Set(name, value)
+		req.Header.Set("Accept-Language", "en")
+		resp, err := transport.RoundTrip(req)
+		assert.NoError(t, err)
+		return readBody(t, resp)
+	}
+
+	assert.Equal(t, `{"user":"Bearer alice"}`, call("/me", "Authorization", "Bearer alice"))
+	assert.Equal(t, `{"user":"session=alice"}`, call("/orders", "Cookie", "session=alice"))
+	assert.Equal(t, `{"user":"Bearer alice"}`, call("/menu", "Authorization", "Bearer alice"))
+
+	fail = true
+
+	// responses of other users are never returned
+	assert.Equal(t, `static`, call("/me", "Authorization", "Bearer bob"))
+	assert.Equal(t, `static`, call("/me", "Authorization", "Bearer alice"))
+	assert.Equal(t, `static`, call("/orders", "Cookie", "session=bob"))
+	// public responses are shared, respecting Vary
+	assert.Equal(t, `{"user":"Bearer alice"}`, call("/menu", "Authorization", "Bearer bob"))
+
+	req, _ := http.NewRequest(http.MethodGet, "http://localhost/menu", nil)
+	req.Header.Set("Accept-Language", "de")
+	resp, err := transport.RoundTrip(req)
+	assert.NoError(t, err)
+	assert.Equal(t, `static`, readBody(t, resp))
+}
+
+func TestFallbackTransport_LastGoodBodyTooBig(t *testing.T) {
+	fallback := fdmiddleware.NewLastGoodFallbackTransport(nil)
+	fallback.MaxCacheBodySize = 4
+
+	var fail bool
+	transport := fallback.Wrap(fdmiddleware.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if fail {
+			return nil, fdmiddleware.ErrCircuitOpen
+		}
+		return newResponse(http.StatusOK, `0123456789`), nil
+	}))
+
+	req, _ := http.NewRequest(http.MethodGet, "http://localhost/", nil)
+	resp, err := transport.RoundTrip(req)
+	assert.NoError(t, err)
+	assert.Equal(t, `0123456789`, readBody(t, resp))
+
+	fail = true
+	_, err = transport.RoundTrip(req)
+	assert.Equal(t, fdmiddleware.ErrCircuitOpen, err)
+}
+
+func TestFallbackTransport_LastGoodEviction(t *testing.T) {
+	fallback := fdmiddleware.NewLastGoodFallbackTransport(nil)
+	fallback.MaxCacheEntries = 2
+	fallback.CacheTTL = 50 * time.Millisecond
+
+	var fail bool
+	transport := fallback.Wrap(fdmiddleware.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if fail {
+			return nil, fdmiddleware.ErrCircuitOpen
+		}
+		return newResponse(http.StatusOK, req.URL.Path), nil
+	}))
+
+	get := func(path string) (*http.Response, error) {
+		req, _ := http.NewRequest(http.MethodGet, "http://localhost"+path, nil)
+		return transport.RoundTrip(req)
+	}
+
+	for _, path := range []string{"/restaurants/1", "/restaurants/2", "/restaurants/3"} {
+		resp, err := get(path)
+		assert.NoError(t, err)
+		readBody(t, resp)
+	}
+
+	fail = true
+	_, err := get("/restaurants/1")
+	assert.Equal(t, fdmiddleware.ErrCircuitOpen, err, "least recently used is evicted")
+
+	resp, err := get("/restaurants/3")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "/restaurants/3", readBody(t, resp))
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	_, err = get("/restaurants/3")
+	assert.Equal(t, fdmiddleware.ErrCircuitOpen, err, "expired after ttl")
+}
+
+func TestFallbackTransport_LastGoodKeyFunc(t *testing.T) {
+	fallback := fdmiddleware.NewLastGoodFallbackTransport(nil)
+	fallback.KeyFunc = func(req *http.Request) string {
+		return req.URL.Path
+	}
+
+	var fail bool
+	transport := fallback.Wrap(fdmiddleware.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if fail {
+			return newResponse(http.StatusServiceUnavailable, ""), nil
+		}
+		return newResponse(http.StatusOK, "restaurants"), nil
+	}))
+
+	req, _ := http.NewRequest(http.MethodGet, "http://localhost/restaurants?lat=1", nil)
+	resp, _ := transport.RoundTrip(req)
+	readBody(t, resp)
+
+	fail = true
+	req, _ = http.NewRequest(http.MethodGet, "http://localhost/restaurants?lat=2", nil)
+	resp, err := transport.RoundTrip(req)
+	assert.NoError(t, err)
+	assert.Equal(t, "503", resp.Header.Get(fdmiddleware.FallbackHeader))
+	assert.Equal(t, "restaurants", readBody(t, resp))
+}
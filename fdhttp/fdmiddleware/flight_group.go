@@ -0,0 +1,60 @@
+package fdmiddleware
+
+import (
+	"fmt"
+	"sync"
+)
+
+// flightGroup run only one call with the same key at a time, others wait
+// and receive the same result.
+type flightGroup struct {
+	mu    sync.Mutex
+	calls map[string]*flightCall
+}
+
+type flightCall struct {
+	wg     sync.WaitGroup
+	result interface{}
+	err    error
+}
+
+// do return shared true when the result came from a call done by someone else.
+func (g *flightGroup) do(key string, fn func() (interface{}, error)) (result interface{}, err error, shared bool) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*flightCall)
+	}
+	if c, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+		c.wg.Wait()
+		return c.result, c.err, true
+	}
+
+	c := new(flightCall)
+	c.wg.Add(1)
+	g.calls[key] = c
+	g.mu.Unlock()
+
+	var panicked interface{}
+	func() {
+		// waiters are released even if fn panics
+		defer func() {
+			if panicked = recover(); panicked != nil {
+				c.err = fmt.Errorf("fdmiddleware: call panicked: %v", panicked)
+			}
+
+			g.mu.Lock()
+			delete(g.calls, key)
+			g.mu.Unlock()
+			c.wg.Done()
+		}()
+
+		c.result, c.err = fn()
+	}()
+
+	if panicked != nil {
+		panic(panicked)
+	}
+
+	return c.result, c.err, false
+}
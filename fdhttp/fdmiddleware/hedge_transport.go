@@ -0,0 +1,266 @@
+package fdmiddleware
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/foodora/go-ranger/fdbackoff"
+)
+
+// hedgeSamples is how many latencies are kept to calculate the percentile.
+const hedgeSamples = 1000
+
+// hedgeMinSamples is how many latencies are needed before using the
+// percentile instead of Delay.
+const hedgeMinSamples = 20
+
+// hedgeRecalculate is how many latencies are observed before the percentile
+// is calculated again.
+const hedgeRecalculate = 100
+
+// HedgeTransport send another attempt of GET and HEAD requests when the
+// first one didn't answer within a delay, the first response received is
+// used and the others are canceled. A 5xx is only used when no other
+// attempt answer without it. It reduce tail latency when some
+// requests are slow for reasons that don't repeat, like a busy instance:
+//  hedge := fdmiddleware.NewHedgeTransport(50 * time.Millisecond)
+//  hedge.Percentile = 0.95
+//  hedge.Backends = []string{"search-2.foodora.com"}
+//  client.Use(hedge)
+type HedgeTransport struct {
+	// Delay before sending another attempt, it's also used while there're not
+	// enough latencies to calculate Percentile.
+	Delay time.Duration
+	// Percentile of observed latencies used as delay, like 0.95. Zero means
+	// always use Delay.
+	Percentile float64
+	// MaxHedges is how many attempts can be sent besides the first one.
+	MaxHedges int
+	// Backends receive the hedged attempts in turns, they can be a host or a
+	// scheme://host. Empty means the same backend of the request.
+	Backends []string
+	// Budget limit hedged attempts to a ratio of requests, so a slow upstream
+	// doesn't receive twice its load. Nil means no limit.
+	Budget *fdbackoff.Budget
+
+	mu         sync.Mutex
+	latencies  []time.Duration
+	next       int
+	observed   int
+	percentile time.Duration
+	backend    int
+}
+
+// NewHedgeTransport send one hedged attempt after delay, limited to 10% of
+// requests.
+func NewHedgeTransport(delay time.Duration) *HedgeTransport {
+	return &HedgeTransport{
+		Delay:     delay,
+		MaxHedges: 1,
+		Budget:    fdbackoff.NewBudget(0.1, 10, 10*time.Second),
+	}
+}
+
+type hedgeResult struct {
+	attempt int
+	resp    *http.Response
+	err     error
+	cancel  context.CancelFunc
+	latency time.Duration
+}
+
+// Wrap implements ClientMiddleware
+func (t *HedgeTransport) Wrap(next http.RoundTripper) http.RoundTripper {
+	return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if !t.hedgeable(req) {
+			return next.RoundTrip(req)
+		}
+
+		results := make(chan hedgeResult, t.MaxHedges+1)
+		var cancels []context.CancelFunc
+		send := func(r *http.Request) {
+			ctx, cancel := context.WithCancel(req.Context())
+			attempt := len(cancels)
+			cancels = append(cancels, cancel)
+			started := time.Now()
+			go func() {
+				resp, err := next.RoundTrip(r.WithContext(ctx))
+				results <- hedgeResult{
+					attempt: attempt,
+					resp:    resp,
+					err:     err,
+					cancel:  cancel,
+					latency: time.Since(started),
+				}
+			}()
+		}
+
+		send(req)
+		pending, hedges := 1, 0
+
+		timer := time.NewTimer(t.delay())
+		defer timer.Stop()
+
+		// held is a 5xx waiting for other attempts
+		var held *hedgeResult
+		for {
+			var last hedgeResult
+			select {
+			case <-timer.C:
+				if hedges < t.MaxHedges && (t.Budget == nil || t.Budget.Withdraw()) {
+					hedges++
+					pending++
+					send(t.hedgeRequest(req))
+					timer.Reset(t.delay())
+				}
+				continue
+			case last = <-results:
+				pending--
+			}
+
+			if last.err == nil && last.resp.StatusCode >= 500 && pending > 0 {
+				if held != nil {
+					discardHedge(*held)
+				}
+				held = &last
+				continue
+			}
+
+			if last.err != nil {
+				last.cancel()
+				if pending > 0 {
+					continue
+				}
+				if held == nil {
+					return nil, last.err
+				}
+				last, held = *held, nil
+			}
+			if held != nil {
+				discardHedge(*held)
+			}
+
+			if t.Budget != nil {
+				t.Budget.Success()
+			}
+			t.observe(last.latency)
+
+			// cancel the others, they can still send a result
+			for i, cancel := range cancels {
+				if i != last.attempt {
+					cancel()
+				}
+			}
+			go discardHedges(results, pending)
+
+			if last.resp.Body == nil {
+				last.cancel()
+				return last.resp, nil
+			}
+			last.resp.Body = &cancelBody{ReadCloser: last.resp.Body, cancel: last.cancel}
+			return last.resp, nil
+		}
+	})
+}
+
+func (t *HedgeTransport) hedgeable(req *http.Request) bool {
+	if t.MaxHedges <= 0 {
+		return false
+	}
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return false
+	}
+
+	return req.Body == nil || req.Body == http.NoBody
+}
+
+// hedgeRequest return a copy of req sent to the next backend.
+func (t *HedgeTransport) hedgeRequest(req *http.Request) *http.Request {
+	r := cloneRequest(req)
+	if len(t.Backends) == 0 {
+		return r
+	}
+
+	t.mu.Lock()
+	backend := t.Backends[t.backend%len(t.Backends)]
+	t.backend++
+	t.mu.Unlock()
+
+	setBackend(r.URL, backend)
+	if req.Host == req.URL.Host {
+		// Host set by the caller is kept, backends can serve the same
+		// virtual host
+		r.Host = ""
+	}
+
+	return r
+}
+
+// delay return the percentile of observed latencies, or Delay.
+func (t *HedgeTransport) delay() time.Duration {
+	if t.Percentile <= 0 {
+		return t.Delay
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.percentile == 0 {
+		return t.Delay
+	}
+	return t.percentile
+}
+
+// observe keep latency in a ring buffer, the percentile is calculated when
+// there're enough samples and then every hedgeRecalculate latencies.
+func (t *HedgeTransport) observe(latency time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if len(t.latencies) < hedgeSamples {
+		t.latencies = append(t.latencies, latency)
+	} else {
+		t.latencies[t.next] = latency
+		t.next = (t.next + 1) % hedgeSamples
+	}
+
+	t.observed++
+	if t.Percentile <= 0 || len(t.latencies) < hedgeMinSamples {
+		return
+	}
+	if t.percentile != 0 && t.observed%hedgeRecalculate != 0 {
+		return
+	}
+
+	latencies := append([]time.Duration(nil), t.latencies...)
+	sort.Slice(latencies, func(i, j int) bool {
+		return latencies[i] < latencies[j]
+	})
+
+	i := int(t.Percentile * float64(len(latencies)))
+	if i >= len(latencies) {
+		i = len(latencies) - 1
+	}
+	t.percentile = latencies[i]
+}
+
+// discardHedges wait attempts that lost, closing their responses.
+func discardHedges(results chan hedgeResult, pending int) {
+	for i := 0; i < pending; i++ {
+		discardHedge(<-results)
+	}
+}
+
+// discardHedge close the response of an attempt that lost.
+func discardHedge(r hedgeResult) {
+	if r.resp != nil && r.resp.Body != nil {
+		io.Copy(ioutil.Discard, r.resp.Body)
+		r.resp.Body.Close()
+	}
+	r.cancel()
+}
@@ -0,0 +1,214 @@
+package fdmiddleware_test
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/foodora/go-ranger/fdbackoff"
+	"github.com/foodora/go-ranger/fdhttp/fdmiddleware"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHedgeTransport(t *testing.T) {
+	hedge := fdmiddleware.NewHedgeTransport(10 * time.Millisecond)
+	hedge.Backends = []string{"http://search-2"}
+
+	canceled := make(chan struct{})
+	transport := hedge.Wrap(fdmiddleware.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if req.URL.Host == "search-1" {
+			select {
+			case <-req.Context().Done():
+				close(canceled)
+				return nil, req.Context().Err()
+			case <-time.After(time.Second):
+				return newResponse(http.StatusOK, "slow"), nil
+			}
+		}
+
+		return newResponse(http.StatusOK, req.URL.Host), nil
+	}))
+
+	req, _ := http.NewRequest(http.MethodGet, "http://search-1/search?q=pizza", nil)
+	resp, err := transport.RoundTrip(req)
+	assert.NoError(t, err)
+	assert.Equal(t, "search-2", readBody(t, resp))
+
+	select {
+	case <-canceled:
+	case <-time.After(time.Second):
+		t.Error("slow attempt was not canceled")
+	}
+}
+
+func TestHedgeTransport_KeepHostHeader(t *testing.T) {
+	hedge := fdmiddleware.NewHedgeTransport(time.Millisecond)
+	hedge.Backends = []string{"http://10.0.0.2"}
+
+	transport := hedge.Wrap(fdmiddleware.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if req.URL.Host == "10.0.0.1" {
+			<-req.Context().Done()
+			return nil, req.Context().Err()
+		}
+		return newResponse(http.StatusOK, req.Host), nil
+	}))
+
+	req, _ := http.NewRequest(http.MethodGet, "http://10.0.0.1/search", nil)
+	req.Host = "search.foodora.com"
+	resp, err := transport.RoundTrip(req)
+	assert.NoError(t, err)
+	assert.Equal(t, "search.foodora.com", readBody(t, resp))
+}
+
+func TestHedgeTransport_FastResponseIsNotHedged(t *testing.T) {
+	hedge := fdmiddleware.NewHedgeTransport(time.Second)
+
+	var calls int32
+	transport := hedge.Wrap(fdmiddleware.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		atomic.AddInt32(&calls, 1)
+		return newResponse(http.StatusOK, "ok"), nil
+	}))
+
+	req, _ := http.NewRequest(http.MethodGet, "http://search/", nil)
+	resp, err := transport.RoundTrip(req)
+	assert.NoError(t, err)
+	assert.Equal(t, "ok", readBody(t, resp))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestHedgeTransport_OnlyGetAndHead(t *testing.T) {
+	hedge := fdmiddleware.NewHedgeTransport(time.Millisecond)
+
+	var calls int32
+	transport := hedge.Wrap(fdmiddleware.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(20 * time.Millisecond)
+		return newResponse(http.StatusCreated, "created"), nil
+	}))
+
+	req, _ := http.NewRequest(http.MethodPost, "http://search/", strings.NewReader(`{}`))
+	resp, err := transport.RoundTrip(req)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestHedgeTransport_Budget(t *testing.T) {
+	hedge := fdmiddleware.NewHedgeTransport(time.Millisecond)
+	hedge.Budget = fdbackoff.NewBudget(0, 1, time.Minute)
+
+	var calls int32
+	transport := hedge.Wrap(fdmiddleware.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(20 * time.Millisecond)
+		return newResponse(http.StatusOK, "ok"), nil
+	}))
+
+	req, _ := http.NewRequest(http.MethodGet, "http://search/", nil)
+	resp, err := transport.RoundTrip(req)
+	assert.NoError(t, err)
+	readBody(t, resp)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+
+	// budget is over
+	atomic.StoreInt32(&calls, 0)
+	resp, err = transport.RoundTrip(req)
+	assert.NoError(t, err)
+	readBody(t, resp)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestHedgeTransport_ErrorWaitOtherAttempts(t *testing.T) {
+	hedge := fdmiddleware.NewHedgeTransport(time.Millisecond)
+	hedge.Backends = []string{"search-2"}
+
+	expectedErr := errors.New("connection reset")
+	transport := hedge.Wrap(fdmiddleware.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if req.URL.Host == "search-1" {
+			time.Sleep(20 * time.Millisecond)
+			return nil, expectedErr
+		}
+
+		time.Sleep(40 * time.Millisecond)
+		return newResponse(http.StatusOK, "ok"), nil
+	}))
+
+	req, _ := http.NewRequest(http.MethodGet, "http://search-1/", nil)
+	resp, err := transport.RoundTrip(req)
+	assert.NoError(t, err)
+	assert.Equal(t, "ok", readBody(t, resp))
+
+	// all attempts failed
+	hedge.Backends = []string{"search-1"}
+	_, err = transport.RoundTrip(req)
+	assert.Equal(t, expectedErr, err)
+}
+
+func TestHedgeTransport_ServerErrorWaitOtherAttempts(t *testing.T) {
+	hedge := fdmiddleware.NewHedgeTransport(10 * time.Millisecond)
+	hedge.Backends = []string{"search-2"}
+
+	transport := hedge.Wrap(fdmiddleware.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if req.URL.Host == "search-1" {
+			time.Sleep(20 * time.Millisecond)
+			return newResponse(http.StatusServiceUnavailable, "unavailable"), nil
+		}
+
+		time.Sleep(40 * time.Millisecond)
+		return newResponse(http.StatusOK, "ok"), nil
+	}))
+
+	req, _ := http.NewRequest(http.MethodGet, "http://search-1/", nil)
+	resp, err := transport.RoundTrip(req)
+	if assert.NoError(t, err) {
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "ok", readBody(t, resp))
+	}
+
+	// 5xx is used when all attempts failed
+	hedge.Backends = []string{"search-1"}
+	resp, err = transport.RoundTrip(req)
+	if assert.NoError(t, err) {
+		assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+		readBody(t, resp)
+	}
+}
+
+func TestHedgeTransport_Percentile(t *testing.T) {
+	hedge := fdmiddleware.NewHedgeTransport(time.Minute)
+	hedge.Percentile = 0.9
+	hedge.Budget = nil
+	hedge.Backends = []string{"search-2"}
+
+	var slow int32
+	transport := hedge.Wrap(fdmiddleware.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if req.URL.Host == "search-1" && atomic.LoadInt32(&slow) == 1 {
+			select {
+			case <-req.Context().Done():
+				return nil, req.Context().Err()
+			case <-time.After(time.Second):
+			}
+		}
+		return newResponse(http.StatusOK, req.URL.Host), nil
+	}))
+
+	req, _ := http.NewRequest(http.MethodGet, "http://search-1/", nil)
+	for i := 0; i < 20; i++ {
+		resp, err := transport.RoundTrip(req)
+		if assert.NoError(t, err) {
+			readBody(t, resp)
+		}
+	}
+
+	// delay is the percentile of fast responses instead of one minute
+	atomic.StoreInt32(&slow, 1)
+	started := time.Now()
+	resp, err := transport.RoundTrip(req)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "search-2", readBody(t, resp))
+	}
+	assert.True(t, time.Since(started) < time.Second)
+}
@@ -0,0 +1,185 @@
+package fdmiddleware
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Headers sent by HMACSigner and validated by HMACVerifier.
+const (
+	HMACSignatureHeader = "X-Signature"
+	HMACTimestampHeader = "X-Signature-Timestamp"
+	HMACNonceHeader     = "X-Signature-Nonce"
+	HMACDigestHeader    = "Digest"
+)
+
+// Errors returned when a signed request cannot be validated.
+var (
+	ErrHMACMissingSignature = errors.New("fdmiddleware: request is not signed")
+	ErrHMACMalformed        = errors.New("fdmiddleware: malformed signature")
+	ErrHMACUnknownKey       = errors.New("fdmiddleware: unknown signature key")
+	ErrHMACInvalidSignature = errors.New("fdmiddleware: invalid signature")
+	ErrHMACInvalidDigest    = errors.New("fdmiddleware: body digest does not match")
+	ErrHMACClockSkew        = errors.New("fdmiddleware: signature timestamp out of tolerance")
+	ErrHMACReplayed         = errors.New("fdmiddleware: signature nonce was already used")
+	ErrHMACMissingHeader    = errors.New("fdmiddleware: required header is not signed")
+	ErrHMACBodyTooLarge     = errors.New("fdmiddleware: request body too large")
+)
+
+// hmacSignature build the string covered by the signature:
+//  METHOD
+//  /path?query
+//  header-1:value
+//  header-n:value
+//  SHA-256=<body digest>
+//  <unix timestamp>
+//  <nonce>
+// and sign it with secret.
+func hmacSignature(secret []byte, req *http.Request, headers []string, digest, timestamp, nonce string) []byte {
+	var b bytes.Buffer
+	b.WriteString(req.Method)
+	b.WriteByte('\n')
+	b.WriteString(req.URL.RequestURI())
+	b.WriteByte('\n')
+
+	for _, h := range headers {
+		var value string
+		if strings.EqualFold(h, "host") {
+			value = req.Host
+			if value == "" {
+				value = req.URL.Host
+			}
+		} else {
+			value = strings.Join(req.Header[http.CanonicalHeaderKey(h)], ", ")
+		}
+
+		fmt.Fprintf(&b, "%s:%s\n", strings.ToLower(h), strings.TrimSpace(value))
+	}
+
+	b.WriteString(digest)
+	b.WriteByte('\n')
+	b.WriteString(timestamp)
+	b.WriteByte('\n')
+	b.WriteString(nonce)
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(b.Bytes())
+	return mac.Sum(nil)
+}
+
+// hmacBodyDigest read the body to calculate its digest, and put it back
+// to request be able to send it again. Bodies bigger than maxSize return
+// ErrHMACBodyTooLarge, zero means no limit.
+func hmacBodyDigest(req *http.Request, maxSize int64) (string, error) {
+	var body []byte
+
+	if req.Body != nil && req.Body != http.NoBody {
+		var r io.Reader = req.Body
+		if maxSize > 0 {
+			r = io.LimitReader(req.Body, maxSize+1)
+		}
+
+		var err error
+		body, err = ioutil.ReadAll(r)
+		req.Body.Close()
+		if err != nil {
+			return "", err
+		}
+		if maxSize > 0 && int64(len(body)) > maxSize {
+			return "", ErrHMACBodyTooLarge
+		}
+
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+		req.GetBody = func() (io.ReadCloser, error) {
+			return ioutil.NopCloser(bytes.NewReader(body)), nil
+		}
+	}
+
+	sum := sha256.Sum256(body)
+	return "SHA-256=" + base64.StdEncoding.EncodeToString(sum[:]), nil
+}
+
+// formatHMACSignatureHeader build the value of X-Signature header.
+func formatHMACSignatureHeader(keyID string, headers []string, sig []byte) string {
+	return fmt.Sprintf(`keyId="%s",algorithm="hmac-sha256",headers="%s",signature="%s"`,
+		keyID, strings.ToLower(strings.Join(headers, " ")), base64.StdEncoding.EncodeToString(sig))
+}
+
+// parseHMACSignatureHeader read the values of X-Signature header.
+func parseHMACSignatureHeader(value string) (keyID string, headers []string, sig []byte, err error) {
+	params := map[string]string{}
+	for _, p := range strings.Split(value, ",") {
+		i := strings.Index(p, "=")
+		if i < 0 {
+			return "", nil, nil, ErrHMACMalformed
+		}
+		params[strings.TrimSpace(p[:i])] = strings.Trim(strings.TrimSpace(p[i+1:]), `"`)
+	}
+
+	if params["algorithm"] != "hmac-sha256" || params["keyId"] == "" {
+		return "", nil, nil, ErrHMACMalformed
+	}
+
+	sig, err = base64.StdEncoding.DecodeString(params["signature"])
+	if err != nil || len(sig) == 0 {
+		return "", nil, nil, ErrHMACMalformed
+	}
+
+	return params["keyId"], strings.Fields(params["headers"]), sig, nil
+}
+
+// NonceStore keep track of nonces already used to avoid replay attacks.
+type NonceStore interface {
+	// Add return false if nonce was already added and it didn't expire yet.
+	Add(nonce string, expiresAt time.Time) bool
+}
+
+// MemoryNonceStore is a NonceStore that keep nonces in memory, it works
+// only if you have one instance of your service or your load balancer
+// use sticky sessions. Otherwise implement NonceStore using a shared storage.
+type MemoryNonceStore struct {
+	mu        sync.Mutex
+	nonces    map[string]time.Time
+	lastSweep time.Time
+}
+
+// NewMemoryNonceStore return a new MemoryNonceStore
+func NewMemoryNonceStore() *MemoryNonceStore {
+	return &MemoryNonceStore{
+		nonces:    map[string]time.Time{},
+		lastSweep: time.Now(),
+	}
+}
+
+// Add implements NonceStore
+func (s *MemoryNonceStore) Add(nonce string, expiresAt time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(s.lastSweep) > time.Minute {
+		for n, exp := range s.nonces {
+			if now.After(exp) {
+				delete(s.nonces, n)
+			}
+		}
+		s.lastSweep = now
+	}
+
+	if exp, ok := s.nonces[nonce]; ok && now.Before(exp) {
+		return false
+	}
+
+	s.nonces[nonce] = expiresAt
+	return true
+}
@@ -0,0 +1,162 @@
+package fdmiddleware
+
+import (
+	"context"
+	"crypto/hmac"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HMACKeyIDContextKey is the key used to save the key id of a valid signed request.
+var HMACKeyIDContextKey = &contextKey{"hmac-key-id"}
+
+// HMACKeyID get the key id used to sign the request validated by HMACVerifier.
+// Use it to know which service is calling you.
+func HMACKeyID(ctx context.Context) string {
+	v, _ := ctx.Value(HMACKeyIDContextKey).(string)
+	return v
+}
+
+// SetHMACKeyID set key id into context.
+func SetHMACKeyID(ctx context.Context, keyID string) context.Context {
+	return context.WithValue(ctx, HMACKeyIDContextKey, keyID)
+}
+
+// HMACVerifier is a Middleware that only accept requests signed by HMACSigner.
+type HMACVerifier struct {
+	keys map[string][]byte
+
+	// MaxSkew is the tolerance between client and server clocks, requests
+	// signed before or after it are rejected. By default 5 minutes.
+	MaxSkew time.Duration
+	// Nonces keep track of signatures already used, by default MemoryNonceStore.
+	// Set to nil to disable replay protection.
+	Nonces NonceStore
+	// MaxBodySize is the biggest body read to check its digest, bigger
+	// requests are rejected with 413. By default DefaultHMACMaxBodySize.
+	MaxBodySize int64
+	// RequiredHeaders must be covered by the signature, so it cannot be
+	// sent to another host or later. By default Host and Date.
+	RequiredHeaders []string
+	// Logger receive the reason of rejected requests, the response only says
+	// the signature is invalid.
+	Logger Logger
+}
+
+// DefaultHMACMaxBodySize is the biggest body accepted by HMACVerifier.
+var DefaultHMACMaxBodySize int64 = 10 << 20
+
+// NewHMACVerifierMiddleware return a middleware that validate the signature
+// using the secret of keys, indexed by key id.
+func NewHMACVerifierMiddleware(keys map[string][]byte) *HMACVerifier {
+	return &HMACVerifier{
+		keys:            keys,
+		MaxSkew:         5 * time.Minute,
+		Nonces:          NewMemoryNonceStore(),
+		MaxBodySize:     DefaultHMACMaxBodySize,
+		RequiredHeaders: []string{"Host", "Date"},
+	}
+}
+
+// Wrap will be called in every request
+func (v *HMACVerifier) Wrap(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, req *http.Request) {
+		keyID, err := v.Verify(req)
+		if err != nil && v.Logger != nil {
+			v.Logger.Printf("%s %s: %s", req.Method, req.URL.Path, err)
+		}
+		if err == ErrHMACBodyTooLarge {
+			responseError(w, http.StatusRequestEntityTooLarge, "request_too_large", "Request body is too large")
+			return
+		}
+		if err != nil {
+			responseError(w, http.StatusUnauthorized, "invalid_signature", "Request signature is invalid")
+			return
+		}
+
+		ctx := SetHMACKeyID(req.Context(), keyID)
+		next.ServeHTTP(w, req.WithContext(ctx))
+	}
+
+	return http.HandlerFunc(fn)
+}
+
+// Verify check the request signature and return the key id used to sign it.
+// Request body is read but you still can read it again.
+func (v *HMACVerifier) Verify(req *http.Request) (string, error) {
+	value := req.Header.Get(HMACSignatureHeader)
+	if value == "" {
+		return "", ErrHMACMissingSignature
+	}
+
+	keyID, headers, sig, err := parseHMACSignatureHeader(value)
+	if err != nil {
+		return "", err
+	}
+
+	secret, ok := v.keys[keyID]
+	if !ok {
+		return "", ErrHMACUnknownKey
+	}
+
+	for _, required := range v.RequiredHeaders {
+		if !containsFold(headers, required) {
+			return "", ErrHMACMissingHeader
+		}
+		if !strings.EqualFold(required, "host") && req.Header.Get(required) == "" {
+			return "", ErrHMACMissingHeader
+		}
+	}
+
+	timestamp := req.Header.Get(HMACTimestampHeader)
+	sec, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return "", ErrHMACMalformed
+	}
+
+	signedAt := time.Unix(sec, 0)
+	if d := time.Since(signedAt); d > v.MaxSkew || d < -v.MaxSkew {
+		return "", ErrHMACClockSkew
+	}
+
+	maxSize := v.MaxBodySize
+	if maxSize <= 0 {
+		maxSize = DefaultHMACMaxBodySize
+	}
+
+	digest, err := hmacBodyDigest(req, maxSize)
+	if err != nil {
+		return "", err
+	}
+	if !hmac.Equal([]byte(digest), []byte(req.Header.Get(HMACDigestHeader))) {
+		return "", ErrHMACInvalidDigest
+	}
+
+	nonce := req.Header.Get(HMACNonceHeader)
+	if !hmac.Equal(sig, hmacSignature(secret, req, headers, digest, timestamp, nonce)) {
+		return "", ErrHMACInvalidSignature
+	}
+
+	if v.Nonces != nil {
+		if nonce == "" {
+			return "", ErrHMACMalformed
+		}
+		// after MaxSkew the timestamp is enough to reject the request
+		if !v.Nonces.Add(keyID+":"+nonce, signedAt.Add(v.MaxSkew)) {
+			return "", ErrHMACReplayed
+		}
+	}
+
+	return keyID, nil
+}
+
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
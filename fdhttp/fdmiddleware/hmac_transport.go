@@ -0,0 +1,63 @@
+package fdmiddleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// HMACSigner is a ClientMiddleware that sign all requests, the server
+// should validate them using HMACVerifier.
+type HMACSigner struct {
+	keyID  string
+	secret []byte
+
+	// Headers that will be covered by the signature, besides method, path,
+	// body digest and timestamp. By default Host, Date and Content-Type.
+	Headers []string
+}
+
+// NewHMACSignerTransport return a ClientMiddleware that sign requests using
+// secret. keyID is sent together to allow server rotate keys.
+func NewHMACSignerTransport(keyID string, secret []byte) *HMACSigner {
+	return &HMACSigner{
+		keyID:   keyID,
+		secret:  secret,
+		Headers: []string{"Host", "Date", "Content-Type"},
+	}
+}
+
+// Wrap implements ClientMiddleware
+func (s *HMACSigner) Wrap(next http.RoundTripper) http.RoundTripper {
+	return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		req = cloneRequest(req)
+
+		digest, err := hmacBodyDigest(req, 0)
+		if err != nil {
+			return nil, err
+		}
+
+		if req.Header.Get("Date") == "" {
+			req.Header.Set("Date", time.Now().UTC().Format(http.TimeFormat))
+		}
+
+		nonce := make([]byte, 16)
+		if _, err := rand.Read(nonce); err != nil {
+			return nil, err
+		}
+
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		nonceHex := hex.EncodeToString(nonce)
+
+		req.Header.Set(HMACDigestHeader, digest)
+		req.Header.Set(HMACTimestampHeader, timestamp)
+		req.Header.Set(HMACNonceHeader, nonceHex)
+
+		sig := hmacSignature(s.secret, req, s.Headers, digest, timestamp, nonceHex)
+		req.Header.Set(HMACSignatureHeader, formatHMACSignatureHeader(s.keyID, s.Headers, sig))
+
+		return next.RoundTrip(req)
+	})
+}
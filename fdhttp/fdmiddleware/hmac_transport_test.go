@@ -0,0 +1,229 @@
+package fdmiddleware_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/foodora/go-ranger/fdhttp"
+	"github.com/foodora/go-ranger/fdhttp/fdmiddleware"
+	"github.com/stretchr/testify/assert"
+)
+
+func newHMACServer(verifier *fdmiddleware.HMACVerifier) *httptest.Server {
+	router := fdhttp.NewRouter()
+	router.Use(verifier)
+	router.POST("/orders", func(ctx context.Context) (int, interface{}) {
+		body, _ := ioutil.ReadAll(fdhttp.RequestBody(ctx))
+		return http.StatusOK, map[string]string{
+			"key_id": fdmiddleware.HMACKeyID(ctx),
+			"body":   string(body),
+		}
+	})
+
+	return httptest.NewServer(router)
+}
+
+func hmacErrorMessage(t *testing.T, resp *http.Response) string {
+	defer resp.Body.Close()
+
+	var respErr fdhttp.Error
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&respErr))
+	return respErr.Message
+}
+
+func TestHMAC_SignAndVerify(t *testing.T) {
+	verifier := fdmiddleware.NewHMACVerifierMiddleware(map[string][]byte{
+		"checkout": []byte("checkout-secret"),
+	})
+	ts := newHMACServer(verifier)
+	defer ts.Close()
+
+	c := fdhttp.NewClient()
+	c.Use(fdmiddleware.NewHMACSignerTransport("checkout", []byte("checkout-secret")))
+
+	resp, err := c.Post(ts.URL+"/orders?id=1", "application/json", bytes.NewBufferString(`{"id":1}`))
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var body map[string]string
+	json.NewDecoder(resp.Body).Decode(&body)
+	assert.Equal(t, "checkout", body["key_id"])
+	assert.Equal(t, `{"id":1}`, body["body"])
+}
+
+func TestHMAC_RejectInvalidRequests(t *testing.T) {
+	verifier := fdmiddleware.NewHMACVerifierMiddleware(map[string][]byte{
+		"checkout": []byte("checkout-secret"),
+	})
+	log := &bufferLogger{}
+	verifier.Logger = log
+	ts := newHMACServer(verifier)
+	defer ts.Close()
+
+	cases := map[string]struct {
+		keyID  string
+		secret string
+		tamper func(req *http.Request)
+		err    error
+	}{
+		"not signed": {
+			tamper: func(req *http.Request) {
+				req.Header.Del(fdmiddleware.HMACSignatureHeader)
+			},
+			err: fdmiddleware.ErrHMACMissingSignature,
+		},
+		"unknown key": {
+			keyID: "unknown",
+			err:   fdmiddleware.ErrHMACUnknownKey,
+		},
+		"wrong secret": {
+			secret: "other-secret",
+			err:    fdmiddleware.ErrHMACInvalidSignature,
+		},
+		"body changed": {
+			tamper: func(req *http.Request) {
+				req.Body = ioutil.NopCloser(bytes.NewBufferString(`{"id":2}`))
+			},
+			err: fdmiddleware.ErrHMACInvalidDigest,
+		},
+		"path changed": {
+			tamper: func(req *http.Request) {
+				req.URL.RawQuery = "id=2"
+			},
+			err: fdmiddleware.ErrHMACInvalidSignature,
+		},
+		"old timestamp": {
+			tamper: func(req *http.Request) {
+				old := time.Now().Add(-10 * time.Minute).Unix()
+				req.Header.Set(fdmiddleware.HMACTimestampHeader, strconv.FormatInt(old, 10))
+			},
+			err: fdmiddleware.ErrHMACClockSkew,
+		},
+	}
+
+	for name, cs := range cases {
+		if cs.keyID == "" {
+			cs.keyID = "checkout"
+		}
+		if cs.secret == "" {
+			cs.secret = "checkout-secret"
+		}
+
+		c := fdhttp.NewClient()
+		if cs.tamper != nil {
+			tamper := cs.tamper
+			// added before signer, so it runs after the request was signed
+			c.Use(fdmiddleware.ClientMiddlewareFunc(func(next http.RoundTripper) http.RoundTripper {
+				return fdmiddleware.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+					tamper(req)
+					return next.RoundTrip(req)
+				})
+			}))
+		}
+		c.Use(fdmiddleware.NewHMACSignerTransport(cs.keyID, []byte(cs.secret)))
+
+		log.Reset()
+		resp, err := c.Post(ts.URL+"/orders?id=1", "application/json", bytes.NewBufferString(`{"id":1}`))
+		assert.NoError(t, err, name)
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode, name)
+		assert.Equal(t, "Request signature is invalid", hmacErrorMessage(t, resp), name)
+		assert.Equal(t, "POST /orders: "+cs.err.Error(), log.String(), name)
+	}
+}
+
+func TestHMAC_RejectReplayedRequest(t *testing.T) {
+	verifier := fdmiddleware.NewHMACVerifierMiddleware(map[string][]byte{
+		"checkout": []byte("checkout-secret"),
+	})
+	log := &bufferLogger{}
+	verifier.Logger = log
+	ts := newHMACServer(verifier)
+	defer ts.Close()
+
+	var signed *http.Request
+
+	c := fdhttp.NewClient()
+	c.Use(fdmiddleware.ClientMiddlewareFunc(func(next http.RoundTripper) http.RoundTripper {
+		return fdmiddleware.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			signed = req
+			return next.RoundTrip(req)
+		})
+	}))
+	c.Use(fdmiddleware.NewHMACSignerTransport("checkout", []byte("checkout-secret")))
+
+	resp, err := c.Post(ts.URL+"/orders", "application/json", bytes.NewBufferString(`{"id":1}`))
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// send exactly the same request again
+	replay, _ := http.NewRequest(http.MethodPost, ts.URL+"/orders", bytes.NewBufferString(`{"id":1}`))
+	replay.Header = signed.Header
+
+	resp, err = http.DefaultClient.Do(replay)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	assert.Equal(t, "Request signature is invalid", hmacErrorMessage(t, resp))
+	assert.Equal(t, "POST /orders: "+fdmiddleware.ErrHMACReplayed.Error(), log.String())
+}
+
+func TestMemoryNonceStore(t *testing.T) {
+	s := fdmiddleware.NewMemoryNonceStore()
+
+	assert.True(t, s.Add("n1", time.Now().Add(time.Minute)))
+	assert.False(t, s.Add("n1", time.Now().Add(time.Minute)))
+	assert.True(t, s.Add("n2", time.Now().Add(-time.Second)))
+	// n2 already expired
+	assert.True(t, s.Add("n2", time.Now().Add(time.Minute)))
+}
+
+func TestHMAC_RequiredHeaders(t *testing.T) {
+	verifier := fdmiddleware.NewHMACVerifierMiddleware(map[string][]byte{
+		"checkout": []byte("checkout-secret"),
+	})
+	log := &bufferLogger{}
+	verifier.Logger = log
+	ts := newHMACServer(verifier)
+	defer ts.Close()
+
+	signer := fdmiddleware.NewHMACSignerTransport("checkout", []byte("checkout-secret"))
+	signer.Headers = []string{"Content-Type"}
+
+	c := fdhttp.NewClient()
+	c.Use(signer)
+
+	resp, err := c.Post(ts.URL+"/orders", "application/json", bytes.NewBufferString(`{"id":1}`))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	assert.Equal(t, "Request signature is invalid", hmacErrorMessage(t, resp))
+	assert.Equal(t, "POST /orders: "+fdmiddleware.ErrHMACMissingHeader.Error(), log.String())
+}
+
+func TestHMAC_BodyTooLarge(t *testing.T) {
+	verifier := fdmiddleware.NewHMACVerifierMiddleware(map[string][]byte{
+		"checkout": []byte("checkout-secret"),
+	})
+	verifier.MaxBodySize = 4
+
+	handler := verifier.Wrap(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		t.Error("handler should not be called")
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/orders", bytes.NewBufferString(`{"id":1}`))
+	req.Header.Set(fdmiddleware.HMACSignatureHeader, `keyId="checkout",algorithm="hmac-sha256",headers="host date",signature="c2ln"`)
+	req.Header.Set(fdmiddleware.HMACTimestampHeader, strconv.FormatInt(time.Now().Unix(), 10))
+	req.Header.Set("Date", time.Now().UTC().Format(http.TimeFormat))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+}
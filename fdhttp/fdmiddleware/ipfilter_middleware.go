@@ -0,0 +1,70 @@
+package fdmiddleware
+
+import (
+	"net"
+	"net/http"
+)
+
+// IPFilter is a middleware that accept or reject requests by client ip,
+// useful to protect admin or internal endpoints:
+//  internal := router.SubRouter()
+//  internal.Use(ipFilter)
+// If RealIP middleware runs before it, the resolved client ip is used,
+// otherwise the ip of who is connected to us.
+type IPFilter struct {
+	allow []*net.IPNet
+	deny  []*net.IPNet
+}
+
+// NewIPFilterMiddleware receive a list of CIDRs (or single ips) to allow and deny.
+// Deny has precedence over allow, and an empty allow list accept all ips
+// that are not denied.
+func NewIPFilterMiddleware(allow, deny []string) (*IPFilter, error) {
+	allowNets, err := parseCIDRs(allow)
+	if err != nil {
+		return nil, err
+	}
+
+	denyNets, err := parseCIDRs(deny)
+	if err != nil {
+		return nil, err
+	}
+
+	return &IPFilter{
+		allow: allowNets,
+		deny:  denyNets,
+	}, nil
+}
+
+// Allowed return true if ip can access.
+func (m *IPFilter) Allowed(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+
+	if containsIP(m.deny, parsed) {
+		return false
+	}
+
+	return len(m.allow) == 0 || containsIP(m.allow, parsed)
+}
+
+// Wrap will be called in every request
+func (m *IPFilter) Wrap(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, req *http.Request) {
+		ip := ClientIP(req.Context())
+		if ip == "" {
+			ip = remoteIP(req)
+		}
+
+		if !m.Allowed(ip) {
+			responseError(w, http.StatusForbidden, "forbidden", "Access denied for '"+ip+"'")
+			return
+		}
+
+		next.ServeHTTP(w, req)
+	}
+
+	return http.HandlerFunc(fn)
+}
@@ -0,0 +1,237 @@
+package fdmiddleware
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// Algorithms supported to sign a JWT.
+const (
+	JWTAlgHS256 = "HS256"
+	JWTAlgRS256 = "RS256"
+	JWTAlgES256 = "ES256"
+)
+
+// Errors returned when a token cannot be validated.
+var (
+	ErrJWTMalformed        = errors.New("fdmiddleware: malformed token")
+	ErrJWTUnsupportedAlg   = errors.New("fdmiddleware: unsupported token algorithm")
+	ErrJWTKeyNotFound      = errors.New("fdmiddleware: token key not found")
+	ErrJWTInvalidKey       = errors.New("fdmiddleware: key cannot be used with token algorithm")
+	ErrJWTInvalidSignature = errors.New("fdmiddleware: invalid token signature")
+	ErrJWTExpired          = errors.New("fdmiddleware: token is expired")
+	ErrJWTNotValidYet      = errors.New("fdmiddleware: token is not valid yet")
+	ErrJWTInvalidIssuer    = errors.New("fdmiddleware: invalid token issuer")
+	ErrJWTInvalidAudience  = errors.New("fdmiddleware: invalid token audience")
+)
+
+// JWTClaims are all claims sent inside of a token. Use the methods to read
+// registered claims with the right type.
+type JWTClaims map[string]interface{}
+
+// Subject return "sub" claim.
+func (c JWTClaims) Subject() string {
+	return c.String("sub")
+}
+
+// Issuer return "iss" claim.
+func (c JWTClaims) Issuer() string {
+	return c.String("iss")
+}
+
+// Audience return "aud" claim, it can be sent as string or a list of strings.
+func (c JWTClaims) Audience() []string {
+	return c.Strings("aud")
+}
+
+// ExpiresAt return "exp" claim or zero time if it was not sent.
+func (c JWTClaims) ExpiresAt() time.Time {
+	return c.Time("exp")
+}
+
+// NotBefore return "nbf" claim or zero time if it was not sent.
+func (c JWTClaims) NotBefore() time.Time {
+	return c.Time("nbf")
+}
+
+// IssuedAt return "iat" claim or zero time if it was not sent.
+func (c JWTClaims) IssuedAt() time.Time {
+	return c.Time("iat")
+}
+
+// Scopes return the scopes granted to the token. They're read from "scope"
+// (space separated string, RFC 8693) or "scp" (list of strings).
+func (c JWTClaims) Scopes() []string {
+	if scope := c.String("scope"); scope != "" {
+		return strings.Fields(scope)
+	}
+	return c.Strings("scp")
+}
+
+// Roles return "roles" claim.
+func (c JWTClaims) Roles() []string {
+	return c.Strings("roles")
+}
+
+// HasScope return true if scope was granted to the token.
+func (c JWTClaims) HasScope(scope string) bool {
+	return contains(c.Scopes(), scope)
+}
+
+// HasRole return true if the token contains the role.
+func (c JWTClaims) HasRole(role string) bool {
+	return contains(c.Roles(), role)
+}
+
+// String return a claim as string or empty if it's not a string.
+func (c JWTClaims) String(name string) string {
+	v, _ := c[name].(string)
+	return v
+}
+
+// Strings return a claim that can be sent as a single string or a list of strings.
+func (c JWTClaims) Strings(name string) []string {
+	switch v := c[name].(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, s := range v {
+			if s, ok := s.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+
+	return nil
+}
+
+// Time return a claim sent as NumericDate (seconds since epoch).
+func (c JWTClaims) Time(name string) time.Time {
+	n, ok := c[name].(json.Number)
+	if !ok {
+		return time.Time{}
+	}
+
+	f, err := n.Float64()
+	if err != nil {
+		return time.Time{}
+	}
+
+	sec := int64(f)
+	return time.Unix(sec, int64((f-float64(sec))*float64(time.Second)))
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	Typ string `json:"typ"`
+}
+
+// splitJWT decode header and claims of a token without verify it.
+func splitJWT(token string) (header jwtHeader, claims JWTClaims, signed string, sig []byte, err error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		err = ErrJWTMalformed
+		return
+	}
+
+	rawHeader, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		err = ErrJWTMalformed
+		return
+	}
+	if err = json.Unmarshal(rawHeader, &header); err != nil {
+		err = ErrJWTMalformed
+		return
+	}
+
+	rawClaims, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		err = ErrJWTMalformed
+		return
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(rawClaims))
+	dec.UseNumber()
+	if err = dec.Decode(&claims); err != nil {
+		err = ErrJWTMalformed
+		return
+	}
+
+	sig, err = base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		err = ErrJWTMalformed
+		return
+	}
+
+	signed = parts[0] + "." + parts[1]
+	return
+}
+
+// verifyJWTSignature check if sig is the signature of signed using key.
+func verifyJWTSignature(alg string, key interface{}, signed string, sig []byte) error {
+	hashed := sha256.Sum256([]byte(signed))
+
+	switch alg {
+	case JWTAlgHS256:
+		secret, ok := key.([]byte)
+		if !ok {
+			return ErrJWTInvalidKey
+		}
+
+		mac := hmac.New(sha256.New, secret)
+		mac.Write([]byte(signed))
+		if !hmac.Equal(sig, mac.Sum(nil)) {
+			return ErrJWTInvalidSignature
+		}
+	case JWTAlgRS256:
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return ErrJWTInvalidKey
+		}
+
+		if err := rsa.VerifyPKCS1v15(pub, crypto.SHA256, hashed[:], sig); err != nil {
+			return ErrJWTInvalidSignature
+		}
+	case JWTAlgES256:
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok || pub.Curve != elliptic.P256() {
+			return ErrJWTInvalidKey
+		}
+		if len(sig) != 64 {
+			return ErrJWTInvalidSignature
+		}
+
+		r := new(big.Int).SetBytes(sig[:32])
+		s := new(big.Int).SetBytes(sig[32:])
+		if !ecdsa.Verify(pub, hashed[:], r, s) {
+			return ErrJWTInvalidSignature
+		}
+	default:
+		return ErrJWTUnsupportedAlg
+	}
+
+	return nil
+}
+
+func contains(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,255 @@
+package fdmiddleware
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// JWTKeyProvider is the interface used by JWTMiddleware to find the key that
+// should verify a token.
+type JWTKeyProvider interface {
+	// JWTKey return the key to verify a token signed with alg. kid is the key id
+	// sent inside of token header and it can be empty.
+	// Keys are []byte for HS256, *rsa.PublicKey for RS256 and *ecdsa.PublicKey for ES256.
+	JWTKey(ctx context.Context, alg, kid string) (interface{}, error)
+}
+
+// JWTStaticKeys is a JWTKeyProvider with keys indexed by key id. Use an empty
+// key id to specify the key used when the token doesn't send one.
+//  keys := fdmiddleware.JWTStaticKeys{
+//      "":   []byte("my-secret"),
+//      "k1": rsaPublicKey,
+//  }
+type JWTStaticKeys map[string]interface{}
+
+// JWTKey implements JWTKeyProvider
+func (k JWTStaticKeys) JWTKey(ctx context.Context, alg, kid string) (interface{}, error) {
+	key, ok := k[kid]
+	if !ok {
+		return nil, ErrJWTKeyNotFound
+	}
+	return key, nil
+}
+
+// JWKSTimeout is the time limit to download the keys document.
+var JWKSTimeout = 10 * time.Second
+
+// JWKS is a JWTKeyProvider that loads keys from a JSON Web Key Set document,
+// usually exposed by identity providers as /.well-known/jwks.json.
+type JWKS struct {
+	url    string
+	client *http.Client
+
+	mu   sync.RWMutex
+	keys map[string]jwk
+
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+type jwk struct {
+	alg string
+	key interface{}
+}
+
+type jwksDocument struct {
+	Keys []struct {
+		Kty string `json:"kty"`
+		Kid string `json:"kid"`
+		Alg string `json:"alg"`
+		Use string `json:"use"`
+		// RSA
+		N string `json:"n"`
+		E string `json:"e"`
+		// EC
+		Crv string `json:"crv"`
+		X   string `json:"x"`
+		Y   string `json:"y"`
+		// Symmetric
+		K string `json:"k"`
+	} `json:"keys"`
+}
+
+// NewJWKS load keys from url and refresh them every refreshInterval, if
+// refreshInterval <= 0 keys are loaded only once. If client is nil a client
+// with JWKSTimeout is used, each download is also limited to JWKSTimeout.
+// Call Stop() to abort the refresh.
+func NewJWKS(client *http.Client, url string, refreshInterval time.Duration) (*JWKS, error) {
+	if client == nil {
+		client = &http.Client{Timeout: JWKSTimeout}
+	}
+
+	j := &JWKS{
+		url:    url,
+		client: client,
+		keys:   map[string]jwk{},
+		done:   make(chan struct{}),
+	}
+
+	if err := j.refresh(); err != nil {
+		return nil, err
+	}
+
+	if refreshInterval > 0 {
+		go j.refreshEvery(refreshInterval)
+	}
+
+	return j, nil
+}
+
+func (j *JWKS) refreshEvery(d time.Duration) {
+	t := time.NewTicker(d)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+			// keep using the previous keys in case of failure
+			j.refresh()
+		case <-j.done:
+			return
+		}
+	}
+}
+
+// Stop the refresh of keys, it's safe to call it more than once.
+func (j *JWKS) Stop() {
+	j.stopOnce.Do(func() {
+		close(j.done)
+	})
+}
+
+func (j *JWKS) refresh() error {
+	ctx, cancel := context.WithTimeout(context.Background(), JWKSTimeout)
+	defer cancel()
+
+	return j.Refresh(ctx)
+}
+
+// Refresh download the document again and replace all keys.
+func (j *JWKS) Refresh(ctx context.Context) error {
+	req, err := http.NewRequest(http.MethodGet, j.url, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := j.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("fdmiddleware: unable to load jwks from '%s': %s", j.url, resp.Status)
+	}
+
+	var doc jwksDocument
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return fmt.Errorf("fdmiddleware: unable to load jwks from '%s': %s", j.url, err)
+	}
+
+	keys := make(map[string]jwk, len(doc.Keys))
+	for _, k := range doc.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+
+		var (
+			key interface{}
+			alg = k.Alg
+		)
+
+		switch k.Kty {
+		case "RSA":
+			n, errN := base64.RawURLEncoding.DecodeString(k.N)
+			e, errE := base64.RawURLEncoding.DecodeString(k.E)
+			if errN != nil || errE != nil {
+				continue
+			}
+			key = &rsa.PublicKey{
+				N: new(big.Int).SetBytes(n),
+				E: int(new(big.Int).SetBytes(e).Int64()),
+			}
+			if alg == "" {
+				alg = JWTAlgRS256
+			}
+		case "EC":
+			if k.Crv != "P-256" {
+				continue
+			}
+			x, errX := base64.RawURLEncoding.DecodeString(k.X)
+			y, errY := base64.RawURLEncoding.DecodeString(k.Y)
+			if errX != nil || errY != nil {
+				continue
+			}
+			key = &ecdsa.PublicKey{
+				Curve: elliptic.P256(),
+				X:     new(big.Int).SetBytes(x),
+				Y:     new(big.Int).SetBytes(y),
+			}
+			if alg == "" {
+				alg = JWTAlgES256
+			}
+		case "oct":
+			secret, err := base64.RawURLEncoding.DecodeString(k.K)
+			if err != nil {
+				continue
+			}
+			key = secret
+			if alg == "" {
+				alg = JWTAlgHS256
+			}
+		default:
+			continue
+		}
+
+		keys[k.Kid] = jwk{alg: alg, key: key}
+	}
+
+	j.mu.Lock()
+	j.keys = keys
+	j.mu.Unlock()
+
+	return nil
+}
+
+// JWTKey implements JWTKeyProvider. If kid is empty and there's only one key
+// for alg, this key is returned.
+func (j *JWKS) JWTKey(ctx context.Context, alg, kid string) (interface{}, error) {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+
+	if kid != "" {
+		k, ok := j.keys[kid]
+		if !ok || k.alg != alg {
+			return nil, ErrJWTKeyNotFound
+		}
+		return k.key, nil
+	}
+
+	var found interface{}
+	for _, k := range j.keys {
+		if k.alg != alg {
+			continue
+		}
+		if found != nil {
+			// ambiguous, token need to send kid
+			return nil, ErrJWTKeyNotFound
+		}
+		found = k.key
+	}
+
+	if found == nil {
+		return nil, ErrJWTKeyNotFound
+	}
+	return found, nil
+}
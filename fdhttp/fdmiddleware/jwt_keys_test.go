@@ -0,0 +1,124 @@
+package fdmiddleware_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/foodora/go-ranger/fdhttp/fdmiddleware"
+	"github.com/stretchr/testify/assert"
+)
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func TestJWKS_LoadKeys(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		fmt.Fprintf(w, `{"keys":[
+			{"kty":"RSA","kid":"rs","use":"sig","n":"%s","e":"%s"},
+			{"kty":"EC","kid":"es","crv":"P-256","x":"%s","y":"%s"},
+			{"kty":"RSA","kid":"enc","use":"enc","n":"%s","e":"%s"}
+		]}`,
+			b64(rsaKey.N.Bytes()), b64(big.NewInt(int64(rsaKey.E)).Bytes()),
+			b64(ecKey.X.Bytes()), b64(ecKey.Y.Bytes()),
+			b64(rsaKey.N.Bytes()), b64(big.NewInt(int64(rsaKey.E)).Bytes()),
+		)
+	}))
+	defer ts.Close()
+
+	jwks, err := fdmiddleware.NewJWKS(nil, ts.URL, 0)
+	assert.NoError(t, err)
+
+	key, err := jwks.JWTKey(context.Background(), fdmiddleware.JWTAlgRS256, "rs")
+	assert.NoError(t, err)
+	assert.Equal(t, &rsaKey.PublicKey, key)
+
+	// without kid the only key with the algorithm is returned
+	key, err = jwks.JWTKey(context.Background(), fdmiddleware.JWTAlgES256, "")
+	assert.NoError(t, err)
+	assert.Equal(t, ecKey.X, key.(*ecdsa.PublicKey).X)
+
+	_, err = jwks.JWTKey(context.Background(), fdmiddleware.JWTAlgES256, "rs")
+	assert.Equal(t, fdmiddleware.ErrJWTKeyNotFound, err)
+
+	_, err = jwks.JWTKey(context.Background(), fdmiddleware.JWTAlgRS256, "enc")
+	assert.Equal(t, fdmiddleware.ErrJWTKeyNotFound, err)
+
+	m := fdmiddleware.NewJWTMiddleware(jwks)
+	claims, err := m.Parse(context.Background(), signJWT(t, "RS256", "rs", rsaKey, map[string]interface{}{"sub": "user-1"}))
+	assert.NoError(t, err)
+	assert.Equal(t, "user-1", claims.Subject())
+}
+
+func TestJWKS_Refresh(t *testing.T) {
+	secret := []byte("my-secret")
+
+	var called int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if atomic.AddInt32(&called, 1) == 1 {
+			fmt.Fprint(w, `{"keys":[]}`)
+			return
+		}
+		fmt.Fprintf(w, `{"keys":[{"kty":"oct","kid":"hs","k":"%s"}]}`, b64(secret))
+	}))
+	defer ts.Close()
+
+	jwks, err := fdmiddleware.NewJWKS(nil, ts.URL, 10*time.Millisecond)
+	assert.NoError(t, err)
+	defer jwks.Stop()
+	// stopping twice should not panic
+	defer jwks.Stop()
+
+	_, err = jwks.JWTKey(context.Background(), fdmiddleware.JWTAlgHS256, "hs")
+	assert.Equal(t, fdmiddleware.ErrJWTKeyNotFound, err)
+
+	time.Sleep(50 * time.Millisecond)
+
+	key, err := jwks.JWTKey(context.Background(), fdmiddleware.JWTAlgHS256, "hs")
+	assert.NoError(t, err)
+	assert.Equal(t, secret, key)
+}
+
+func TestJWKS_FailToLoad(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer ts.Close()
+
+	_, err := fdmiddleware.NewJWKS(nil, ts.URL, 0)
+	assert.Error(t, err)
+}
+
+func TestJWKS_Timeout(t *testing.T) {
+	done := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		<-done
+	}))
+	defer ts.Close()
+	defer close(done)
+
+	timeout := fdmiddleware.JWKSTimeout
+	fdmiddleware.JWKSTimeout = 50 * time.Millisecond
+	defer func() {
+		fdmiddleware.JWKSTimeout = timeout
+	}()
+
+	start := time.Now()
+	_, err := fdmiddleware.NewJWKS(http.DefaultClient, ts.URL, 0)
+	assert.Error(t, err)
+	assert.True(t, time.Since(start) < time.Second)
+}
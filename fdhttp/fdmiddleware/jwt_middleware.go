@@ -0,0 +1,163 @@
+package fdmiddleware
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// JWTMiddleware validate bearer tokens sent in the Authorization header and
+// save its claims into the request context, read them using fdmiddleware.Claims(ctx).
+// Requests without a valid token receive 401 Unauthorized.
+type JWTMiddleware struct {
+	// Keys provide the key to verify the token signature.
+	Keys JWTKeyProvider
+	// Algorithms accepted, by default HS256, RS256 and ES256.
+	Algorithms []string
+	// Issuer if not empty need to be equal to "iss" claim.
+	Issuer string
+	// Audience if not empty need to be one of the values of "aud" claim.
+	Audience string
+	// Leeway is the tolerance to validate "exp" and "nbf" claims when clocks
+	// are not synchronized, by default 1 minute.
+	Leeway time.Duration
+	// Optional let requests without Authorization header pass, but if the
+	// header is sent it still need to be valid.
+	Optional bool
+	// Logger receive the reason of rejected tokens, the response only says
+	// the token is invalid.
+	Logger Logger
+}
+
+// NewJWTMiddleware create a middleware that validate tokens using keys, check
+// fdmiddleware.JWTStaticKeys or fdmiddleware.NewJWKS.
+func NewJWTMiddleware(keys JWTKeyProvider) *JWTMiddleware {
+	return &JWTMiddleware{
+		Keys:       keys,
+		Algorithms: []string{JWTAlgHS256, JWTAlgRS256, JWTAlgES256},
+		Leeway:     1 * time.Minute,
+	}
+}
+
+// Wrap will be called in every request
+func (m *JWTMiddleware) Wrap(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, req *http.Request) {
+		authorization := req.Header.Get("Authorization")
+		if authorization == "" && m.Optional {
+			next.ServeHTTP(w, req)
+			return
+		}
+
+		if len(authorization) < 7 || !strings.EqualFold(authorization[:7], "Bearer ") {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			responseError(w, http.StatusUnauthorized, "unauthorized", "Bearer token is required")
+			return
+		}
+
+		claims, err := m.Parse(req.Context(), strings.TrimSpace(authorization[7:]))
+		if err != nil {
+			if m.Logger != nil {
+				m.Logger.Printf("%s %s: %s", req.Method, req.URL.Path, err)
+			}
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			responseError(w, http.StatusUnauthorized, "invalid_token", "Bearer token is invalid")
+			return
+		}
+
+		ctx := SetClaims(req.Context(), claims)
+		next.ServeHTTP(w, req.WithContext(ctx))
+	}
+
+	return http.HandlerFunc(fn)
+}
+
+// Parse verify the token signature and validate exp, nbf, iss and aud claims.
+func (m *JWTMiddleware) Parse(ctx context.Context, token string) (JWTClaims, error) {
+	header, claims, signed, sig, err := splitJWT(token)
+	if err != nil {
+		return nil, err
+	}
+
+	if !contains(m.Algorithms, header.Alg) {
+		return nil, ErrJWTUnsupportedAlg
+	}
+
+	key, err := m.Keys.JWTKey(ctx, header.Alg, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := verifyJWTSignature(header.Alg, key, signed, sig); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if exp := claims.ExpiresAt(); !exp.IsZero() && now.After(exp.Add(m.Leeway)) {
+		return nil, ErrJWTExpired
+	}
+	if nbf := claims.NotBefore(); !nbf.IsZero() && now.Before(nbf.Add(-m.Leeway)) {
+		return nil, ErrJWTNotValidYet
+	}
+	if m.Issuer != "" && claims.Issuer() != m.Issuer {
+		return nil, ErrJWTInvalidIssuer
+	}
+	if m.Audience != "" && !contains(claims.Audience(), m.Audience) {
+		return nil, ErrJWTInvalidAudience
+	}
+
+	return claims, nil
+}
+
+// RequireScopes return a middleware that only accept requests where the token
+// was granted all scopes. Use it with a sub router to protect some endpoints:
+//  admin := router.SubRouter()
+//  admin.Use(fdmiddleware.RequireScopes("orders:write"))
+// It needs to run after JWTMiddleware.
+func RequireScopes(scopes ...string) Middleware {
+	return requireClaims(func(claims JWTClaims) error {
+		for _, s := range scopes {
+			if !claims.HasScope(s) {
+				return fmt.Errorf("Scope '%s' is required", s)
+			}
+		}
+		return nil
+	})
+}
+
+// RequireRoles return a middleware that only accept requests where the token
+// has at least one of roles. It needs to run after JWTMiddleware.
+func RequireRoles(roles ...string) Middleware {
+	return requireClaims(func(claims JWTClaims) error {
+		for _, r := range roles {
+			if claims.HasRole(r) {
+				return nil
+			}
+		}
+		return fmt.Errorf("One of roles '%s' is required", strings.Join(roles, "', '"))
+	})
+}
+
+func requireClaims(check func(JWTClaims) error) Middleware {
+	return MiddlewareFunc(func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, req *http.Request) {
+			claims := Claims(req.Context())
+			if claims == nil {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				responseError(w, http.StatusUnauthorized, "unauthorized", "Bearer token is required")
+				return
+			}
+
+			if err := check(claims); err != nil {
+				w.Header().Set("WWW-Authenticate", `Bearer error="insufficient_scope"`)
+				responseError(w, http.StatusForbidden, "forbidden", err.Error())
+				return
+			}
+
+			next.ServeHTTP(w, req)
+		}
+
+		return http.HandlerFunc(fn)
+	})
+}
@@ -0,0 +1,266 @@
+package fdmiddleware_test
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/foodora/go-ranger/fdhttp"
+	"github.com/foodora/go-ranger/fdhttp/fdmiddleware"
+	"github.com/stretchr/testify/assert"
+)
+
+func signJWT(t *testing.T, alg, kid string, key interface{}, claims map[string]interface{}) string {
+	header := map[string]string{"alg": alg, "typ": "JWT"}
+	if kid != "" {
+		header["kid"] = kid
+	}
+
+	rawHeader, _ := json.Marshal(header)
+	rawClaims, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(rawHeader) + "." + base64.RawURLEncoding.EncodeToString(rawClaims)
+	hashed := sha256.Sum256([]byte(signed))
+
+	var sig []byte
+	switch alg {
+	case "HS256":
+		mac := hmac.New(sha256.New, key.([]byte))
+		mac.Write([]byte(signed))
+		sig = mac.Sum(nil)
+	case "RS256":
+		var err error
+		sig, err = rsa.SignPKCS1v15(rand.Reader, key.(*rsa.PrivateKey), crypto.SHA256, hashed[:])
+		assert.NoError(t, err)
+	case "ES256":
+		r, s, err := ecdsa.Sign(rand.Reader, key.(*ecdsa.PrivateKey), hashed[:])
+		assert.NoError(t, err)
+		sig = make([]byte, 64)
+		rb, sb := r.Bytes(), s.Bytes()
+		copy(sig[32-len(rb):32], rb)
+		copy(sig[64-len(sb):], sb)
+	}
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func newJWTRouter(m *fdmiddleware.JWTMiddleware) *fdhttp.Router {
+	router := fdhttp.NewRouter()
+	router.Use(m)
+	router.GET("/me", func(ctx context.Context) (int, interface{}) {
+		claims := fdmiddleware.Claims(ctx)
+		return http.StatusOK, map[string]interface{}{
+			"sub":    claims.Subject(),
+			"scopes": claims.Scopes(),
+		}
+	})
+
+	admin := router.SubRouter()
+	admin.Use(fdmiddleware.RequireScopes("orders:write"))
+	admin.POST("/orders", func(ctx context.Context) (int, interface{}) {
+		return http.StatusCreated, nil
+	})
+
+	support := router.SubRouter()
+	support.Use(fdmiddleware.RequireRoles("admin", "support"))
+	support.DELETE("/orders/:id", func(ctx context.Context) (int, interface{}) {
+		return http.StatusNoContent, nil
+	})
+
+	return router
+}
+
+func callJWTRouter(router http.Handler, method, path, token string) (*httptest.ResponseRecorder, fdhttp.Error) {
+	req := httptest.NewRequest(method, path, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var respErr fdhttp.Error
+	json.Unmarshal(w.Body.Bytes(), &respErr)
+	return w, respErr
+}
+
+func TestJWTMiddleware_Algorithms(t *testing.T) {
+	secret := []byte("my-secret")
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	m := fdmiddleware.NewJWTMiddleware(fdmiddleware.JWTStaticKeys{
+		"":   secret,
+		"rs": &rsaKey.PublicKey,
+		"es": &ecKey.PublicKey,
+	})
+	router := newJWTRouter(m)
+
+	claims := map[string]interface{}{
+		"sub":   "user-1",
+		"scope": "orders:read orders:write",
+		"exp":   time.Now().Add(time.Hour).Unix(),
+	}
+
+	tokens := map[string]string{
+		"HS256": signJWT(t, "HS256", "", secret, claims),
+		"RS256": signJWT(t, "RS256", "rs", rsaKey, claims),
+		"ES256": signJWT(t, "ES256", "es", ecKey, claims),
+	}
+
+	for alg, token := range tokens {
+		w, _ := callJWTRouter(router, http.MethodGet, "/me", token)
+		assert.Equal(t, http.StatusOK, w.Code, alg)
+		assert.JSONEq(t, `{"sub":"user-1","scopes":["orders:read","orders:write"]}`, w.Body.String(), alg)
+	}
+}
+
+func TestJWTMiddleware_InvalidTokens(t *testing.T) {
+	secret := []byte("my-secret")
+
+	m := fdmiddleware.NewJWTMiddleware(fdmiddleware.JWTStaticKeys{"": secret})
+	m.Issuer = "https://auth.foodora.com"
+	m.Audience = "orders"
+	m.Leeway = 0
+	log := &bufferLogger{}
+	m.Logger = log
+	router := newJWTRouter(m)
+
+	valid := func() map[string]interface{} {
+		return map[string]interface{}{
+			"iss": "https://auth.foodora.com",
+			"aud": []string{"orders", "menu"},
+			"exp": time.Now().Add(time.Hour).Unix(),
+			"nbf": time.Now().Add(-time.Hour).Unix(),
+		}
+	}
+
+	w, _ := callJWTRouter(router, http.MethodGet, "/me", signJWT(t, "HS256", "", secret, valid()))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w, respErr := callJWTRouter(router, http.MethodGet, "/me", "")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, "unauthorized", respErr.Code)
+	assert.Equal(t, "Bearer", w.Header().Get("WWW-Authenticate"))
+
+	cases := map[string]struct {
+		token string
+		err   error
+	}{
+		"malformed": {
+			token: "not-a-token",
+			err:   fdmiddleware.ErrJWTMalformed,
+		},
+		"wrong secret": {
+			token: signJWT(t, "HS256", "", []byte("other"), valid()),
+			err:   fdmiddleware.ErrJWTInvalidSignature,
+		},
+		"unknown kid": {
+			token: signJWT(t, "HS256", "unknown", secret, valid()),
+			err:   fdmiddleware.ErrJWTKeyNotFound,
+		},
+		"expired": {
+			token: signJWT(t, "HS256", "", secret, func() map[string]interface{} {
+				c := valid()
+				c["exp"] = time.Now().Add(-time.Minute).Unix()
+				return c
+			}()),
+			err: fdmiddleware.ErrJWTExpired,
+		},
+		"not valid yet": {
+			token: signJWT(t, "HS256", "", secret, func() map[string]interface{} {
+				c := valid()
+				c["nbf"] = time.Now().Add(time.Minute).Unix()
+				return c
+			}()),
+			err: fdmiddleware.ErrJWTNotValidYet,
+		},
+		"wrong issuer": {
+			token: signJWT(t, "HS256", "", secret, func() map[string]interface{} {
+				c := valid()
+				c["iss"] = "https://evil.com"
+				return c
+			}()),
+			err: fdmiddleware.ErrJWTInvalidIssuer,
+		},
+		"wrong audience": {
+			token: signJWT(t, "HS256", "", secret, func() map[string]interface{} {
+				c := valid()
+				c["aud"] = "menu"
+				return c
+			}()),
+			err: fdmiddleware.ErrJWTInvalidAudience,
+		},
+	}
+
+	for name, c := range cases {
+		log.Reset()
+		w, respErr := callJWTRouter(router, http.MethodGet, "/me", c.token)
+		assert.Equal(t, http.StatusUnauthorized, w.Code, name)
+		assert.Equal(t, "invalid_token", respErr.Code, name)
+		assert.Equal(t, "Bearer token is invalid", respErr.Message, name)
+		assert.Equal(t, "GET /me: "+c.err.Error(), log.String(), name)
+	}
+}
+
+func TestJWTMiddleware_RejectNoneAlgorithm(t *testing.T) {
+	m := fdmiddleware.NewJWTMiddleware(fdmiddleware.JWTStaticKeys{"": []byte("my-secret")})
+
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none"}`))
+	claims := base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"user-1"}`))
+
+	_, err := m.Parse(context.Background(), header+"."+claims+".")
+	assert.Equal(t, fdmiddleware.ErrJWTUnsupportedAlg, err)
+}
+
+func TestJWTMiddleware_Optional(t *testing.T) {
+	m := fdmiddleware.NewJWTMiddleware(fdmiddleware.JWTStaticKeys{"": []byte("my-secret")})
+	m.Optional = true
+	router := newJWTRouter(m)
+
+	w, _ := callJWTRouter(router, http.MethodGet, "/me", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w, _ = callJWTRouter(router, http.MethodGet, "/me", "invalid")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// endpoint requiring a scope still need a token
+	w, _ = callJWTRouter(router, http.MethodPost, "/orders", "")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestRequireScopesAndRoles(t *testing.T) {
+	secret := []byte("my-secret")
+	router := newJWTRouter(fdmiddleware.NewJWTMiddleware(fdmiddleware.JWTStaticKeys{"": secret}))
+
+	reader := signJWT(t, "HS256", "", secret, map[string]interface{}{
+		"scp":   []string{"orders:read"},
+		"roles": "customer",
+	})
+	writer := signJWT(t, "HS256", "", secret, map[string]interface{}{
+		"scp":   []string{"orders:read", "orders:write"},
+		"roles": []string{"support"},
+	})
+
+	w, respErr := callJWTRouter(router, http.MethodPost, "/orders", reader)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Equal(t, "forbidden", respErr.Code)
+
+	w, _ = callJWTRouter(router, http.MethodPost, "/orders", writer)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	w, _ = callJWTRouter(router, http.MethodDelete, "/orders/1", reader)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w, _ = callJWTRouter(router, http.MethodDelete, "/orders/1", writer)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+}
@@ -0,0 +1,104 @@
+package fdmiddleware
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// limiter control how many calls can be in flight at the same time, with
+// a bounded queue for calls waiting for a free slot.
+type limiter struct {
+	mu       sync.Mutex
+	limit    int
+	inflight int
+	maxQueue int
+	waiters  *list.List
+}
+
+// newLimiter create a limiter, limit <= 0 means unlimited.
+func newLimiter(limit, maxQueue int) *limiter {
+	return &limiter{
+		limit:    limit,
+		maxQueue: maxQueue,
+		waiters:  list.New(),
+	}
+}
+
+// acquire return true if a slot was reserved, the caller need to call release()
+// when it finishes. If no slot is free it waits in the queue until timeout
+// or ctx is done.
+func (l *limiter) acquire(ctx context.Context, timeout time.Duration) bool {
+	l.mu.Lock()
+	if l.limit <= 0 || l.inflight < l.limit {
+		l.inflight++
+		l.mu.Unlock()
+		return true
+	}
+
+	if timeout <= 0 || l.waiters.Len() >= l.maxQueue {
+		l.mu.Unlock()
+		return false
+	}
+
+	ready := make(chan struct{})
+	e := l.waiters.PushBack(ready)
+	l.mu.Unlock()
+
+	t := time.NewTimer(timeout)
+	defer t.Stop()
+
+	select {
+	case <-ready:
+		return true
+	case <-t.C:
+	case <-ctx.Done():
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	select {
+	case <-ready:
+		// slot was given while we were giving up
+		return true
+	default:
+	}
+
+	l.waiters.Remove(e)
+	return false
+}
+
+// release free a slot reserved by acquire.
+func (l *limiter) release() {
+	l.mu.Lock()
+	l.inflight--
+	l.wakeUp()
+	l.mu.Unlock()
+}
+
+// setLimit change the limit, calls in flight are not affected.
+func (l *limiter) setLimit(limit int) {
+	l.mu.Lock()
+	l.limit = limit
+	l.wakeUp()
+	l.mu.Unlock()
+}
+
+// wakeUp give free slots to who is waiting, it need to be called with lock.
+func (l *limiter) wakeUp() {
+	for l.waiters.Len() > 0 && (l.limit <= 0 || l.inflight < l.limit) {
+		e := l.waiters.Front()
+		l.waiters.Remove(e)
+		l.inflight++
+		close(e.Value.(chan struct{}))
+	}
+}
+
+// usage return the number of calls in flight, waiting and the current limit.
+func (l *limiter) usage() (inflight, queued, limit int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.inflight, l.waiters.Len(), l.limit
+}
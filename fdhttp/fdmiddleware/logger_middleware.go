@@ -1,7 +1,9 @@
 package fdmiddleware
 
 import (
+	"bufio"
 	"bytes"
+	"errors"
 	"html/template"
 	"net"
 	"net/http"
@@ -100,11 +102,32 @@ func (lr *LogResponse) StatusText() string {
 	return http.StatusText(lr.StatusCode)
 }
 
+// Flush implements http.Flusher to keep streaming responses working.
+func (lr *LogResponse) Flush() {
+	if f, ok := lr.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack implements http.Hijacker to keep websockets working.
+func (lr *LogResponse) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := lr.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("fdmiddleware: response writer doesn't support hijack")
+	}
+
+	if lr.StatusCode == 0 {
+		lr.StatusCode = http.StatusSwitchingProtocols
+	}
+	return hj.Hijack()
+}
+
+// getRemoteAddr return the client ip resolved by RealIP middleware, we don't
+// read X-Forwarded-For directly because any client can send it.
 func getRemoteAddr(req *http.Request) string {
-	remoteAddr := req.Header.Get("X-Forwarded-For")
-	if remoteAddr == "" {
-		remoteAddr, _, _ = net.SplitHostPort(req.RemoteAddr)
+	if ip := ClientIP(req.Context()); ip != "" {
+		return ip
 	}
 
-	return remoteAddr
+	return remoteIP(req)
 }
@@ -0,0 +1,418 @@
+package fdmiddleware
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// MirrorHeader is sent with shadow requests, so the shadow upstream can
+// tell them apart from production traffic.
+const MirrorHeader = "X-Mirror"
+
+// MirrorDefaultMethods are mirrored when Mirror.Methods is empty, only safe
+// methods to not duplicate writes in the shadow upstream.
+var MirrorDefaultMethods = []string{http.MethodGet, http.MethodHead, http.MethodOptions}
+
+// hopHeaders are removed from shadow requests, like httputil.ReverseProxy.
+var hopHeaders = []string{
+	"Connection",
+	"Proxy-Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// Doer send http requests, *fdhttp.ClientImpl implements it.
+type Doer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// MirrorStats count the shadow requests and their differences to primary.
+type MirrorStats struct {
+	// Mirrored is the number of shadow requests sent.
+	Mirrored int64 `json:"mirrored"`
+	// Skipped is the number of sampled requests not mirrored, because body
+	// was too large or too many shadow requests were in flight.
+	Skipped          int64 `json:"skipped"`
+	Errors           int64 `json:"errors"`
+	Matches          int64 `json:"matches"`
+	StatusMismatches int64 `json:"status_mismatches"`
+	BodyMismatches   int64 `json:"body_mismatches"`
+}
+
+// MirrorDiff describe a shadow response different from primary.
+type MirrorDiff struct {
+	Method        string
+	URL           string
+	PrimaryStatus int
+	ShadowStatus  int
+	PrimaryHash   string
+	ShadowHash    string
+	Err           error
+}
+
+// Mirror is a middleware that copy a sample of requests to a shadow
+// upstream, to validate a new service against production traffic:
+//  mirror, err := fdmiddleware.NewMirrorMiddleware(client, "http://orders-v2", 10)
+//  mirror.OnDiff = func(diff *fdmiddleware.MirrorDiff) {
+//      log.Printf("%s %s: %d != %d", diff.Method, diff.URL, diff.PrimaryStatus, diff.ShadowStatus)
+//  }
+//  router.Use(mirror)
+// Shadow requests are sent after primary finishes and their responses are
+// thrown away, they never delay or change the response to the client.
+type Mirror struct {
+	client   Doer
+	upstream *url.URL
+	inflight chan struct{}
+	wg       sync.WaitGroup
+	stats    MirrorStats
+
+	// Percentage of requests mirrored, between 0 and 100.
+	Percentage float64
+	// Methods mirrored, by default MirrorDefaultMethods. Add methods that
+	// write only if the shadow upstream doesn't have side effects.
+	Methods []string
+	// MaxBodySize is the largest request body buffered to be mirrored,
+	// by default 1MB.
+	MaxBodySize int64
+	// Timeout of each shadow request, by default 5 seconds.
+	Timeout time.Duration
+	// OnDiff is called when shadow response is different from primary or
+	// shadow request failed.
+	OnDiff func(diff *MirrorDiff)
+}
+
+// NewMirrorMiddleware mirror percentage of requests to upstream using client,
+// with at most 100 shadow requests in flight.
+func NewMirrorMiddleware(client Doer, upstream string, percentage float64) (*Mirror, error) {
+	u, err := url.Parse(upstream)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return nil, errors.New("fdmiddleware: mirror upstream must be an absolute url")
+	}
+
+	return &Mirror{
+		client:      client,
+		upstream:    u,
+		inflight:    make(chan struct{}, 100),
+		Percentage:  percentage,
+		MaxBodySize: 1 << 20,
+		Timeout:     5 * time.Second,
+	}, nil
+}
+
+// Stats return the counters since the middleware was created.
+func (m *Mirror) Stats() MirrorStats {
+	return MirrorStats{
+		Mirrored:         atomic.LoadInt64(&m.stats.Mirrored),
+		Skipped:          atomic.LoadInt64(&m.stats.Skipped),
+		Errors:           atomic.LoadInt64(&m.stats.Errors),
+		Matches:          atomic.LoadInt64(&m.stats.Matches),
+		StatusMismatches: atomic.LoadInt64(&m.stats.StatusMismatches),
+		BodyMismatches:   atomic.LoadInt64(&m.stats.BodyMismatches),
+	}
+}
+
+// HealthCheck implements fdhandler.HealthChecker reporting Stats.
+func (m *Mirror) HealthCheck(ctx context.Context) (interface{}, error) {
+	return m.Stats(), nil
+}
+
+// Wait for shadow requests in flight, call it during shutdown.
+func (m *Mirror) Wait() {
+	m.wg.Wait()
+}
+
+// Wrap implements Middleware
+func (m *Mirror) Wrap(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, req *http.Request) {
+		if !m.sample(req) {
+			next.ServeHTTP(w, req)
+			return
+		}
+
+		body, ok, err := m.bufferBody(req)
+		if err != nil || !ok {
+			atomic.AddInt64(&m.stats.Skipped, 1)
+			next.ServeHTTP(w, req)
+			return
+		}
+
+		shadow := m.shadowRequest(req, body)
+
+		mw := &mirrorResponse{ResponseWriter: w, hash: sha256.New()}
+		next.ServeHTTP(mw, req)
+
+		if mw.hijacked {
+			return
+		}
+
+		select {
+		case m.inflight <- struct{}{}:
+		default:
+			atomic.AddInt64(&m.stats.Skipped, 1)
+			return
+		}
+
+		m.wg.Add(1)
+		go func() {
+			defer m.wg.Done()
+			defer func() { <-m.inflight }()
+
+			m.send(shadow, mw.status(), hex.EncodeToString(mw.hash.Sum(nil)))
+		}()
+	}
+
+	return http.HandlerFunc(fn)
+}
+
+func (m *Mirror) sample(req *http.Request) bool {
+	if m.Percentage <= 0 || req.Header.Get("Upgrade") != "" || req.Header.Get(MirrorHeader) != "" {
+		return false
+	}
+
+	methods := m.Methods
+	if len(methods) == 0 {
+		methods = MirrorDefaultMethods
+	}
+	if !contains(methods, req.Method) {
+		return false
+	}
+	return m.Percentage >= 100 || rand.Float64()*100 < m.Percentage
+}
+
+// bufferBody read the body to be sent again to shadow, ok is false when body
+// is larger than MaxBodySize and it's left to primary unread.
+func (m *Mirror) bufferBody(req *http.Request) (body []byte, ok bool, err error) {
+	if req.PostForm != nil || req.MultipartForm != nil {
+		// fdhttp.Router parse forms before middlewares, consuming the body
+		body, err = encodeForm(req)
+		if err != nil {
+			return nil, false, err
+		}
+		return body, int64(len(body)) <= m.MaxBodySize, nil
+	}
+
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, true, nil
+	}
+
+	body, err = ioutil.ReadAll(io.LimitReader(req.Body, m.MaxBodySize+1))
+	if err != nil {
+		return nil, false, err
+	}
+
+	if int64(len(body)) > m.MaxBodySize {
+		req.Body = &multiReadCloser{
+			Reader: io.MultiReader(bytes.NewReader(body), req.Body),
+			Closer: req.Body,
+		}
+		return nil, false, nil
+	}
+
+	req.Body.Close()
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	return body, true, nil
+}
+
+// shadowRequest copy req to upstream, before primary handler changes it.
+func (m *Mirror) shadowRequest(req *http.Request, body []byte) *http.Request {
+	u := *m.upstream
+	u.Path = strings.TrimSuffix(u.Path, "/") + req.URL.Path
+	u.RawPath = ""
+	u.RawQuery = req.URL.RawQuery
+
+	shadow := &http.Request{
+		Method:        req.Method,
+		URL:           &u,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        cloneHeader(req.Header),
+		Host:          u.Host,
+		ContentLength: int64(len(body)),
+	}
+	if len(body) > 0 {
+		shadow.Body = ioutil.NopCloser(bytes.NewReader(body))
+		shadow.GetBody = func() (io.ReadCloser, error) {
+			return ioutil.NopCloser(bytes.NewReader(body)), nil
+		}
+	}
+	removeHopHeaders(shadow.Header)
+	shadow.Header.Set(MirrorHeader, "true")
+
+	return shadow
+}
+
+func (m *Mirror) send(shadow *http.Request, primaryStatus int, primaryHash string) {
+	atomic.AddInt64(&m.stats.Mirrored, 1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.Timeout)
+	defer cancel()
+
+	diff := &MirrorDiff{
+		Method:        shadow.Method,
+		URL:           shadow.URL.String(),
+		PrimaryStatus: primaryStatus,
+		PrimaryHash:   primaryHash,
+	}
+
+	resp, err := m.client.Do(shadow.WithContext(ctx))
+	if err == nil {
+		h := sha256.New()
+		_, err = io.Copy(h, resp.Body)
+		resp.Body.Close()
+
+		diff.ShadowStatus = resp.StatusCode
+		diff.ShadowHash = hex.EncodeToString(h.Sum(nil))
+	}
+
+	switch {
+	case err != nil:
+		diff.Err = err
+		atomic.AddInt64(&m.stats.Errors, 1)
+	case diff.ShadowStatus != diff.PrimaryStatus:
+		atomic.AddInt64(&m.stats.StatusMismatches, 1)
+	case diff.ShadowHash != diff.PrimaryHash:
+		atomic.AddInt64(&m.stats.BodyMismatches, 1)
+	default:
+		atomic.AddInt64(&m.stats.Matches, 1)
+		return
+	}
+
+	if m.OnDiff != nil {
+		m.OnDiff(diff)
+	}
+}
+
+// encodeForm build the body again from a parsed form.
+func encodeForm(req *http.Request) ([]byte, error) {
+	if req.MultipartForm == nil {
+		return []byte(req.PostForm.Encode()), nil
+	}
+
+	_, params, err := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, err
+	}
+
+	var b bytes.Buffer
+	w := multipart.NewWriter(&b)
+	if err := w.SetBoundary(params["boundary"]); err != nil {
+		return nil, err
+	}
+
+	for name, values := range req.MultipartForm.Value {
+		for _, v := range values {
+			w.WriteField(name, v)
+		}
+	}
+	for _, files := range req.MultipartForm.File {
+		for _, fh := range files {
+			part, err := w.CreatePart(fh.Header)
+			if err != nil {
+				return nil, err
+			}
+			f, err := fh.Open()
+			if err != nil {
+				return nil, err
+			}
+			_, err = io.Copy(part, f)
+			f.Close()
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// removeHopHeaders remove headers that are meaningful only for a single
+// connection, including the ones listed in Connection.
+func removeHopHeaders(header http.Header) {
+	for _, v := range header["Connection"] {
+		for _, name := range strings.Split(v, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				header.Del(name)
+			}
+		}
+	}
+	for _, name := range hopHeaders {
+		header.Del(name)
+	}
+}
+
+// mirrorResponse hash the primary response while it's sent.
+type mirrorResponse struct {
+	http.ResponseWriter
+	hash       hash.Hash
+	statusCode int
+	hijacked   bool
+}
+
+func (w *mirrorResponse) WriteHeader(code int) {
+	if w.statusCode == 0 {
+		w.statusCode = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *mirrorResponse) Write(b []byte) (int, error) {
+	if w.statusCode == 0 {
+		w.statusCode = http.StatusOK
+	}
+	w.hash.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *mirrorResponse) status() int {
+	if w.statusCode == 0 {
+		return http.StatusOK
+	}
+	return w.statusCode
+}
+
+// Flush implements http.Flusher
+func (w *mirrorResponse) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack implements http.Hijacker, hijacked requests are not mirrored.
+func (w *mirrorResponse) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("fdmiddleware: response writer doesn't support hijack")
+	}
+
+	w.hijacked = true
+	return hj.Hijack()
+}
@@ -0,0 +1,218 @@
+package fdmiddleware_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/foodora/go-ranger/fdhttp"
+	"github.com/foodora/go-ranger/fdhttp/fdmiddleware"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMirror(t *testing.T) {
+	var mu sync.Mutex
+	var shadowBodies []string
+	shadow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+		assert.Equal(t, "true", req.Header.Get(fdmiddleware.MirrorHeader))
+		assert.Equal(t, "v2", req.URL.Query().Get("version"))
+
+		mu.Lock()
+		shadowBodies = append(shadowBodies, string(body))
+		mu.Unlock()
+
+		switch req.URL.Path {
+		case "/v2/orders/1":
+			w.Write([]byte(`{"id":1}`))
+		case "/v2/orders/2":
+			w.Write([]byte(`{"id":"2"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer shadow.Close()
+
+	mirror, err := fdmiddleware.NewMirrorMiddleware(http.DefaultClient, shadow.URL+"/v2", 100)
+	assert.NoError(t, err)
+	mirror.Methods = []string{http.MethodPut}
+
+	var diffs []*fdmiddleware.MirrorDiff
+	mirror.OnDiff = func(diff *fdmiddleware.MirrorDiff) {
+		mu.Lock()
+		diffs = append(diffs, diff)
+		mu.Unlock()
+	}
+
+	handler := mirror.Wrap(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+		assert.Equal(t, `{"status":"paid"}`, string(body), "primary should receive the body")
+
+		id := strings.TrimPrefix(req.URL.Path, "/orders/")
+		w.Write([]byte(`{"id":` + id + `}`))
+	}))
+
+	for _, id := range []string{"1", "2", "3"} {
+		req := httptest.NewRequest(http.MethodPut, "/orders/"+id+"?version=v2", strings.NewReader(`{"status":"paid"}`))
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		assert.Equal(t, `{"id":`+id+`}`, w.Body.String())
+	}
+	mirror.Wait()
+
+	assert.Equal(t, fdmiddleware.MirrorStats{
+		Mirrored:         3,
+		Matches:          1,
+		BodyMismatches:   1,
+		StatusMismatches: 1,
+	}, mirror.Stats())
+	assert.Equal(t, []string{`{"status":"paid"}`, `{"status":"paid"}`, `{"status":"paid"}`}, shadowBodies)
+
+	if assert.Len(t, diffs, 2) {
+		for _, diff := range diffs {
+			assert.Equal(t, http.MethodPut, diff.Method)
+			assert.Equal(t, http.StatusOK, diff.PrimaryStatus)
+			assert.NotEqual(t, diff.PrimaryHash, diff.ShadowHash)
+		}
+	}
+}
+
+func TestMirror_Skip(t *testing.T) {
+	var calls int
+	shadow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		calls++
+	}))
+	defer shadow.Close()
+
+	mirror, _ := fdmiddleware.NewMirrorMiddleware(http.DefaultClient, shadow.URL, 100)
+	mirror.Methods = []string{http.MethodPost}
+	mirror.MaxBodySize = 4
+
+	handler := mirror.Wrap(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+		w.Write(body)
+	}))
+
+	// body too large is not mirrored, but primary receive it
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/upload", strings.NewReader("large body")))
+	assert.Equal(t, "large body", w.Body.String())
+
+	mirror.Percentage = 0
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	mirror.Wait()
+
+	assert.Equal(t, 0, calls)
+	assert.Equal(t, fdmiddleware.MirrorStats{Skipped: 1}, mirror.Stats())
+}
+
+func TestMirror_ShadowError(t *testing.T) {
+	shadow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	shadow.Close()
+
+	mirror, _ := fdmiddleware.NewMirrorMiddleware(http.DefaultClient, shadow.URL, 100)
+	mirror.Methods = []string{http.MethodPost}
+
+	var diff *fdmiddleware.MirrorDiff
+	mirror.OnDiff = func(d *fdmiddleware.MirrorDiff) {
+		diff = d
+	}
+
+	handler := mirror.Wrap(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/orders", nil))
+	assert.Equal(t, http.StatusCreated, w.Code)
+	mirror.Wait()
+
+	assert.Equal(t, int64(1), mirror.Stats().Errors)
+	if assert.NotNil(t, diff) {
+		assert.Error(t, diff.Err)
+		assert.Equal(t, http.StatusCreated, diff.PrimaryStatus)
+	}
+}
+
+func TestNewMirrorMiddleware_InvalidUpstream(t *testing.T) {
+	_, err := fdmiddleware.NewMirrorMiddleware(http.DefaultClient, "/relative", 10)
+	assert.Error(t, err)
+}
+
+func TestMirror_DefaultMethods(t *testing.T) {
+	var mu sync.Mutex
+	var methods []string
+	shadow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		methods = append(methods, req.Method)
+		mu.Unlock()
+	}))
+	defer shadow.Close()
+
+	mirror, _ := fdmiddleware.NewMirrorMiddleware(http.DefaultClient, shadow.URL, 100)
+	handler := mirror.Wrap(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+
+	for _, method := range []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete, http.MethodHead} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(method, "/orders/1", nil))
+	}
+	mirror.Wait()
+
+	assert.ElementsMatch(t, []string{http.MethodGet, http.MethodHead}, methods)
+	assert.Equal(t, int64(2), mirror.Stats().Mirrored)
+}
+
+func TestMirror_FormParsedByRouter(t *testing.T) {
+	var mu sync.Mutex
+	shadowForms := map[string]url.Values{}
+	shadow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		assert.Empty(t, req.Header.Get("Keep-Alive"))
+		assert.Empty(t, req.Header.Get("X-Hop"), "headers listed in Connection are removed")
+		assert.Equal(t, "tracing", req.Header.Get("X-Request-Id"))
+
+		req.ParseMultipartForm(1 << 20)
+		mu.Lock()
+		shadowForms[req.URL.Path] = req.Form
+		mu.Unlock()
+	}))
+	defer shadow.Close()
+
+	mirror, _ := fdmiddleware.NewMirrorMiddleware(http.DefaultClient, shadow.URL, 100)
+	mirror.Methods = []string{http.MethodPost}
+
+	router := fdhttp.NewRouter()
+	router.Use(mirror)
+	router.StdPOST("/login", func(w http.ResponseWriter, req *http.Request) {})
+	router.StdPOST("/upload", func(w http.ResponseWriter, req *http.Request) {})
+
+	req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader("user=john&remember=1"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Connection", "X-Hop")
+	req.Header.Set("X-Hop", "1")
+	req.Header.Set("Keep-Alive", "timeout=5")
+	req.Header.Set("X-Request-Id", "tracing")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	var b bytes.Buffer
+	w := multipart.NewWriter(&b)
+	w.WriteField("name", "menu")
+	part, _ := w.CreateFormFile("file", "menu.csv")
+	part.Write([]byte("pizza,10"))
+	w.Close()
+
+	req = httptest.NewRequest(http.MethodPost, "/upload", &b)
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	req.Header.Set("X-Request-Id", "tracing")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+	mirror.Wait()
+
+	assert.Equal(t, "john", shadowForms["/login"].Get("user"))
+	assert.Equal(t, "1", shadowForms["/login"].Get("remember"))
+	assert.Equal(t, "menu", shadowForms["/upload"].Get("name"))
+	assert.Equal(t, int64(2), mirror.Stats().Mirrored)
+}
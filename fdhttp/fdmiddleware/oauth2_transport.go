@@ -0,0 +1,259 @@
+package fdmiddleware
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OAuth2Token is an access token received from the token endpoint.
+type OAuth2Token struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+	// Expiry is calculated from ExpiresIn when the token is received, zero
+	// means it doesn't expire.
+	Expiry time.Time `json:"-"`
+}
+
+// valid return true if token doesn't expire within delta. delta is limited
+// to half of the token lifetime, otherwise short lived tokens would never be
+// valid.
+func (t *OAuth2Token) valid(delta time.Duration) bool {
+	if t == nil || t.AccessToken == "" {
+		return false
+	}
+
+	if lifetime := time.Duration(t.ExpiresIn) * time.Second; lifetime > 0 && delta > lifetime/2 {
+		delta = lifetime / 2
+	}
+
+	return t.Expiry.IsZero() || time.Now().Add(delta).Before(t.Expiry)
+}
+
+// OAuth2Error is returned when the token endpoint doesn't return a token.
+type OAuth2Error struct {
+	StatusCode  int    `json:"-"`
+	Code        string `json:"error"`
+	Description string `json:"error_description"`
+}
+
+func (e *OAuth2Error) Error() string {
+	if e.Description != "" {
+		return fmt.Sprintf("fdmiddleware: oauth2 token request failed with %d %s: %s", e.StatusCode, e.Code, e.Description)
+	}
+	return fmt.Sprintf("fdmiddleware: oauth2 token request failed with %d %s", e.StatusCode, e.Code)
+}
+
+// OAuth2Transport authenticate requests with tokens from the client
+// credentials grant. Tokens are cached per audience until ExpiryDelta before
+// they expire, and goroutines needing a new token wait the same request.
+// Requests answered with 401 are sent again once with a new token:
+//  oauth := fdmiddleware.NewOAuth2Transport("https://auth.foodora.com/oauth/token", clientID, clientSecret, "orders:read")
+//  oauth.AudienceFunc = func(req *http.Request) string {
+//      return "https://" + req.URL.Host
+//  }
+//  client.Use(oauth)
+type OAuth2Transport struct {
+	TokenURL     string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+	// AudienceFunc return the audience sent in the token request, each
+	// audience has its own token. By default there's no audience.
+	AudienceFunc func(req *http.Request) string
+	// ExpiryDelta renew tokens before they expire, by default 30 seconds.
+	ExpiryDelta time.Duration
+	// CredentialsInBody send client id and secret in the body, instead of
+	// basic auth.
+	CredentialsInBody bool
+	// TokenTransport is used to request tokens, by default the transport
+	// wrapped by this middleware.
+	TokenTransport http.RoundTripper
+
+	mu     sync.Mutex
+	tokens map[string]*OAuth2Token
+	flight flightGroup
+}
+
+// NewOAuth2Transport create a transport requesting tokens to tokenURL.
+func NewOAuth2Transport(tokenURL, clientID, clientSecret string, scopes ...string) *OAuth2Transport {
+	return &OAuth2Transport{
+		TokenURL:     tokenURL,
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		Scopes:       scopes,
+		ExpiryDelta:  30 * time.Second,
+		tokens:       make(map[string]*OAuth2Token),
+	}
+}
+
+// Wrap implements ClientMiddleware
+func (t *OAuth2Transport) Wrap(next http.RoundTripper) http.RoundTripper {
+	tokenTransport := t.TokenTransport
+	if tokenTransport == nil {
+		tokenTransport = next
+	}
+
+	return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		var audience string
+		if t.AudienceFunc != nil {
+			audience = t.AudienceFunc(req)
+		}
+
+		token, err := t.token(req.Context(), tokenTransport, audience)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := next.RoundTrip(authorize(req, token))
+		if err != nil || resp.StatusCode != http.StatusUnauthorized || !canResend(req) {
+			return resp, err
+		}
+
+		// token can be revoked before it expires
+		t.invalidate(audience, token)
+		token, err = t.token(req.Context(), tokenTransport, audience)
+		if err != nil {
+			// keep the 401 to the caller
+			return resp, nil
+		}
+
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+
+		r := req
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			r = cloneRequest(req)
+			r.Body = body
+		}
+
+		return next.RoundTrip(authorize(r, token))
+	})
+}
+
+// Token return a valid token to audience, requesting a new one if needed.
+func (t *OAuth2Transport) Token(ctx context.Context, audience string) (*OAuth2Token, error) {
+	transport := t.TokenTransport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	return t.token(ctx, transport, audience)
+}
+
+func (t *OAuth2Transport) token(ctx context.Context, transport http.RoundTripper, audience string) (*OAuth2Token, error) {
+	t.mu.Lock()
+	token := t.tokens[audience]
+	t.mu.Unlock()
+
+	if token.valid(t.ExpiryDelta) {
+		return token, nil
+	}
+
+	v, err, shared := t.flight.do(audience, func() (interface{}, error) {
+		return t.requestToken(ctx, transport, audience)
+	})
+	if shared && err != nil && isContextErr(err) && ctx.Err() == nil {
+		// the goroutine that requested it gave up, but we didn't
+		v, err = t.requestToken(ctx, transport, audience)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return v.(*OAuth2Token), nil
+}
+
+func (t *OAuth2Transport) requestToken(ctx context.Context, transport http.RoundTripper, audience string) (*OAuth2Token, error) {
+	form := url.Values{}
+	form.Set("grant_type", "client_credentials")
+	if len(t.Scopes) > 0 {
+		form.Set("scope", strings.Join(t.Scopes, " "))
+	}
+	if audience != "" {
+		form.Set("audience", audience)
+	}
+	if t.CredentialsInBody {
+		form.Set("client_id", t.ClientID)
+		form.Set("client_secret", t.ClientSecret)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, t.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if !t.CredentialsInBody {
+		req.SetBasicAuth(url.QueryEscape(t.ClientID), url.QueryEscape(t.ClientSecret))
+	}
+
+	resp, err := transport.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		oauthErr := &OAuth2Error{StatusCode: resp.StatusCode}
+		json.Unmarshal(body, oauthErr)
+		return nil, oauthErr
+	}
+
+	token := &OAuth2Token{}
+	if err := json.Unmarshal(body, token); err != nil {
+		return nil, fmt.Errorf("fdmiddleware: invalid oauth2 token response: %s", err)
+	}
+	if token.AccessToken == "" {
+		return nil, &OAuth2Error{StatusCode: resp.StatusCode, Code: "missing_access_token"}
+	}
+	if token.ExpiresIn > 0 {
+		token.Expiry = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+	}
+
+	t.mu.Lock()
+	if t.tokens == nil {
+		t.tokens = make(map[string]*OAuth2Token)
+	}
+	t.tokens[audience] = token
+	t.mu.Unlock()
+
+	return token, nil
+}
+
+// invalidate remove token from cache, unless it was already renewed.
+func (t *OAuth2Transport) invalidate(audience string, token *OAuth2Token) {
+	t.mu.Lock()
+	if t.tokens[audience] == token {
+		delete(t.tokens, audience)
+	}
+	t.mu.Unlock()
+}
+
+// authorize return a copy of req with token.
+func authorize(req *http.Request, token *OAuth2Token) *http.Request {
+	r := cloneRequest(req)
+	r.Header.Set("Authorization", "Bearer "+token.AccessToken)
+	return r
+}
+
+// canResend return true if req body can be sent again.
+func canResend(req *http.Request) bool {
+	return req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+}
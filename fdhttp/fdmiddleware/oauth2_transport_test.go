@@ -0,0 +1,204 @@
+package fdmiddleware_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/foodora/go-ranger/fdhttp/fdmiddleware"
+	"github.com/stretchr/testify/assert"
+)
+
+type tokenServer struct {
+	*httptest.Server
+	requests  int32
+	expiresIn int
+	audiences []string
+	mu        sync.Mutex
+}
+
+func newTokenServer(t *testing.T, expiresIn int) *tokenServer {
+	s := &tokenServer{expiresIn: expiresIn}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		n := atomic.AddInt32(&s.requests, 1)
+
+		user, pass, _ := req.BasicAuth()
+		if user != "client" || pass != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error":"invalid_client","error_description":"bad credentials"}`))
+			return
+		}
+
+		req.ParseForm()
+		assert.Equal(t, "client_credentials", req.Form.Get("grant_type"))
+		assert.Equal(t, "orders:read orders:write", req.Form.Get("scope"))
+
+		s.mu.Lock()
+		s.audiences = append(s.audiences, req.Form.Get("audience"))
+		s.mu.Unlock()
+
+		// slow down to make concurrent requests wait
+		time.Sleep(10 * time.Millisecond)
+		fmt.Fprintf(w, `{"access_token":"token-%d","token_type":"bearer","expires_in":%d}`, n, s.expiresIn)
+	}))
+	return s
+}
+
+func (s *tokenServer) Requests() int {
+	return int(atomic.LoadInt32(&s.requests))
+}
+
+func newOAuth2Transport(tokenURL string) *fdmiddleware.OAuth2Transport {
+	return fdmiddleware.NewOAuth2Transport(tokenURL, "client", "secret", "orders:read", "orders:write")
+}
+
+func TestOAuth2Transport(t *testing.T) {
+	tokens := newTokenServer(t, 3600)
+	defer tokens.Close()
+
+	var authorization []string
+	var mu sync.Mutex
+	upstream := fdmiddleware.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if strings.HasPrefix(req.URL.String(), tokens.URL) {
+			return http.DefaultTransport.RoundTrip(req)
+		}
+
+		mu.Lock()
+		authorization = append(authorization, req.Header.Get("Authorization"))
+		mu.Unlock()
+		return newResponse(http.StatusOK, "ok"), nil
+	})
+
+	transport := newOAuth2Transport(tokens.URL).Wrap(upstream)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req, _ := http.NewRequest(http.MethodGet, "http://orders/", nil)
+			resp, err := transport.RoundTrip(req)
+			if assert.NoError(t, err) {
+				readBody(t, resp)
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, 1, tokens.Requests())
+	assert.Len(t, authorization, 10)
+	for _, auth := range authorization {
+		assert.Equal(t, "Bearer token-1", auth)
+	}
+}
+
+func TestOAuth2Transport_RenewBeforeExpiry(t *testing.T) {
+	tokens := newTokenServer(t, 1)
+	defer tokens.Close()
+
+	oauth := newOAuth2Transport(tokens.URL)
+	oauth.ExpiryDelta = 5 * time.Second
+
+	token, err := oauth.Token(context.Background(), "")
+	assert.NoError(t, err)
+	assert.Equal(t, "token-1", token.AccessToken)
+
+	// ExpiryDelta is limited to half of the token lifetime
+	token, err = oauth.Token(context.Background(), "")
+	assert.NoError(t, err)
+	assert.Equal(t, "token-1", token.AccessToken)
+
+	// token expires within 500ms
+	time.Sleep(600 * time.Millisecond)
+	token, err = oauth.Token(context.Background(), "")
+	assert.NoError(t, err)
+	assert.Equal(t, "token-2", token.AccessToken)
+}
+
+func TestOAuth2Transport_ShortLivedToken(t *testing.T) {
+	tokens := newTokenServer(t, 10)
+	defer tokens.Close()
+
+	// default ExpiryDelta is longer than the token lifetime
+	oauth := newOAuth2Transport(tokens.URL)
+	for i := 0; i < 3; i++ {
+		token, err := oauth.Token(context.Background(), "")
+		assert.NoError(t, err)
+		assert.Equal(t, "token-1", token.AccessToken)
+	}
+	assert.Equal(t, 1, tokens.Requests())
+}
+
+func TestOAuth2Transport_Audience(t *testing.T) {
+	tokens := newTokenServer(t, 3600)
+	defer tokens.Close()
+
+	oauth := newOAuth2Transport(tokens.URL)
+	oauth.TokenTransport = http.DefaultTransport
+	oauth.AudienceFunc = func(req *http.Request) string {
+		return "https://" + req.URL.Host
+	}
+
+	transport := oauth.Wrap(fdmiddleware.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		return newResponse(http.StatusOK, req.Header.Get("Authorization")), nil
+	}))
+
+	for _, host := range []string{"orders", "menus", "orders"} {
+		req, _ := http.NewRequest(http.MethodGet, "http://"+host+"/", nil)
+		resp, err := transport.RoundTrip(req)
+		assert.NoError(t, err)
+		readBody(t, resp)
+	}
+
+	assert.Equal(t, 2, tokens.Requests())
+	assert.Equal(t, []string{"https://orders", "https://menus"}, tokens.audiences)
+}
+
+func TestOAuth2Transport_RetryUnauthorized(t *testing.T) {
+	tokens := newTokenServer(t, 3600)
+	defer tokens.Close()
+
+	oauth := newOAuth2Transport(tokens.URL)
+	oauth.TokenTransport = http.DefaultTransport
+
+	var bodies []string
+	transport := oauth.Wrap(fdmiddleware.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		body, _ := ioutil.ReadAll(req.Body)
+		bodies = append(bodies, string(body))
+
+		// first token was revoked
+		if req.Header.Get("Authorization") == "Bearer token-1" {
+			return newResponse(http.StatusUnauthorized, ""), nil
+		}
+		return newResponse(http.StatusCreated, ""), nil
+	}))
+
+	req, _ := http.NewRequest(http.MethodPost, "http://orders/", strings.NewReader(`{"items":["pizza"]}`))
+	resp, err := transport.RoundTrip(req)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Equal(t, []string{`{"items":["pizza"]}`, `{"items":["pizza"]}`}, bodies)
+	assert.Equal(t, 2, tokens.Requests())
+}
+
+func TestOAuth2Transport_TokenError(t *testing.T) {
+	tokens := newTokenServer(t, 3600)
+	defer tokens.Close()
+
+	oauth := fdmiddleware.NewOAuth2Transport(tokens.URL, "client", "wrong")
+
+	_, err := oauth.Token(context.Background(), "")
+	if assert.IsType(t, &fdmiddleware.OAuth2Error{}, err) {
+		oauthErr := err.(*fdmiddleware.OAuth2Error)
+		assert.Equal(t, http.StatusUnauthorized, oauthErr.StatusCode)
+		assert.Equal(t, "invalid_client", oauthErr.Code)
+		assert.Equal(t, "bad credentials", oauthErr.Description)
+	}
+}
@@ -0,0 +1,204 @@
+package fdmiddleware
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/foodora/go-ranger/fdbackoff"
+)
+
+// RateLimitError is returned when a request would exceed the limit.
+type RateLimitError struct {
+	Key string
+	// RetryAfter is when a token will be available.
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("fdmiddleware: rate limit of %s exceeded, retry after %s", e.Key, e.RetryAfter)
+}
+
+// RateLimitTransport limit outgoing requests per host or key using a token
+// bucket, so partner quotas are not exceeded:
+//  limiter := fdmiddleware.NewRateLimitTransport(10, 10)
+//  limiter.Wait = true
+//  limiter.SetLimit("api.partner.com", 2, 1)
+//  client.Use(limiter)
+type RateLimitTransport struct {
+	// KeyFunc return the limit key of req, by default req.URL.Host.
+	KeyFunc func(req *http.Request) string
+	// Wait for a token until the request context is done, otherwise
+	// return *RateLimitError right away. Requests are not sent if the
+	// context would be done before a token is available.
+	Wait bool
+
+	mu      sync.Mutex
+	rate    float64
+	burst   int
+	buckets map[string]*tokenBucket
+}
+
+// NewRateLimitTransport allow rate requests per second for each key, with
+// bursts up to burst requests. rate <= 0 means unlimited.
+func NewRateLimitTransport(rate float64, burst int) *RateLimitTransport {
+	return &RateLimitTransport{
+		KeyFunc: hostKey,
+		rate:    rate,
+		burst:   burst,
+		buckets: make(map[string]*tokenBucket),
+	}
+}
+
+// SetLimit change the limit of key at runtime.
+func (t *RateLimitTransport) SetLimit(key string, rate float64, burst int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if b, ok := t.buckets[key]; ok {
+		b.setLimit(rate, burst, time.Now())
+		b.custom = true
+		return
+	}
+
+	t.buckets[key] = newTokenBucket(rate, burst, true)
+}
+
+// SetDefaultLimit change the limit of all keys, except the ones changed by
+// SetLimit.
+func (t *RateLimitTransport) SetDefaultLimit(rate float64, burst int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.rate = rate
+	t.burst = burst
+
+	now := time.Now()
+	for _, b := range t.buckets {
+		if !b.custom {
+			b.setLimit(rate, burst, now)
+		}
+	}
+}
+
+func (t *RateLimitTransport) bucket(key string) *tokenBucket {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	b, ok := t.buckets[key]
+	if !ok {
+		b = newTokenBucket(t.rate, t.burst, false)
+		t.buckets[key] = b
+	}
+
+	return b
+}
+
+// Wrap implements ClientMiddleware
+func (t *RateLimitTransport) Wrap(next http.RoundTripper) http.RoundTripper {
+	return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		keyFunc := t.KeyFunc
+		if keyFunc == nil {
+			keyFunc = hostKey
+		}
+		key := keyFunc(req)
+		b := t.bucket(key)
+
+		ctx := req.Context()
+		maxWait := time.Duration(0)
+		if t.Wait {
+			maxWait = time.Duration(math.MaxInt64)
+			if deadline, ok := ctx.Deadline(); ok {
+				maxWait = time.Until(deadline)
+			}
+		}
+
+		wait, ok := b.reserve(time.Now(), maxWait)
+		if !ok {
+			return nil, &RateLimitError{Key: key, RetryAfter: wait}
+		}
+
+		if err := fdbackoff.Sleep(ctx, wait); err != nil {
+			b.cancel()
+			return nil, err
+		}
+
+		return next.RoundTrip(req)
+	})
+}
+
+// tokenBucket has up to burst tokens and receive rate tokens per second,
+// each request take one token.
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  int
+	tokens float64
+	last   time.Time
+	// custom is true when limit was set by SetLimit
+	custom bool
+}
+
+func newTokenBucket(rate float64, burst int, custom bool) *tokenBucket {
+	return &tokenBucket{
+		rate:   rate,
+		burst:  burst,
+		tokens: float64(burst),
+		last:   time.Now(),
+		custom: custom,
+	}
+}
+
+// refill add tokens since last call, it need to be called with lock.
+func (b *tokenBucket) refill(now time.Time) {
+	if now.After(b.last) {
+		b.tokens = math.Min(float64(b.burst), b.tokens+now.Sub(b.last).Seconds()*b.rate)
+		b.last = now
+	}
+}
+
+// reserve take a token if it's available within maxWait, returning how
+// long the caller need to wait for it. When it's not possible, it returns
+// when a token will be available.
+func (b *tokenBucket) reserve(now time.Time, maxWait time.Duration) (time.Duration, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.rate <= 0 {
+		return 0, true
+	}
+
+	b.refill(now)
+
+	var wait time.Duration
+	if b.tokens < 1 {
+		wait = time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+	}
+	if wait > maxWait {
+		return wait, false
+	}
+
+	b.tokens--
+	return wait, true
+}
+
+// cancel give back a token reserved by a request that was not sent.
+func (b *tokenBucket) cancel() {
+	b.mu.Lock()
+	b.tokens = math.Min(float64(b.burst), b.tokens+1)
+	b.mu.Unlock()
+}
+
+func (b *tokenBucket) setLimit(rate float64, burst int, now time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refill(now)
+	b.rate = rate
+	b.burst = burst
+	if b.tokens > float64(burst) {
+		b.tokens = float64(burst)
+	}
+}
@@ -0,0 +1,133 @@
+package fdmiddleware_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/foodora/go-ranger/fdhttp/fdmiddleware"
+	"github.com/stretchr/testify/assert"
+)
+
+func rateLimitedTransport(limiter *fdmiddleware.RateLimitTransport, calls *int) http.RoundTripper {
+	return limiter.Wrap(fdmiddleware.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		*calls++
+		return newResponse(http.StatusOK, "ok"), nil
+	}))
+}
+
+func TestRateLimitTransport_FailFast(t *testing.T) {
+	limiter := fdmiddleware.NewRateLimitTransport(1, 2)
+
+	var calls int
+	transport := rateLimitedTransport(limiter, &calls)
+
+	req, _ := http.NewRequest(http.MethodGet, "http://partner/", nil)
+	for i := 0; i < 2; i++ {
+		_, err := transport.RoundTrip(req)
+		assert.NoError(t, err)
+	}
+
+	_, err := transport.RoundTrip(req)
+	if assert.IsType(t, &fdmiddleware.RateLimitError{}, err) {
+		rateErr := err.(*fdmiddleware.RateLimitError)
+		assert.Equal(t, "partner", rateErr.Key)
+		assert.True(t, rateErr.RetryAfter > 900*time.Millisecond && rateErr.RetryAfter <= time.Second, "%s", rateErr.RetryAfter)
+	}
+	assert.Equal(t, 2, calls)
+
+	// other hosts have their own bucket
+	req, _ = http.NewRequest(http.MethodGet, "http://other/", nil)
+	_, err = transport.RoundTrip(req)
+	assert.NoError(t, err)
+}
+
+func TestRateLimitTransport_Wait(t *testing.T) {
+	limiter := fdmiddleware.NewRateLimitTransport(50, 1)
+	limiter.Wait = true
+
+	var calls int
+	transport := rateLimitedTransport(limiter, &calls)
+
+	req, _ := http.NewRequest(http.MethodGet, "http://partner/", nil)
+
+	started := time.Now()
+	for i := 0; i < 3; i++ {
+		_, err := transport.RoundTrip(req)
+		assert.NoError(t, err)
+	}
+
+	// 2 requests waited 20ms each
+	assert.True(t, time.Since(started) >= 35*time.Millisecond, "%s", time.Since(started))
+	assert.Equal(t, 3, calls)
+}
+
+func TestRateLimitTransport_WaitRespectContext(t *testing.T) {
+	limiter := fdmiddleware.NewRateLimitTransport(1, 1)
+	limiter.Wait = true
+
+	var calls int
+	transport := rateLimitedTransport(limiter, &calls)
+
+	req, _ := http.NewRequest(http.MethodGet, "http://partner/", nil)
+	_, err := transport.RoundTrip(req)
+	assert.NoError(t, err)
+
+	// deadline is before next token
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	started := time.Now()
+	_, err = transport.RoundTrip(req.WithContext(ctx))
+	assert.IsType(t, &fdmiddleware.RateLimitError{}, err)
+	assert.True(t, time.Since(started) < 10*time.Millisecond)
+
+	// canceled while waiting
+	ctx, cancel = context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+
+	_, err = transport.RoundTrip(req.WithContext(ctx))
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, 1, calls)
+}
+
+func TestRateLimitTransport_SetLimit(t *testing.T) {
+	limiter := fdmiddleware.NewRateLimitTransport(1, 1)
+	limiter.KeyFunc = func(req *http.Request) string {
+		return req.Header.Get("X-Partner")
+	}
+
+	var calls int
+	transport := rateLimitedTransport(limiter, &calls)
+
+	req, _ := http.NewRequest(http.MethodGet, "http://partner/", nil)
+	req.Header.Set("X-Partner", "acme")
+
+	_, err := transport.RoundTrip(req)
+	assert.NoError(t, err)
+	_, err = transport.RoundTrip(req)
+	assert.Error(t, err)
+
+	limiter.SetLimit("acme", 1000, 5)
+	time.Sleep(5 * time.Millisecond)
+	for i := 0; i < 5; i++ {
+		_, err = transport.RoundTrip(req)
+		assert.NoError(t, err)
+	}
+
+	// default limit doesn't change acme
+	limiter.SetDefaultLimit(0, 0)
+	limiter.SetLimit("acme", 0.001, 0)
+	_, err = transport.RoundTrip(req)
+	assert.Error(t, err)
+
+	req.Header.Set("X-Partner", "globex")
+	for i := 0; i < 10; i++ {
+		_, err = transport.RoundTrip(req)
+		assert.NoError(t, err)
+	}
+}
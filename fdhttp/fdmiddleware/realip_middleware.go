@@ -0,0 +1,172 @@
+package fdmiddleware
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// RealIP is a middleware that find the real client ip when your service
+// is behind proxies or load balancers. Forwarding headers are read only
+// when the request comes from a trusted proxy, otherwise clients could
+// spoof their ip just sending these headers.
+// The client ip is saved into the request context, read it using fdmiddleware.ClientIP(ctx).
+type RealIP struct {
+	trusted []*net.IPNet
+}
+
+// NewRealIPMiddleware receive the list of trusted proxies, each one can be
+// a CIDR like "10.0.0.0/8" or a single ip.
+func NewRealIPMiddleware(trustedProxies ...string) (*RealIP, error) {
+	trusted, err := parseCIDRs(trustedProxies)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RealIP{trusted: trusted}, nil
+}
+
+// Wrap will be called in every request
+func (m *RealIP) Wrap(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, req *http.Request) {
+		ctx := SetClientIP(req.Context(), m.ClientIP(req))
+
+		// Override request, with that middlewares that run before it, like
+		// LogMiddleware, also can access the client ip.
+		*req = *req.WithContext(ctx)
+
+		next.ServeHTTP(w, req)
+	}
+
+	return http.HandlerFunc(fn)
+}
+
+// ClientIP return the ip of who started the request. Forwarded (RFC 7239),
+// X-Forwarded-For and X-Real-IP are checked in this order, and the chain is
+// walked from the nearest hop skipping trusted proxies.
+func (m *RealIP) ClientIP(req *http.Request) string {
+	ip := remoteIP(req)
+	if !m.isTrusted(ip) {
+		return ip
+	}
+
+	var chain []string
+	if values := req.Header["Forwarded"]; len(values) > 0 {
+		chain = parseForwarded(values)
+	} else if values := req.Header["X-Forwarded-For"]; len(values) > 0 {
+		for _, v := range values {
+			for _, addr := range strings.Split(v, ",") {
+				chain = append(chain, strings.TrimSpace(addr))
+			}
+		}
+	} else if v := req.Header.Get("X-Real-IP"); v != "" {
+		chain = []string{strings.TrimSpace(v)}
+	}
+
+	for i := len(chain) - 1; i >= 0; i-- {
+		hop := parseHostIP(chain[i])
+		if hop == "" {
+			// we cannot trust anything sent before an invalid hop
+			return ip
+		}
+
+		ip = hop
+		if !m.isTrusted(ip) {
+			return ip
+		}
+	}
+
+	return ip
+}
+
+func (m *RealIP) isTrusted(ip string) bool {
+	return containsIP(m.trusted, net.ParseIP(ip))
+}
+
+// parseForwarded return the "for" parameter of each element of Forwarded headers:
+//  Forwarded: for=192.0.2.60;proto=http, for="[2001:db8:cafe::17]:4711"
+func parseForwarded(values []string) []string {
+	var chain []string
+	for _, v := range values {
+		for _, element := range strings.Split(v, ",") {
+			for _, pair := range strings.Split(element, ";") {
+				pair = strings.TrimSpace(pair)
+				if len(pair) > 4 && strings.EqualFold(pair[:4], "for=") {
+					chain = append(chain, strings.Trim(pair[4:], `"`))
+				}
+			}
+		}
+	}
+	return chain
+}
+
+// parseHostIP return the ip of addr removing the port, or empty if addr
+// isn't a valid ip (like "unknown" or obfuscated identifiers).
+func parseHostIP(addr string) string {
+	if ip := net.ParseIP(addr); ip != nil {
+		return ip.String()
+	}
+
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		// ipv6 without port, but with brackets
+		host = strings.TrimSuffix(strings.TrimPrefix(addr, "["), "]")
+	}
+
+	if ip := net.ParseIP(host); ip != nil {
+		return ip.String()
+	}
+	return ""
+}
+
+// remoteIP return ip of who is connected to us.
+func remoteIP(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return host
+}
+
+// parseCIDRs parse a list of CIDRs or single ips.
+func parseCIDRs(values []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(values))
+	for _, v := range values {
+		if !strings.Contains(v, "/") {
+			ip := net.ParseIP(v)
+			if ip == nil {
+				return nil, fmt.Errorf("fdmiddleware: invalid ip '%s'", v)
+			}
+
+			bits := 128
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 32
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, ipNet, err := net.ParseCIDR(v)
+		if err != nil {
+			return nil, fmt.Errorf("fdmiddleware: invalid cidr '%s': %s", v, err)
+		}
+		nets = append(nets, ipNet)
+	}
+
+	return nets, nil
+}
+
+func containsIP(nets []*net.IPNet, ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,167 @@
+package fdmiddleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/foodora/go-ranger/fdhttp/fdmiddleware"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRealIP_ClientIP(t *testing.T) {
+	m, err := fdmiddleware.NewRealIPMiddleware("10.0.0.0/8", "192.168.1.1", "2001:db8::/32")
+	assert.NoError(t, err)
+
+	cases := map[string]struct {
+		remoteAddr string
+		header     http.Header
+		expected   string
+	}{
+		"untrusted remote ignore headers": {
+			remoteAddr: "203.0.113.9:1234",
+			header:     http.Header{"X-Forwarded-For": {"1.1.1.1"}},
+			expected:   "203.0.113.9",
+		},
+		"trusted remote without headers": {
+			remoteAddr: "10.0.0.1:1234",
+			expected:   "10.0.0.1",
+		},
+		"x-forwarded-for skip trusted proxies": {
+			remoteAddr: "10.0.0.1:1234",
+			header:     http.Header{"X-Forwarded-For": {"1.1.1.1, 203.0.113.9, 192.168.1.1"}},
+			expected:   "203.0.113.9",
+		},
+		"x-forwarded-for in multiple headers": {
+			remoteAddr: "10.0.0.1:1234",
+			header:     http.Header{"X-Forwarded-For": {"1.1.1.1", "203.0.113.9, 10.1.1.1"}},
+			expected:   "203.0.113.9",
+		},
+		"all hops trusted": {
+			remoteAddr: "10.0.0.1:1234",
+			header:     http.Header{"X-Forwarded-For": {"10.2.2.2, 10.1.1.1"}},
+			expected:   "10.2.2.2",
+		},
+		"invalid hop": {
+			remoteAddr: "10.0.0.1:1234",
+			header:     http.Header{"X-Forwarded-For": {"1.1.1.1, garbage"}},
+			expected:   "10.0.0.1",
+		},
+		"x-real-ip": {
+			remoteAddr: "10.0.0.1:1234",
+			header:     http.Header{"X-Real-Ip": {"203.0.113.9"}},
+			expected:   "203.0.113.9",
+		},
+		"forwarded has precedence": {
+			remoteAddr: "10.0.0.1:1234",
+			header: http.Header{
+				"Forwarded":       {`for=198.51.100.1;proto=https, for="[2001:db8:cafe::17]:4711"`},
+				"X-Forwarded-For": {"1.1.1.1"},
+			},
+			expected: "198.51.100.1",
+		},
+		"forwarded with port": {
+			remoteAddr: "10.0.0.1:1234",
+			header:     http.Header{"Forwarded": {`For="198.51.100.1:8080"`}},
+			expected:   "198.51.100.1",
+		},
+		"forwarded unknown": {
+			remoteAddr: "10.0.0.1:1234",
+			header:     http.Header{"Forwarded": {`for=unknown`}},
+			expected:   "10.0.0.1",
+		},
+	}
+
+	for name, c := range cases {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = c.remoteAddr
+		req.Header = c.header
+		if req.Header == nil {
+			req.Header = http.Header{}
+		}
+
+		assert.Equal(t, c.expected, m.ClientIP(req), name)
+	}
+}
+
+func TestRealIP_InvalidProxy(t *testing.T) {
+	_, err := fdmiddleware.NewRealIPMiddleware("10.0.0.0/33")
+	assert.Error(t, err)
+
+	_, err = fdmiddleware.NewRealIPMiddleware("localhost")
+	assert.Error(t, err)
+}
+
+func TestRealIP_SaveIntoContext(t *testing.T) {
+	realIP, err := fdmiddleware.NewRealIPMiddleware("10.0.0.0/8")
+	assert.NoError(t, err)
+
+	defaultLogFormat := fdmiddleware.RequestLogFormat
+	defer func() {
+		fdmiddleware.RequestLogFormat = defaultLogFormat
+	}()
+
+	logger := &dummyLog{}
+	fdmiddleware.RequestLogFormat = "{{.RemoteAddr}}"
+	logMiddleware := fdmiddleware.NewLogMiddleware()
+	logMiddleware.SetLogger(logger)
+
+	var clientIP string
+	handler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		clientIP = fdmiddleware.ClientIP(req.Context())
+	})
+
+	// log middleware runs before, but it should see the ip
+	h := logMiddleware.Wrap(realIP.Wrap(handler))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	req.Header.Set("X-Forwarded-For", "203.0.113.9")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	assert.Equal(t, "203.0.113.9", clientIP)
+	assert.Equal(t, "203.0.113.9", logger.PrintfMsg)
+}
+
+func TestIPFilter(t *testing.T) {
+	_, err := fdmiddleware.NewIPFilterMiddleware([]string{"invalid"}, nil)
+	assert.Error(t, err)
+
+	m, err := fdmiddleware.NewIPFilterMiddleware([]string{"10.0.0.0/8"}, []string{"10.0.0.66"})
+	assert.NoError(t, err)
+
+	assert.True(t, m.Allowed("10.1.2.3"))
+	assert.False(t, m.Allowed("10.0.0.66"))
+	assert.False(t, m.Allowed("203.0.113.9"))
+	assert.False(t, m.Allowed(""))
+
+	onlyDeny, err := fdmiddleware.NewIPFilterMiddleware(nil, []string{"203.0.113.0/24"})
+	assert.NoError(t, err)
+	assert.True(t, onlyDeny.Allowed("10.1.2.3"))
+	assert.False(t, onlyDeny.Allowed("203.0.113.9"))
+
+	var called bool
+	h := m.Wrap(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		called = true
+	}))
+
+	// remote addr is used without RealIP
+	req := httptest.NewRequest(http.MethodGet, "/admin", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	assert.True(t, called)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// client ip resolved by RealIP has precedence
+	called = false
+	realIP, _ := fdmiddleware.NewRealIPMiddleware("10.0.0.0/8")
+	req = httptest.NewRequest(http.MethodGet, "/admin", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	req.Header.Set("X-Forwarded-For", "203.0.113.9")
+	w = httptest.NewRecorder()
+	realIP.Wrap(h).ServeHTTP(w, req)
+	assert.False(t, called)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), `"code":"forbidden"`)
+}
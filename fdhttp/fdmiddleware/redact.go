@@ -0,0 +1,129 @@
+package fdmiddleware
+
+import (
+	"encoding/json"
+	"mime"
+	"net/http"
+	"net/url"
+)
+
+// RedactedValue replace secrets in logs and recorded requests.
+const RedactedValue = "REDACTED"
+
+// DefaultRedactHeaders are headers that usually have credentials.
+var DefaultRedactHeaders = []string{"Authorization", "Cookie", "Set-Cookie"}
+
+// Redactor replace secrets in headers, query strings, json and form bodies
+// with RedactedValue.
+type Redactor struct {
+	// Headers have values replaced in requests and responses.
+	Headers []string
+	// Query have values replaced in the url.
+	Query []string
+	// BodyFields have values replaced in json bodies, in any level, and in
+	// application/x-www-form-urlencoded bodies.
+	BodyFields []string
+}
+
+// NewRedactor return a redactor of DefaultRedactHeaders.
+func NewRedactor() *Redactor {
+	return &Redactor{
+		Headers: append([]string(nil), DefaultRedactHeaders...),
+	}
+}
+
+// Header return a copy of header with secrets redacted.
+func (r *Redactor) Header(header http.Header) http.Header {
+	h := make(http.Header, len(header))
+	for k, v := range header {
+		h[k] = v
+	}
+
+	for _, key := range r.Headers {
+		if h.Get(key) != "" {
+			h.Set(key, RedactedValue)
+		}
+	}
+
+	return h
+}
+
+// URL return u with secrets in query string redacted.
+func (r *Redactor) URL(u *url.URL) string {
+	if len(r.Query) == 0 {
+		return u.String()
+	}
+
+	redacted := *u
+	query := redacted.Query()
+	for _, key := range r.Query {
+		if _, ok := query[key]; ok {
+			query.Set(key, RedactedValue)
+		}
+	}
+	redacted.RawQuery = query.Encode()
+
+	return redacted.String()
+}
+
+// Body return body with fields redacted, using header to detect form
+// bodies. Bodies that are neither json nor form are returned as they are.
+func (r *Redactor) Body(header http.Header, body []byte) string {
+	if len(r.BodyFields) == 0 {
+		return string(body)
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(header.Get("Content-Type"))
+	if mediaType == "application/x-www-form-urlencoded" {
+		return r.form(body)
+	}
+
+	var v interface{}
+	if err := json.Unmarshal(body, &v); err != nil {
+		return string(body)
+	}
+
+	redactJSON(v, r.BodyFields)
+
+	redacted, err := json.Marshal(v)
+	if err != nil {
+		return string(body)
+	}
+	return string(redacted)
+}
+
+// form return a form body with fields redacted, the whole body is redacted
+// when it cannot be parsed.
+func (r *Redactor) form(body []byte) string {
+	values, err := url.ParseQuery(string(body))
+	if err != nil {
+		return RedactedValue
+	}
+
+	for _, key := range r.BodyFields {
+		if _, ok := values[key]; ok {
+			values.Set(key, RedactedValue)
+		}
+	}
+
+	return values.Encode()
+}
+
+// redactJSON replace fields of v in any level.
+func redactJSON(v interface{}, fields []string) {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		for k, fieldValue := range value {
+			if contains(fields, k) {
+				value[k] = RedactedValue
+				continue
+			}
+
+			redactJSON(fieldValue, fields)
+		}
+	case []interface{}:
+		for _, item := range value {
+			redactJSON(item, fields)
+		}
+	}
+}
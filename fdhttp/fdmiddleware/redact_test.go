@@ -0,0 +1,42 @@
+package fdmiddleware_test
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/foodora/go-ranger/fdhttp/fdmiddleware"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedactor(t *testing.T) {
+	redactor := fdmiddleware.NewRedactor()
+	redactor.Query = []string{"api_key"}
+	redactor.BodyFields = []string{"password", "token", "client_secret"}
+
+	header := http.Header{}
+	header.Set("Authorization", "Bearer secret")
+	header.Set("Accept", "application/json")
+
+	redacted := redactor.Header(header)
+	assert.Equal(t, fdmiddleware.RedactedValue, redacted.Get("Authorization"))
+	assert.Equal(t, "application/json", redacted.Get("Accept"))
+	// original is not changed
+	assert.Equal(t, "Bearer secret", header.Get("Authorization"))
+
+	u, _ := url.Parse("http://partner/orders?api_key=secret&page=2")
+	assert.Equal(t, "http://partner/orders?api_key=REDACTED&page=2", redactor.URL(u))
+
+	assert.JSONEq(t,
+		`{"user":{"name":"john","password":"REDACTED"},"items":[{"token":"REDACTED"}]}`,
+		redactor.Body(http.Header{}, []byte(`{"user":{"name":"john","password":"hunter2"},"items":[{"token":"k3y"}]}`)),
+	)
+	assert.Equal(t, "not json", redactor.Body(http.Header{}, []byte("not json")))
+
+	form := http.Header{"Content-Type": {"application/x-www-form-urlencoded; charset=utf-8"}}
+	assert.Equal(t,
+		"client_id=app&client_secret=REDACTED&grant_type=client_credentials",
+		redactor.Body(form, []byte("grant_type=client_credentials&client_id=app&client_secret=s3cret")),
+	)
+	assert.Equal(t, fdmiddleware.RedactedValue, redactor.Body(form, []byte("password=%zz")), "invalid forms are redacted")
+}
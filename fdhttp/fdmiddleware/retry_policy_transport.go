@@ -0,0 +1,317 @@
+package fdmiddleware
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/foodora/go-ranger/fdbackoff"
+)
+
+// IdempotencyKeyHeader allow requests with any method to be retried, the
+// server is responsible to not process the same key twice.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// DefaultIdempotentMethods can be retried without Idempotency-Key.
+var DefaultIdempotentMethods = []string{
+	http.MethodGet,
+	http.MethodHead,
+	http.MethodOptions,
+	http.MethodTrace,
+	http.MethodPut,
+	http.MethodDelete,
+}
+
+// DefaultRetryBackoff is used when Backoff is nil, exponential from 100ms
+// up to 10 seconds with full jitter.
+var DefaultRetryBackoff = fdbackoff.Cap(10*time.Second, fdbackoff.FullJitter(fdbackoff.Exponential(100*time.Millisecond)))
+
+// DefaultRetryMaxAttempts limit attempts when MaxAttempts is zero and the
+// request context has no deadline.
+var DefaultRetryMaxAttempts = 3
+
+// RetryClassifier return true if the attempt should be retried, resp is nil
+// when err is not.
+type RetryClassifier func(req *http.Request, resp *http.Response, err error) bool
+
+// DefaultRetryClassifier retry network errors, 429 Too Many Requests and
+// 5xx, except 501 Not Implemented.
+func DefaultRetryClassifier(req *http.Request, resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+
+	return resp.StatusCode == http.StatusTooManyRequests ||
+		(resp.StatusCode >= 500 && resp.StatusCode != http.StatusNotImplemented)
+}
+
+// Attempt describe each call done by RetryPolicyTransport.
+type Attempt struct {
+	// Number of the attempt, starting from 1
+	Number   int
+	Request  *http.Request
+	Response *http.Response
+	Err      error
+	Duration time.Duration
+	// Retry is true if another attempt will be done after Wait
+	Retry bool
+	Wait  time.Duration
+}
+
+// RetryPolicyTransport retry failed calls when it's safe:
+//  - only idempotent methods or requests with Idempotency-Key are retried;
+//  - body is sent again using req.GetBody, requests without it are not retried;
+//  - wait between attempts is interrupted when the request context is done;
+//  - Retry-After sent by the server is respected.
+// The attempt number is saved in the request context, check RetryAttempt().
+type RetryPolicyTransport struct {
+	// MaxAttempts including the first call, zero means until the request
+	// deadline or Backoff return fdbackoff.Stop. Requests without deadline
+	// are limited to DefaultRetryMaxAttempts.
+	MaxAttempts int
+	// Backoff is the wait before each retry, fdbackoff.Stop stop retrying.
+	// By default DefaultRetryBackoff.
+	Backoff fdbackoff.Func
+	// AttemptTimeout limit each attempt, the request context still limit
+	// all of them together.
+	AttemptTimeout time.Duration
+	// MaxRetryAfter is the longest Retry-After accepted, longer values stop
+	// retrying. By default 1 minute.
+	MaxRetryAfter time.Duration
+	// IdempotentMethods by default DefaultIdempotentMethods.
+	IdempotentMethods []string
+	// Classifier by default DefaultRetryClassifier.
+	Classifier RetryClassifier
+	// OnAttempt is called after each attempt, use it to log or trace.
+	OnAttempt func(Attempt)
+	// Budget is optional and limit retries in the whole process, share it
+	// with others clients of the same dependency.
+	Budget *fdbackoff.Budget
+
+	onRetry func(attempt int, err error, wait time.Duration)
+}
+
+// NewRetryPolicyTransport do up to maxAttempts calls waiting backoffFunc
+// between them, a nil backoffFunc use DefaultRetryBackoff.
+func NewRetryPolicyTransport(maxAttempts int, backoffFunc fdbackoff.Func) *RetryPolicyTransport {
+	if backoffFunc == nil {
+		backoffFunc = DefaultRetryBackoff
+	}
+
+	return &RetryPolicyTransport{
+		MaxAttempts:       maxAttempts,
+		Backoff:           backoffFunc,
+		MaxRetryAfter:     time.Minute,
+		IdempotentMethods: DefaultIdempotentMethods,
+		Classifier:        DefaultRetryClassifier,
+	}
+}
+
+// NewRetryPolicyTransportWithPolicy use MaxAttempts, Backoff, Budget and OnRetry
+// from policy, with that the same policy can be shared with fddb and pubsub.
+func NewRetryPolicyTransportWithPolicy(policy fdbackoff.Policy) *RetryPolicyTransport {
+	m := NewRetryPolicyTransport(policy.MaxAttempts, policy.Backoff)
+	m.Budget = policy.Budget
+	m.onRetry = policy.OnRetry
+	return m
+}
+
+// Retryable return true if req can be sent more than once.
+func (m *RetryPolicyTransport) Retryable(req *http.Request) bool {
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return false
+	}
+
+	if req.Header.Get(IdempotencyKeyHeader) != "" {
+		return true
+	}
+
+	return contains(m.IdempotentMethods, req.Method)
+}
+
+// Wrap implements ClientMiddleware
+func (m *RetryPolicyTransport) Wrap(next http.RoundTripper) http.RoundTripper {
+	return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		retryable := m.Retryable(req)
+		ctx := req.Context()
+
+		for attempt := 1; ; attempt++ {
+			r, cancel, err := m.attemptRequest(req, attempt)
+			if err != nil {
+				return nil, err
+			}
+
+			started := time.Now()
+			resp, err := next.RoundTrip(r)
+			if err != nil {
+				cancel()
+			} else {
+				resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+			}
+
+			a := Attempt{
+				Number:   attempt,
+				Request:  r,
+				Response: resp,
+				Err:      err,
+				Duration: time.Since(started),
+			}
+
+			failed := m.classify(r, resp, err)
+			if !failed && m.Budget != nil {
+				m.Budget.Success()
+			}
+
+			if failed && retryable && m.canRetry(ctx, attempt) && ctx.Err() == nil {
+				a.Wait, a.Retry = m.wait(ctx, attempt, resp)
+				if a.Retry && m.Budget != nil {
+					a.Retry = m.Budget.Withdraw()
+				}
+			}
+
+			if m.OnAttempt != nil {
+				m.OnAttempt(a)
+			}
+			if a.Retry && m.onRetry != nil {
+				m.onRetry(attempt, attemptError(r, resp, err), a.Wait)
+			}
+
+			if !a.Retry {
+				return resp, err
+			}
+
+			if resp != nil {
+				// drain body to reuse the connection
+				io.CopyN(ioutil.Discard, resp.Body, 4096)
+				resp.Body.Close()
+			}
+
+			if err := fdbackoff.Sleep(ctx, a.Wait); err != nil {
+				return nil, err
+			}
+		}
+	})
+}
+
+// attemptRequest return a copy of req to be sent in attempt.
+func (m *RetryPolicyTransport) attemptRequest(req *http.Request, attempt int) (*http.Request, context.CancelFunc, error) {
+	ctx := SetRetryAttempt(req.Context(), attempt)
+
+	cancel := func() {}
+	if m.AttemptTimeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, m.AttemptTimeout)
+	}
+
+	r := req.WithContext(ctx)
+	if attempt > 1 && req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			cancel()
+			return nil, nil, err
+		}
+		r.Body = body
+	}
+
+	return r, cancel, nil
+}
+
+// canRetry return false when attempt is the last one, MaxAttempts equal to
+// zero retry until the request deadline, or DefaultRetryMaxAttempts without
+// deadline.
+func (m *RetryPolicyTransport) canRetry(ctx context.Context, attempt int) bool {
+	if m.MaxAttempts > 0 {
+		return attempt < m.MaxAttempts
+	}
+
+	if _, ok := ctx.Deadline(); ok {
+		return true
+	}
+	return attempt < DefaultRetryMaxAttempts
+}
+
+// attemptError return err or an error describing the response.
+func attemptError(req *http.Request, resp *http.Response, err error) error {
+	if err != nil {
+		return err
+	}
+	return fmt.Errorf("%s %s: %s", req.Method, req.URL.String(), resp.Status)
+}
+
+func (m *RetryPolicyTransport) classify(req *http.Request, resp *http.Response, err error) bool {
+	if m.Classifier == nil {
+		return DefaultRetryClassifier(req, resp, err)
+	}
+	return m.Classifier(req, resp, err)
+}
+
+// wait return how long to wait before next attempt and false if it's not
+// worth to wait, because of Retry-After or the request deadline.
+func (m *RetryPolicyTransport) wait(ctx context.Context, attempt int, resp *http.Response) (time.Duration, bool) {
+	backoff := m.Backoff
+	if backoff == nil {
+		backoff = DefaultRetryBackoff
+	}
+
+	wait := backoff(attempt)
+	if wait == fdbackoff.Stop {
+		return 0, false
+	}
+
+	if resp != nil {
+		if retryAfter, ok := parseRetryAfter(resp.Header.Get("Retry-After")); ok {
+			if m.MaxRetryAfter > 0 && retryAfter > m.MaxRetryAfter {
+				return 0, false
+			}
+			if retryAfter > wait {
+				wait = retryAfter
+			}
+		}
+	}
+
+	if deadline, ok := ctx.Deadline(); ok && time.Now().Add(wait).After(deadline) {
+		return 0, false
+	}
+
+	return wait, true
+}
+
+// parseRetryAfter accept seconds or a http date.
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	t, err := http.ParseTime(value)
+	if err != nil {
+		return 0, false
+	}
+
+	d := time.Until(t)
+	if d < 0 {
+		d = 0
+	}
+	return d, true
+}
+
+// cancelBody cancel the attempt context when body is closed.
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
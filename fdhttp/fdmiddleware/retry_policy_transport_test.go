@@ -0,0 +1,271 @@
+package fdmiddleware_test
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/foodora/go-ranger/fdbackoff"
+	"github.com/foodora/go-ranger/fdhttp"
+	"github.com/foodora/go-ranger/fdhttp/fdhttptest"
+	"github.com/foodora/go-ranger/fdhttp/fdmiddleware"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryPolicyTransport_RetryIdempotent(t *testing.T) {
+	server := fdhttptest.NewMockServer(t)
+	defer server.Close()
+
+	server.Expect(http.MethodGet, "/orders").Times(3).
+		RespondFault(fdhttptest.FaultCloseConnection).
+		Respond(http.StatusServiceUnavailable, nil).
+		Respond(http.StatusTooManyRequests, nil)
+	server.Expect(http.MethodGet, "/orders").Times(1).
+		Respond(http.StatusOK, "ok")
+
+	var attempts []int
+	m := fdmiddleware.NewRetryPolicyTransport(5, fdbackoff.Constant(time.Millisecond))
+	m.OnAttempt = func(a fdmiddleware.Attempt) {
+		assert.Equal(t, a.Number, fdmiddleware.RetryAttempt(a.Request.Context()))
+		attempts = append(attempts, a.Number)
+	}
+
+	c := fdhttp.NewClient()
+	c.Use(m)
+
+	resp, err := c.Get(server.URL + "/orders")
+	if assert.NoError(t, err) {
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		assert.Equal(t, "ok", string(body))
+	}
+
+	assert.Equal(t, []int{1, 2, 3, 4}, attempts)
+	server.Verify()
+}
+
+func TestRetryPolicyTransport_MaxAttempts(t *testing.T) {
+	server := fdhttptest.NewMockServer(t)
+	defer server.Close()
+
+	server.Expect(http.MethodGet, "/orders").Times(2).
+		Respond(http.StatusInternalServerError, nil)
+
+	c := fdhttp.NewClient()
+	c.Use(fdmiddleware.NewRetryPolicyTransport(2, fdbackoff.Constant(time.Millisecond)))
+
+	resp, err := c.Get(server.URL + "/orders")
+	if assert.NoError(t, err) {
+		resp.Body.Close()
+		assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+	}
+
+	server.Verify()
+}
+
+func TestRetryPolicyTransport_NonIdempotent(t *testing.T) {
+	server := fdhttptest.NewMockServer(t)
+	defer server.Close()
+
+	plain := server.Expect(http.MethodPost, "/orders").
+		WithHeader(fdmiddleware.IdempotencyKeyHeader, "").
+		Respond(http.StatusServiceUnavailable, nil)
+	withKey := server.Expect(http.MethodPost, "/orders").
+		WithHeader(fdmiddleware.IdempotencyKeyHeader, "123").
+		WithBody(`{"id":1}`).
+		Respond(http.StatusServiceUnavailable, nil).
+		Respond(http.StatusCreated, nil)
+
+	c := fdhttp.NewClient()
+	c.Use(fdmiddleware.NewRetryPolicyTransport(3, fdbackoff.Constant(time.Millisecond)))
+
+	resp, err := c.Post(server.URL+"/orders", "application/json", strings.NewReader(`{"id":1}`))
+	if assert.NoError(t, err) {
+		resp.Body.Close()
+		assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	}
+	assert.Equal(t, 1, plain.Calls())
+
+	req, _ := http.NewRequest(http.MethodPost, server.URL+"/orders", bytes.NewBufferString(`{"id":1}`))
+	req.Header.Set(fdmiddleware.IdempotencyKeyHeader, "123")
+	resp, err = c.Do(req)
+	if assert.NoError(t, err) {
+		resp.Body.Close()
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	}
+	assert.Equal(t, 2, withKey.Calls())
+
+	server.Verify()
+}
+
+func TestRetryPolicyTransport_Retryable(t *testing.T) {
+	m := fdmiddleware.NewRetryPolicyTransport(3, nil)
+
+	req, _ := http.NewRequest(http.MethodPut, "/", strings.NewReader("body"))
+	assert.True(t, m.Retryable(req))
+
+	// body can't be sent again
+	req, _ = http.NewRequest(http.MethodPut, "/", ioutil.NopCloser(strings.NewReader("body")))
+	assert.False(t, m.Retryable(req))
+
+	req, _ = http.NewRequest(http.MethodPatch, "/", nil)
+	assert.False(t, m.Retryable(req))
+	req.Header.Set(fdmiddleware.IdempotencyKeyHeader, "123")
+	assert.True(t, m.Retryable(req))
+}
+
+func TestRetryPolicyTransport_RetryAfter(t *testing.T) {
+	server := fdhttptest.NewMockServer(t)
+	defer server.Close()
+
+	server.Expect(http.MethodGet, "/too-long").Times(1).
+		RespondWith(fdhttptest.MockResponse{
+			StatusCode: http.StatusServiceUnavailable,
+			Header:     http.Header{"Retry-After": {"120"}},
+		})
+	server.Expect(http.MethodGet, "/after-deadline").Times(1).
+		RespondWith(fdhttptest.MockResponse{
+			StatusCode: http.StatusTooManyRequests,
+			Header:     http.Header{"Retry-After": {"1"}},
+		})
+
+	var waits []time.Duration
+	m := fdmiddleware.NewRetryPolicyTransport(3, fdbackoff.Constant(time.Millisecond))
+	m.OnAttempt = func(a fdmiddleware.Attempt) {
+		waits = append(waits, a.Wait)
+	}
+
+	c := fdhttp.NewClient()
+	c.Use(m)
+
+	resp, err := c.Get(server.URL + "/too-long")
+	if assert.NoError(t, err) {
+		resp.Body.Close()
+		assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/after-deadline", nil)
+	resp, err = c.Do(req.WithContext(ctx))
+	if assert.NoError(t, err) {
+		resp.Body.Close()
+		assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	}
+
+	assert.Equal(t, []time.Duration{0, 0}, waits)
+	server.Verify()
+}
+
+func TestRetryPolicyTransport_ContextCanceledWhileWaiting(t *testing.T) {
+	server := fdhttptest.NewMockServer(t)
+	defer server.Close()
+
+	server.Expect(http.MethodGet, "/orders").Times(1).
+		Respond(http.StatusServiceUnavailable, nil)
+
+	c := fdhttp.NewClient()
+	// client timeout is a deadline and retry would give up before waiting
+	c.Timeout = 0
+	c.Use(fdmiddleware.NewRetryPolicyTransport(3, fdbackoff.Constant(time.Minute)))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+
+	started := time.Now()
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/orders", nil)
+	_, err := c.Do(req.WithContext(ctx))
+	assert.Error(t, err)
+	assert.True(t, time.Since(started) < time.Second)
+
+	server.Verify()
+}
+
+func TestRetryPolicyTransport_AttemptTimeout(t *testing.T) {
+	server := fdhttptest.NewMockServer(t)
+	defer server.Close()
+
+	server.Expect(http.MethodGet, "/orders").Times(2).
+		RespondDelayed(time.Second, http.StatusOK, "slow").
+		Respond(http.StatusOK, "fast")
+
+	m := fdmiddleware.NewRetryPolicyTransport(2, nil)
+	m.AttemptTimeout = 50 * time.Millisecond
+
+	c := fdhttp.NewClient()
+	c.Use(m)
+
+	resp, err := c.Get(server.URL + "/orders")
+	if assert.NoError(t, err) {
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		assert.NoError(t, err)
+		assert.Equal(t, "fast", string(body))
+	}
+
+	server.Verify()
+}
+
+func TestRetryPolicyTransport_SharedPolicy(t *testing.T) {
+	server := fdhttptest.NewMockServer(t)
+	defer server.Close()
+
+	server.Expect(http.MethodGet, "/orders").Times(3).
+		Respond(http.StatusServiceUnavailable, nil)
+
+	var retries []string
+	policy := fdbackoff.Policy{
+		MaxAttempts: 3,
+		Backoff:     fdbackoff.Constant(time.Millisecond),
+		Budget:      fdbackoff.NewBudget(0, 1, time.Minute),
+		OnRetry: func(attempt int, err error, wait time.Duration) {
+			retries = append(retries, err.Error())
+		},
+	}
+
+	c := fdhttp.NewClient()
+	c.Use(fdmiddleware.NewRetryPolicyTransportWithPolicy(policy))
+
+	// first request use the only retry from the budget
+	for i := 0; i < 2; i++ {
+		resp, err := c.Get(server.URL + "/orders")
+		if assert.NoError(t, err) {
+			resp.Body.Close()
+			assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+		}
+	}
+
+	assert.Equal(t, []string{"GET " + server.URL + "/orders: 503 Service Unavailable"}, retries)
+	server.Verify()
+}
+
+func TestRetryPolicyTransport_UnlimitedAttempts(t *testing.T) {
+	var calls int
+	transport := fdmiddleware.NewRetryPolicyTransport(0, fdbackoff.Constant(time.Millisecond)).Wrap(fdmiddleware.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		calls++
+		return newResponse(http.StatusServiceUnavailable, ""), nil
+	}))
+
+	// without deadline attempts are limited
+	req, _ := http.NewRequest(http.MethodGet, "http://orders/", nil)
+	resp, err := transport.RoundTrip(req)
+	if assert.NoError(t, err) {
+		resp.Body.Close()
+		assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	}
+	assert.Equal(t, fdmiddleware.DefaultRetryMaxAttempts, calls)
+
+	// with deadline it retries until there's no time to wait the backoff
+	calls = 0
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	resp, err = transport.RoundTrip(req.WithContext(ctx))
+	if err == nil {
+		resp.Body.Close()
+	}
+	assert.True(t, calls > fdmiddleware.DefaultRetryMaxAttempts, "calls: %d", calls)
+}
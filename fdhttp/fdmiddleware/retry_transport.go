@@ -7,6 +7,11 @@ import (
 	"github.com/foodora/go-ranger/fdbackoff"
 )
 
+// RetryTransport retry failed calls.
+//
+// Deprecated: RetryTransport retries non idempotent requests, can't send
+// the body again and ignores the request context and Retry-After. Use
+// RetryPolicyTransport instead.
 type RetryTransport struct {
 	maxRetries  int
 	backoffFunc fdbackoff.Func
@@ -31,7 +36,11 @@ func (m *RetryTransport) Wrap(next http.RoundTripper) http.RoundTripper {
 				return
 			}
 
-			time.Sleep(m.backoffFunc(retry + 1))
+			wait := m.backoffFunc(retry + 1)
+			if wait == fdbackoff.Stop {
+				return
+			}
+			time.Sleep(wait)
 		}
 
 		return
@@ -24,3 +24,20 @@ func (f ClientMiddlewareFunc) Wrap(next http.RoundTripper) http.RoundTripper {
 type ClientMiddleware interface {
 	Wrap(next http.RoundTripper) http.RoundTripper
 }
+
+// cloneRequest return a copy of req with its own header, a RoundTripper
+// should not modify the request received.
+func cloneRequest(req *http.Request) *http.Request {
+	r := new(http.Request)
+	*r = *req
+
+	u := *req.URL
+	r.URL = &u
+
+	r.Header = make(http.Header, len(req.Header))
+	for k, v := range req.Header {
+		r.Header[k] = append([]string(nil), v...)
+	}
+
+	return r
+}
@@ -3,6 +3,7 @@ package fdhttp
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"sync"
 )
@@ -40,6 +41,36 @@ func ResponseJSON(w http.ResponseWriter, statusCode int, resp interface{}) {
 	}
 }
 
+// ResponseEndpoint respond the value returned by an EndpointFunc like Router
+// does: errors are converted to *Error, unless they're JSONer, io.Reader is
+// copied as is and everything else is sent as json. It returns the *Error
+// sent to the client, if any.
+func ResponseEndpoint(w http.ResponseWriter, statusCode int, resp interface{}) *Error {
+	var respErr *Error
+	if err, ok := resp.(*Error); ok {
+		respErr = err
+	} else if _, ok := resp.(JSONer); ok {
+		// If resp is a JSON should have precedence to error
+		// Check case test TestRouter_SendCustomErrorAsJSON
+	} else if err, ok := resp.(error); ok {
+		// If it's a error let's convert to fdhttp.Error and return as JSON
+		respErr = &Error{
+			Code:    "unknown",
+			Message: err.Error(),
+		}
+		resp = respErr
+	}
+
+	if r, ok := resp.(io.Reader); ok {
+		w.WriteHeader(statusCode)
+		io.Copy(w, r)
+	} else {
+		ResponseJSON(w, statusCode, resp)
+	}
+
+	return respErr
+}
+
 // Un can be called with defer passing Lock() function as parameter.
 //  defer fdhttp.Un(Lock(&m))
 func Un(f func()) {
@@ -1,8 +1,10 @@
 package fdhttp_test
 
 import (
+	"errors"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/foodora/go-ranger/fdhttp"
@@ -28,3 +30,17 @@ func TestResponseJSON(t *testing.T) {
 	assert.Equal(t, http.StatusBadRequest, w.Code)
 	assert.Equal(t, `{"success":true,"data":1}`+"\n", w.Body.String())
 }
+
+func TestResponseEndpoint(t *testing.T) {
+	w := httptest.NewRecorder()
+	respErr := fdhttp.ResponseEndpoint(w, http.StatusInternalServerError, errors.New("database is down"))
+	assert.Equal(t, &fdhttp.Error{Code: "unknown", Message: "database is down"}, respErr)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, `{"code":"unknown","message":"database is down"}`+"\n", w.Body.String())
+
+	w = httptest.NewRecorder()
+	respErr = fdhttp.ResponseEndpoint(w, http.StatusOK, strings.NewReader("plain text"))
+	assert.Nil(t, respErr)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "plain text", w.Body.String())
+}
@@ -4,7 +4,6 @@ import (
 	"bytes"
 	"context"
 	"fmt"
-	"io"
 	"io/ioutil"
 	"net/http"
 	"strings"
@@ -26,8 +25,10 @@ type Router struct {
 	Prefix string
 
 	httprouter *httprouter.Router
-	parent     *Router
-	childs     []*Router
+	// streams has the routes registered with StreamHandler
+	streams *httprouter.Router
+	parent  *Router
+	childs  []*Router
 
 	middlewares []fdmiddleware.Middleware
 	handlers    []Handler
@@ -179,6 +180,44 @@ func (r *Router) StdHandler(method, path string, handler http.HandlerFunc) *Endp
 	return e
 }
 
+// StreamHandler register a standard http.HandlerFunc that reads the body
+// itself, the body is not buffered and forms are not parsed. Use it to
+// receive large uploads or forward requests like fdhandler.Proxy.
+func (r *Router) StreamHandler(method, path string, handler http.HandlerFunc) *Endpoint {
+	if r.parent != nil {
+		return r.parent.StreamHandler(method, r.Prefix+path, r.wrapMiddlewares(handler).ServeHTTP)
+	}
+
+	if r.streams == nil {
+		r.streams = httprouter.New()
+	}
+	r.streams.Handle(method, r.Prefix+path, func(http.ResponseWriter, *http.Request, httprouter.Params) {})
+
+	r.httprouter.Handle(method, r.Prefix+path, func(w http.ResponseWriter, req *http.Request, ps httprouter.Params) {
+		*req = *req.WithContext(SetRouteParams(req.Context(), convertParams(ps)))
+		handler(w, req)
+	})
+
+	e := &Endpoint{
+		router: r,
+		Method: method,
+		Path:   r.Prefix + path,
+	}
+	r.addEndpoint(e)
+
+	return e
+}
+
+// isStream return true if req is handled by a StreamHandler.
+func (r *Router) isStream(req *http.Request) bool {
+	if r.streams == nil {
+		return false
+	}
+
+	h, _, _ := r.streams.Lookup(req.Method, req.URL.Path)
+	return h != nil
+}
+
 // StdGET register a standard http.HandlerFunc to handle GET method
 func (r *Router) StdGET(path string, handler http.HandlerFunc) *Endpoint {
 	return r.StdHandler("GET", path, handler)
@@ -243,31 +282,14 @@ func (r *Router) Handler(method, path string, fn EndpointFunc) *Endpoint {
 
 			// call user handler
 			statusCode, resp := fn(ctx)
-			if respErr, ok := resp.(*Error); ok {
-				ctx = SetResponseError(ctx, respErr)
-			} else if _, ok := resp.(JSONer); ok {
-				// If resp is a JSON should have precedence to error
-				// Check case test TestRouter_SendCustomErrorAsJSON
-			} else if err, ok := resp.(error); ok {
-				// If it's a error let's convert to fdhttp.Error and return as JSON
-				respErr := &Error{
-					Code:    "unknown",
-					Message: err.Error(),
-				}
+			respErr := ResponseEndpoint(w, statusCode, resp)
+			if respErr != nil {
 				ctx = SetResponseError(ctx, respErr)
-				resp = respErr
 			}
 
 			// Override request, with that middlewares can access ctx with
 			// information added here
 			*req = *req.WithContext(ctx)
-
-			if r, ok := resp.(io.Reader); ok {
-				w.WriteHeader(statusCode)
-				io.Copy(w, r)
-			} else {
-				ResponseJSON(w, statusCode, resp)
-			}
 		})
 
 		currentRouter := r
@@ -339,7 +361,7 @@ func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	ctx = SetResponseHeader(ctx, w.Header())
 
 	// Inject Form and PostForm
-	if req.Form == nil {
+	if req.Form == nil && !r.isStream(req) {
 		req.ParseMultipartForm(defaultMaxMemory)
 		if req.Form != nil {
 			ctx = SetRequestForm(ctx, req.Form)
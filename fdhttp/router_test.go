@@ -1061,3 +1061,28 @@ func TestRouter_CancelingRequest(t *testing.T) {
 	<-canceledChan
 	assert.True(t, handlerCanceled)
 }
+
+func TestRouter_StreamHandler(t *testing.T) {
+	router := fdhttp.NewRouter()
+	sub := router.SubRouter()
+	sub.Prefix = "/upload"
+
+	var body []byte
+	var params map[string]string
+	sub.StreamHandler(http.MethodPost, "/:name", func(w http.ResponseWriter, req *http.Request) {
+		assert.Nil(t, req.PostForm, "form should not be parsed")
+		assert.Nil(t, fdhttp.RequestBody(req.Context()), "body should not be buffered")
+
+		params = fdhttp.RouteParams(req.Context())
+		body, _ = ioutil.ReadAll(req.Body)
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/upload/menu", strings.NewReader("name=pizza"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "name=pizza", string(body))
+	assert.Equal(t, "menu", params["name"])
+}
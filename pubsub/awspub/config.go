@@ -1,18 +1,24 @@
 package awspub
 
-import "github.com/aws/aws-sdk-go/aws"
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/foodora/go-ranger/fdbackoff"
+)
 
 // SNSConfig holds the info required to work with Amazon SNS.
 type SNSConfig struct {
 	aws.Config
 
 	Topic string
+
+	// RetryPolicy is optional and retry throttled and temporary errors.
+	RetryPolicy *fdbackoff.Policy
 }
 
 // NewSNSConfig return a SNSConfig instance to work with
 func NewSNSConfig(config aws.Config, topic string) SNSConfig {
 	return SNSConfig{
-		config,
-		topic,
+		Config: config,
+		Topic:  topic,
 	}
 }
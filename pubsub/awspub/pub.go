@@ -4,18 +4,21 @@ import (
 	"context"
 	"errors"
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/sns"
 	"github.com/aws/aws-sdk-go/service/sns/snsiface"
+	"github.com/foodora/go-ranger/fdbackoff"
 	"github.com/foodora/go-ranger/pubsub"
 )
 
 // publisher will accept AWS configuration and an SNS topic name
 // and it will emit any publish events to it.
 type publisher struct {
-	sns    snsiface.SNSAPI
-	topic  string
-	Logger pubsub.Logger
+	sns         snsiface.SNSAPI
+	topic       string
+	retryPolicy *fdbackoff.Policy
+	Logger      pubsub.Logger
 }
 
 // NewPublisher will initiate the SNS client.
@@ -24,6 +27,7 @@ func NewPublisher(cfg SNSConfig) (pubsub.Publisher, error) {
 	p.Logger = pubsub.DefaultLogger
 
 	p.topic = cfg.Topic
+	p.retryPolicy = cfg.RetryPolicy
 
 	if cfg.Region == nil {
 		return p, errors.New("SNS region is required")
@@ -55,8 +59,7 @@ func (p *publisher) Publish(ctx context.Context, key string, m string) error {
 		Message:  aws.String(m),
 	}
 
-	_, err := p.sns.Publish(msg)
-	return err
+	return p.publish(ctx, msg)
 }
 
 // Publish send the message to the specified SNS topic.
@@ -68,6 +71,21 @@ func (p *publisher) PublishToTopic(ctx context.Context, key string, m string, to
 		Message:  aws.String(m),
 	}
 
-	_, err := p.sns.Publish(msg)
-	return err
+	return p.publish(ctx, msg)
+}
+
+// publish send msg using the retry policy, when it's configured.
+func (p *publisher) publish(ctx context.Context, msg *sns.PublishInput) error {
+	if p.retryPolicy == nil {
+		_, err := p.sns.PublishWithContext(ctx, msg)
+		return err
+	}
+
+	return fdbackoff.Retry(ctx, *p.retryPolicy, func(attempt int) error {
+		_, err := p.sns.PublishWithContext(ctx, msg)
+		if err != nil && !request.IsErrorRetryable(err) && !request.IsErrorThrottle(err) {
+			return fdbackoff.Permanent(err)
+		}
+		return err
+	})
 }
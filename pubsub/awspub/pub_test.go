@@ -4,9 +4,11 @@ import (
 	"context"
 	"errors"
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/service/sns"
 	"github.com/aws/aws-sdk-go/service/sns/snsiface"
+	"github.com/foodora/go-ranger/fdbackoff"
 	"github.com/foodora/go-ranger/pubsub"
 	"github.com/stretchr/testify/assert"
 	"testing"
@@ -96,9 +98,54 @@ func TestPublisherToTopic(t *testing.T) {
 	}
 }
 
+func TestPublisher_RetryPolicy(t *testing.T) {
+	snstest := &TestSNSAPI{
+		Error:    awserr.New("Throttling", "rate exceeded", nil),
+		Failures: 2,
+	}
+	pub := &publisher{
+		topic:       DefaultTopic,
+		sns:         snstest,
+		retryPolicy: &fdbackoff.Policy{MaxAttempts: 5},
+		Logger:      pubsub.DefaultLogger,
+	}
+
+	err := pub.Publish(context.Background(), "subject", "message")
+	assert.NoError(t, err)
+	assert.Len(t, snstest.Published, 3)
+
+	// validation errors are not retried
+	snstest = &TestSNSAPI{
+		Error: awserr.New(sns.ErrCodeInvalidParameterException, "invalid topic", nil),
+	}
+	pub.sns = snstest
+
+	err = pub.Publish(context.Background(), "subject", "message")
+	assert.Error(t, err)
+	assert.Len(t, snstest.Published, 1)
+}
+
+func TestPublisher_ContextCanceled(t *testing.T) {
+	snstest := &TestSNSAPI{}
+	pub := &publisher{
+		topic:  DefaultTopic,
+		sns:    snstest,
+		Logger: pubsub.DefaultLogger,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := pub.Publish(ctx, "subject", "message")
+	assert.Equal(t, context.Canceled, err)
+	assert.Len(t, snstest.Published, 0)
+}
+
 type TestSNSAPI struct {
 	// Error will be returned by the API when Publish() is called.
 	Error error
+	// Failures is how many calls return Error, zero means all of them.
+	Failures int
 	// Published allows users to inspect which values have been published.
 	Published []*sns.PublishInput
 }
@@ -107,6 +154,9 @@ var _ snsiface.SNSAPI = &TestSNSAPI{}
 
 func (t *TestSNSAPI) Publish(i *sns.PublishInput) (*sns.PublishOutput, error) {
 	t.Published = append(t.Published, i)
+	if t.Failures > 0 && len(t.Published) > t.Failures {
+		return &sns.PublishOutput{}, nil
+	}
 	return &sns.PublishOutput{}, t.Error
 }
 
@@ -356,8 +406,11 @@ func (t *TestSNSAPI) ListTopicsPagesWithContext(aws.Context, *sns.ListTopicsInpu
 func (t *TestSNSAPI) PublishRequest(*sns.PublishInput) (*request.Request, *sns.PublishOutput) {
 	return nil, nil
 }
-func (t *TestSNSAPI) PublishWithContext(aws.Context, *sns.PublishInput, ...request.Option) (*sns.PublishOutput, error) {
-	return nil, errNotImpl
+func (t *TestSNSAPI) PublishWithContext(ctx aws.Context, i *sns.PublishInput, _ ...request.Option) (*sns.PublishOutput, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return t.Publish(i)
 }
 
 func (t *TestSNSAPI) RemovePermissionRequest(*sns.RemovePermissionInput) (*request.Request, *sns.RemovePermissionOutput) {
@@ -0,0 +1,29 @@
+package ranger_logger
+
+import (
+	"github.com/foodora/go-ranger/fdhttp/fdmiddleware"
+)
+
+// ClientCallLogger return a function to be used with
+// fdmiddleware.ClientLogTransport.SetLoggerFunc, failed calls are logged as
+// error, 5xx as warning and others as info:
+//  logTransport := fdmiddleware.NewClientLogTransport()
+//  logTransport.SetLoggerFunc(ranger_logger.ClientCallLogger(logger))
+func ClientCallLogger(logger LoggerInterface) func(call *fdmiddleware.ClientCall) {
+	return func(call *fdmiddleware.ClientCall) {
+		data := LoggerData(call.Fields())
+		message := "http client " + call.Method + " " + call.Host
+		if call.Route != fdmiddleware.UnknownRoute {
+			message += call.Route
+		}
+
+		switch {
+		case call.Err != nil:
+			logger.Error(message, data)
+		case call.StatusCode >= 500:
+			logger.Warning(message, data)
+		default:
+			logger.Info(message, data)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package ranger_logger
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/foodora/go-ranger/fdhttp/fdmiddleware"
+	"github.com/stretchr/testify/assert"
+)
+
+type levelLogger struct {
+	LoggerInterface
+	level   string
+	message string
+	data    LoggerData
+}
+
+func (l *levelLogger) log(level, message string, data LoggerData) {
+	l.level, l.message, l.data = level, message, data
+}
+
+func (l *levelLogger) Info(message string, data LoggerData)    { l.log("info", message, data) }
+func (l *levelLogger) Warning(message string, data LoggerData) { l.log("warning", message, data) }
+func (l *levelLogger) Error(message string, data LoggerData)   { l.log("error", message, data) }
+
+func TestClientCallLogger(t *testing.T) {
+	logger := &levelLogger{}
+	fn := ClientCallLogger(logger)
+
+	call := &fdmiddleware.ClientCall{
+		Method:     http.MethodGet,
+		Host:       "menu-service",
+		Route:      "/menus/:id",
+		StatusCode: http.StatusOK,
+	}
+
+	fn(call)
+	assert.Equal(t, "info", logger.level)
+	assert.Equal(t, "http client GET menu-service/menus/:id", logger.message)
+	assert.Equal(t, "/menus/:id", logger.data["http_route"])
+
+	call.StatusCode = http.StatusBadGateway
+	fn(call)
+	assert.Equal(t, "warning", logger.level)
+
+	call.Err = errors.New("connection refused")
+	fn(call)
+	assert.Equal(t, "error", logger.level)
+	assert.Equal(t, "connection refused", logger.data["error"])
+}